@@ -13,19 +13,28 @@ CREATE TABLE wiki_article (
 	wiki_art_id INT AUTO_INCREMENT PRIMARY KEY,
 	wiki_source_url LONGTEXT,
 	text LONGTEXT,
-	wiki_category LONGTEXT
+	wiki_category LONGTEXT,
+	page_id INT,
+	INDEX (page_id)
 );
 
 CREATE TABLE news_diffbot (
 	news_art_id INT AUTO_INCREMENT PRIMARY KEY,
-	timestamp DATE,
+	timestamp DATETIME,
+	timestamp_zone VARCHAR(8),
+	timestamp_format VARCHAR(64),
 	site_name LONGTEXT,
 	publisher_region LONGTEXT,
 	category LONGTEXT,
 	title LONGTEXT,
 	text LONGTEXT,
 	human_language LONGTEXT,
-	news_source_url LONGTEXT
+	news_source_url LONGTEXT,
+	canonical_url LONGTEXT,
+	canonical_url_hash CHAR(64),
+	archive_url LONGTEXT,
+	archive_timestamp DATETIME,
+	INDEX (canonical_url_hash)
 );
 
 CREATE TABLE searched_date (
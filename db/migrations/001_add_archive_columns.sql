@@ -0,0 +1,4 @@
+-- 既存のDBにWayback Machineのスナップショット情報を追加する
+ALTER TABLE news_diffbot
+	ADD COLUMN archive_url LONGTEXT,
+	ADD COLUMN archive_timestamp DATETIME;
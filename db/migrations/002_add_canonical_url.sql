@@ -0,0 +1,5 @@
+-- 既存のDBに正規化したURLを追加する
+-- 既存の行のcanonical_urlは、main.goの実行時に登録される（sqldb.FillEmptyCanonicalUrls）
+ALTER TABLE news_diffbot
+	ADD COLUMN canonical_url VARCHAR(768) AFTER news_source_url,
+	ADD INDEX (canonical_url);
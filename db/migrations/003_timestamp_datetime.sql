@@ -0,0 +1,5 @@
+-- 既存のDBのタイムスタンプを、時刻とタイムゾーンを保持できるようにする
+ALTER TABLE news_diffbot
+	MODIFY COLUMN timestamp DATETIME,
+	ADD COLUMN timestamp_zone VARCHAR(8) AFTER timestamp,
+	ADD COLUMN timestamp_format VARCHAR(64) AFTER timestamp_zone;
@@ -0,0 +1,5 @@
+-- 既存のDBのwiki内記事に、Wikipediaの記事IDを保持できるようにする
+-- 値は、Goの処理（sqldb.FillEmptyWikiPageIds）が本文のHTMLから埋める
+ALTER TABLE wiki_article
+	ADD COLUMN page_id INT,
+	ADD INDEX (page_id);
@@ -0,0 +1,7 @@
+-- 長いURLを切り詰めないように、正規化したURLの型を広げ、重複の判定にはそのハッシュ値（SHA-256）を用いる
+-- 既存の行のcanonical_url_hashは、main.goの実行時に登録される（sqldb.FillEmptyCanonicalUrls）
+ALTER TABLE news_diffbot
+	DROP INDEX canonical_url,
+	MODIFY COLUMN canonical_url LONGTEXT,
+	ADD COLUMN canonical_url_hash CHAR(64) AFTER canonical_url,
+	ADD INDEX (canonical_url_hash);
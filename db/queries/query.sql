@@ -5,13 +5,13 @@ INSERT INTO wiki_event(
 
 -- name: InsertWikiArticle :exec
 INSERT INTO wiki_article(
-    wiki_source_url, text, wiki_category
-) VALUES (?,?,?);
+    wiki_source_url, text, wiki_category, page_id
+) VALUES (?,?,?,?);
 
 -- name: InsertNewsArticle :exec
 INSERT INTO news_diffbot(
-    timestamp, site_name, publisher_region, category, title, text, human_language, news_source_url
-) VALUES (?,?,?,?,?,?,?,?);
+    timestamp, timestamp_zone, timestamp_format, site_name, publisher_region, category, title, text, human_language, news_source_url, canonical_url, canonical_url_hash, archive_url, archive_timestamp
+) VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?);
 
 -- name: InsertDate :exec
 INSERT INTO searched_date(
@@ -24,9 +24,10 @@ FROM wiki_article
 WHERE wiki_source_url = ?;
 
 -- name: SelectNewsArticle :one
-SELECT news_art_id, timestamp, site_name, publisher_region, category, title, text, human_language, news_source_url
+SELECT news_art_id, timestamp, timestamp_zone, timestamp_format, site_name, publisher_region, category, title, text, human_language, news_source_url, canonical_url, archive_url, archive_timestamp
 FROM news_diffbot
-WHERE news_source_url = ?;
+WHERE canonical_url_hash = ?
+LIMIT 1;
 
 -- name: SelectEvents :many
 SELECT category, tags, text, entitie, news_source_url 
@@ -47,5 +48,31 @@ LIMIT 1;
 
 -- name: UpdateDiffbotData :exec
 UPDATE news_diffbot 
-SET timestamp = ?, site_name = ?, publisher_region = ?, category = ?, title = ?, text = ?, human_language = ? 
-WHERE news_art_id = ?;
\ No newline at end of file
+SET timestamp = ?, timestamp_zone = ?, timestamp_format = ?, site_name = ?, publisher_region = ?, category = ?, title = ?, text = ?, human_language = ?, archive_url = ?, archive_timestamp = ? 
+WHERE news_art_id = ?;
+
+-- name: SelectNewsEventDates :many
+SELECT date, news_source_url
+FROM wiki_event;
+
+-- name: FillEmptyCanonicalUrls :exec
+UPDATE news_diffbot
+SET canonical_url = ?, canonical_url_hash = ?
+WHERE news_art_id = ?;
+
+-- name: SelectEventsOfNewsArts :many
+SELECT event_id, date, category, text, news_source_url
+FROM wiki_event;
+-- name: ForEachWikiArticle :many
+SELECT wiki_art_id, wiki_source_url, text, wiki_category, page_id
+FROM wiki_article;
+
+-- name: FillEmptyWikiPageIds :exec
+UPDATE wiki_article
+SET page_id = ?
+WHERE wiki_art_id = ?;
+
+-- name: SelectAllWikiPageIds :many
+SELECT wiki_art_id, page_id
+FROM wiki_article
+WHERE page_id IS NOT NULL;
@@ -0,0 +1,386 @@
+package analysis
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"main/apis/pipeline"
+	"math"
+	"os"
+	"sort"
+)
+
+// LSHSchemaVersionは索引ファイルの現在のスキーマのバージョン
+const LSHSchemaVersion = 1
+
+// LSHOptionは索引の作り方
+type LSHOption struct {
+	// ハッシュ表の数と、一つのハッシュ表で用いる超平面の数（64まで）
+	Tables int
+	Bits   int
+	// 超平面を決めるシード（同じ値なら同じ索引になる）
+	Seed int64
+	// 検索で候補とする、ハッシュ表の値のハミング距離の上限（大きいほど見落としが減り、遅くなる）
+	Radius int
+}
+
+func DefaultLSHOption() LSHOption {
+	return LSHOption{Tables: 32, Bits: 20, Radius: 3, Seed: 1}
+}
+
+// LSHIndexはイベントのベクトルの、ランダムな超平面を用いた局所性鋭敏型ハッシュ（random-projection LSH）による近似最近傍探索の索引。
+// 各ハッシュ表では、ベクトルが各超平面のどちら側にあるかをビットにした値でイベントを振り分ける。
+// 超平面の各単語の成分は、シードと単語のハッシュ値から決めるため、持たずに済む（単語が増えても索引を作り直す必要がない）。
+// 検索では、いずれかのハッシュ表で値のハミング距離がRadius（初期値3）ビット以下のイベントを候補とし、コサイン類似度の高い順に並べる。
+type LSHIndex struct {
+	SchemaVersion int   `json:"schema_version"`
+	Tables        int   `json:"tables"`
+	Bits          int   `json:"bits"`
+	Seed          int64 `json:"seed"`
+	Radius        int   `json:"radius"`
+	// 単語（添字が単語のID）
+	Terms  []string   `json:"terms"`
+	Events []LSHEvent `json:"events"`
+
+	vocab   *Vocabulary
+	vectors []SparseVector
+	// ハッシュ表ごとの、値ごとのイベント（Eventsの添字）
+	buckets []map[uint64][]int
+	byId    map[int]int
+	// 単語のIDごとの、ハッシュ表ごとの超平面の成分の符号（ビットが1なら+1、0なら-1）
+	planes map[int32][]uint64
+}
+
+// LSHEventは索引に含めるイベント
+type LSHEvent struct {
+	Id     int       `json:"id"`
+	Date   string    `json:"date"`
+	Text   string    `json:"text"`
+	Terms  []int32   `json:"terms"`
+	Values []float64 `json:"values"`
+}
+
+// Neighborは検索で見つかったイベント
+type Neighbor struct {
+	Id         int
+	Date       string
+	Text       string
+	Similarity float64
+}
+
+// NewLSHIndexは空の索引を作る
+func NewLSHIndex(opt LSHOption) (*LSHIndex, error) {
+	if opt.Tables < 1 || opt.Bits < 1 || 64 < opt.Bits || opt.Radius < 0 || opt.Bits < opt.Radius {
+		return nil, fmt.Errorf("tables must be positive, bits must be in [1, 64] and radius in [0, bits]: %d, %d, %d", opt.Tables, opt.Bits, opt.Radius)
+	}
+	x := &LSHIndex{Tables: opt.Tables, Bits: opt.Bits, Seed: opt.Seed, Radius: opt.Radius}
+	x.init()
+	return x, nil
+}
+
+// initは保存しない項目を作る
+func (x *LSHIndex) init() {
+	x.vocab = NewVocabulary()
+	x.buckets = make([]map[uint64][]int, x.Tables)
+	for i := range x.buckets {
+		x.buckets[i] = make(map[uint64][]int)
+	}
+	x.byId = make(map[int]int)
+	x.planes = make(map[int32][]uint64)
+}
+
+// Lenは索引のイベントの数を戻す
+func (x *LSHIndex) Len() int {
+	return len(x.Events)
+}
+
+// Addはイベントとそのベクトル（vectors[e.Id]）を索引に加える。既に加えたIDのイベントは加えない（複数の年のイベントを加える場合）。
+func (x *LSHIndex) Add(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) {
+	for _, e := range d.Events {
+		if _, found := x.byId[e.Id]; found {
+			continue
+		}
+		v := NewSparseVector(x.vocab, vectors[e.Id])
+		x.Events = append(x.Events, LSHEvent{Id: e.Id, Date: e.Date, Text: e.Text, Terms: v.Ids, Values: v.Values})
+		x.insert(v)
+	}
+}
+
+// insertはEventsの最後のイベントのベクトルをハッシュ表に振り分ける
+func (x *LSHIndex) insert(v SparseVector) {
+	i := len(x.vectors)
+	x.vectors = append(x.vectors, v)
+	x.byId[x.Events[i].Id] = i
+	for t, h := range x.signatures(v, nil) {
+		x.buckets[t][h] = append(x.buckets[t][h], i)
+	}
+}
+
+// planeは語彙にある単語の、ハッシュ表ごとの超平面の成分の符号を戻す
+func (x *LSHIndex) plane(id int32) []uint64 {
+	if p, found := x.planes[id]; found {
+		return p
+	}
+	p := x.termPlane(x.vocab.Term(id))
+	x.planes[id] = p
+	return p
+}
+
+// termPlaneは単語の、ハッシュ表ごとの超平面の成分の符号を計算する（語彙にない単語にも用いる）
+func (x *LSHIndex) termPlane(term string) []uint64 {
+	p := make([]uint64, x.Tables)
+	b := make([]byte, 8)
+	for t := range p {
+		h := fnv.New64a()
+		binary.LittleEndian.PutUint64(b, uint64(x.Seed))
+		h.Write(b)
+		binary.LittleEndian.PutUint64(b, uint64(t))
+		h.Write(b)
+		h.Write([]byte(term))
+		p[t] = h.Sum64()
+	}
+	return p
+}
+
+// signaturesはベクトルのハッシュ表ごとの値を戻す。extraは語彙にない単語の値（索引のイベントではnil）。
+func (x *LSHIndex) signatures(v SparseVector, extra map[string]float64) []uint64 {
+	sums := make([][]float64, x.Tables)
+	for t := range sums {
+		sums[t] = make([]float64, x.Bits)
+	}
+	add := func(plane []uint64, value float64) {
+		for t, signs := range plane {
+			for b := 0; b < x.Bits; b++ {
+				if signs>>uint(b)&1 == 1 {
+					sums[t][b] += value
+				} else {
+					sums[t][b] -= value
+				}
+			}
+		}
+	}
+	for k, id := range v.Ids {
+		add(x.plane(id), v.Values[k])
+	}
+	for term, value := range extra {
+		add(x.termPlane(term), value)
+	}
+	sigs := make([]uint64, x.Tables)
+	for t := range sums {
+		for b, s := range sums[t] {
+			if s > 0 {
+				sigs[t] |= 1 << uint(b)
+			}
+		}
+	}
+	return sigs
+}
+
+// Similarは索引のイベントに似たイベントを、コサイン類似度の高い順にk件まで戻す（イベント自身は除く）
+func (x *LSHIndex) Similar(id, k int) ([]Neighbor, error) {
+	i, found := x.byId[id]
+	if !found {
+		return nil, fmt.Errorf("event %d is not in the index", id)
+	}
+	return x.search(x.vectors[i], nil, k, i, false), nil
+}
+
+// SimilarExactはSimilarと同じだが、全てのイベントと比べる（近似の精度を確かめるため）
+func (x *LSHIndex) SimilarExact(id, k int) ([]Neighbor, error) {
+	i, found := x.byId[id]
+	if !found {
+		return nil, fmt.Errorf("event %d is not in the index", id)
+	}
+	return x.search(x.vectors[i], nil, k, i, true), nil
+}
+
+// Queryは索引にないベクトルに似たイベントを、コサイン類似度の高い順にk件まで戻す。
+// 語彙にない単語は語彙に加えない（Saveで書き出さない）。索引のイベントとの内積には寄与しないが、
+// ベクトルの長さと超平面のどちら側にあるかには寄与するため、それぞれの計算に含める。
+func (x *LSHIndex) Query(vec map[string]float64, k int) []Neighbor {
+	known := make(map[string]float64, len(vec))
+	extra := make(map[string]float64)
+	norm := 0.0
+	for term, value := range vec {
+		if value == 0 {
+			continue
+		}
+		if _, found := x.vocab.Lookup(term); found {
+			known[term] = value
+		} else {
+			extra[term] = value
+			norm += value * value
+		}
+	}
+	v := NewSparseVector(x.vocab, known)
+	v.norm = math.Sqrt(v.norm*v.norm + norm)
+	return x.search(v, extra, k, -1, false)
+}
+
+// searchはvに似たイベントをk件まで戻す。exactでない場合は、candidatesのイベントのみと比べる。
+// extraは語彙にない単語の値（索引のイベントではnil）。
+func (x *LSHIndex) search(v SparseVector, extra map[string]float64, k, self int, exact bool) []Neighbor {
+	var candidates []int
+	if exact {
+		for i := range x.vectors {
+			candidates = append(candidates, i)
+		}
+	} else {
+		candidates = x.candidates(v, extra)
+	}
+	var result []Neighbor
+	for _, i := range candidates {
+		if i == self {
+			continue
+		}
+		e := x.Events[i]
+		result = append(result, Neighbor{Id: e.Id, Date: e.Date, Text: e.Text, Similarity: v.Cosine(x.vectors[i])})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Similarity != result[j].Similarity {
+			return result[i].Similarity > result[j].Similarity
+		}
+		return result[i].Id < result[j].Id
+	})
+	if len(result) > k {
+		result = result[:k]
+	}
+	return result
+}
+
+// candidatesは、いずれかのハッシュ表で値のハミング距離がRadius以下のイベントを戻す
+func (x *LSHIndex) candidates(v SparseVector, extra map[string]float64) []int {
+	var candidates []int
+	seen := make(map[int]bool)
+	for t, h := range x.signatures(v, extra) {
+		for _, probe := range x.probes(h) {
+			for _, i := range x.buckets[t][probe] {
+				if !seen[i] {
+					seen[i] = true
+					candidates = append(candidates, i)
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// probesはハッシュ表の値hと、hとのハミング距離がRadius以下の値を戻す
+func (x *LSHIndex) probes(h uint64) []uint64 {
+	probes := []uint64{h}
+	var flip func(from int, v uint64, depth int)
+	flip = func(from int, v uint64, depth int) {
+		if depth == x.Radius {
+			return
+		}
+		for b := from; b < x.Bits; b++ {
+			p := v ^ 1<<uint(b)
+			probes = append(probes, p)
+			flip(b+1, p, depth+1)
+		}
+	}
+	flip(0, h, 0)
+	return probes
+}
+
+// Recallは索引のイベントをsample件まで選び、Similarで見つかったk件のうち、全てのイベントと比べた上位k件に含まれるものの割合の平均と、
+// Similarで比べたイベントの、全てのイベントに対する割合の平均を戻す
+func (x *LSHIndex) Recall(k, sample int) (float64, float64) {
+	if len(x.Events) == 0 || k < 1 || sample < 1 {
+		return 0, 0
+	}
+	step := len(x.Events) / sample
+	if step < 1 {
+		step = 1
+	}
+	var sum, compared float64
+	n := 0
+	for i := 0; i < len(x.Events) && n < sample; i += step {
+		exact := x.search(x.vectors[i], nil, k, i, true)
+		if len(exact) == 0 {
+			continue
+		}
+		want := make(map[int]bool)
+		for _, v := range exact {
+			want[v.Id] = true
+		}
+		hit := 0
+		for _, v := range x.search(x.vectors[i], nil, k, i, false) {
+			if want[v.Id] {
+				hit++
+			}
+		}
+		sum += float64(hit) / float64(len(exact))
+		compared += float64(len(x.candidates(x.vectors[i], nil))) / float64(len(x.Events))
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), compared / float64(n)
+}
+
+// LoadLSHIndexは索引ファイルを読み込み、ハッシュ表を作り直す
+func LoadLSHIndex(path string) (*LSHIndex, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var x LSHIndex
+	err = json.Unmarshal(b, &x)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if x.SchemaVersion != LSHSchemaVersion {
+		return nil, fmt.Errorf("%s: unsupported schema_version %d (want %d)", path, x.SchemaVersion, LSHSchemaVersion)
+	}
+	if x.Tables < 1 || x.Bits < 1 || 64 < x.Bits || x.Radius < 0 || x.Bits < x.Radius {
+		return nil, fmt.Errorf("%s: tables must be positive, bits must be in [1, 64] and radius in [0, bits]: %d, %d, %d", path, x.Tables, x.Bits, x.Radius)
+	}
+	x.init()
+	for _, term := range x.Terms {
+		x.vocab.ID(term)
+	}
+	if x.vocab.Len() != len(x.Terms) {
+		return nil, fmt.Errorf("%s: duplicate terms", path)
+	}
+	events := x.Events
+	x.Events = nil
+	for i, e := range events {
+		if _, found := x.byId[e.Id]; found {
+			return nil, fmt.Errorf("%s: events[%d]: duplicate id %d", path, i, e.Id)
+		}
+		if len(e.Terms) != len(e.Values) {
+			return nil, fmt.Errorf("%s: events[%d] (id %d): terms and values differ in length", path, i, e.Id)
+		}
+		v := SparseVector{Ids: e.Terms, Values: e.Values}
+		for k, id := range e.Terms {
+			if id < 0 || int(id) >= len(x.Terms) || (k > 0 && id <= e.Terms[k-1]) {
+				return nil, fmt.Errorf("%s: events[%d] (id %d): invalid term id %d", path, i, e.Id, id)
+			}
+			v.norm += e.Values[k] * e.Values[k]
+		}
+		v.norm = math.Sqrt(v.norm)
+		x.Events = append(x.Events, e)
+		x.insert(v)
+	}
+	return &x, nil
+}
+
+// Saveは索引をファイルに書き込む
+func (x *LSHIndex) Save(path string) error {
+	x.SchemaVersion = LSHSchemaVersion
+	x.Terms = x.vocab.terms
+	if x.Terms == nil {
+		x.Terms = []string{}
+	}
+	if x.Events == nil {
+		x.Events = []LSHEvent{}
+	}
+	output, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, output, 0644)
+}
@@ -0,0 +1,140 @@
+package analysis
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLSHQueryKeepsVocabulary(t *testing.T) {
+	d, vectors := syntheticEvents(200, 1)
+	index, err := NewLSHIndex(DefaultLSHOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(d, vectors)
+	terms := index.vocab.Len()
+
+	// 語彙にある単語と、ない単語を混ぜた検索
+	query := make(map[string]float64)
+	for term, value := range vectors[1] {
+		query[term] = value
+	}
+	query["unseen-a"] = 0.7
+	query["unseen-b"] = 0.3
+	neighbors := index.Query(query, 5)
+	if index.vocab.Len() != terms {
+		t.Errorf("vocabulary grew from %d to %d terms", terms, index.vocab.Len())
+	}
+	if len(neighbors) == 0 || neighbors[0].Id != 1 {
+		t.Fatalf("Query = %v, want event 1 first", neighbors)
+	}
+	// 語彙にない単語もベクトルの長さには含める
+	if want := cosine(query, vectors[1]); math.Abs(neighbors[0].Similarity-want) > 1e-12 {
+		t.Errorf("similarity = %v, want %v", neighbors[0].Similarity, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadLSHIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.vocab.Len() != terms {
+		t.Errorf("saved %d terms, want %d", loaded.vocab.Len(), terms)
+	}
+	for _, term := range []string{"unseen-a", "unseen-b"} {
+		if _, found := loaded.vocab.Lookup(term); found {
+			t.Errorf("saved the query term %q", term)
+		}
+	}
+}
+
+// neighborIdsは検索結果のイベントのIDを戻す
+func neighborIds(neighbors []Neighbor) []int {
+	var ids []int
+	for _, v := range neighbors {
+		ids = append(ids, v.Id)
+	}
+	return ids
+}
+
+func TestLSHSaveLoadSimilar(t *testing.T) {
+	d, vectors := syntheticEvents(500, 1)
+	index, err := NewLSHIndex(DefaultLSHOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(d, vectors)
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := index.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadLSHIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != index.Len() {
+		t.Fatalf("loaded %d events, want %d", loaded.Len(), index.Len())
+	}
+	// 読み込んだ索引でも、同じハッシュ表から同じイベントが見つかる
+	for id := 1; id <= 500; id += 7 {
+		want, err := index.Similar(id, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := loaded.Similar(id, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(neighborIds(got), neighborIds(want)) {
+			t.Errorf("event %d: Similar after loading = %v, want %v", id, neighborIds(got), neighborIds(want))
+			continue
+		}
+		for i := range want {
+			if math.Abs(got[i].Similarity-want[i].Similarity) > 1e-12 || got[i].Date != want[i].Date {
+				t.Errorf("event %d: neighbors[%d] = %+v, want %+v", id, i, got[i], want[i])
+			}
+		}
+	}
+	if _, err := loaded.Similar(501, 10); err == nil {
+		t.Error("Similar(501): no error")
+	}
+}
+
+func TestLSHRecall(t *testing.T) {
+	d, vectors := syntheticEvents(1000, 1)
+	index, err := NewLSHIndex(DefaultLSHOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(d, vectors)
+	// 初期値の索引では、上位10件の8割程度を、全体の1割未満のイベントと比べるだけで見つける
+	recall, compared := index.Recall(10, 100)
+	if recall < 0.75 {
+		t.Errorf("recall = %.3f, want at least 0.75", recall)
+	}
+	if compared <= 0 || 0.2 < compared {
+		t.Errorf("compared %.3f of the events, want at most 0.2", compared)
+	}
+
+	// 全ての値を探す場合は、全てのイベントと比べた結果と同じになる
+	exhaustive, err := NewLSHIndex(LSHOption{Tables: 1, Bits: 4, Radius: 4, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exhaustive.Add(d, vectors)
+	for id := 1; id <= 1000; id += 37 {
+		got, _ := exhaustive.Similar(id, 10)
+		want, _ := exhaustive.SimilarExact(id, 10)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("event %d: Similar = %v, want %v", id, neighborIds(got), neighborIds(want))
+		}
+	}
+	if recall, compared := exhaustive.Recall(10, 100); recall != 1 || compared != 1 {
+		t.Errorf("exhaustive recall, compared = %v, %v, want 1, 1", recall, compared)
+	}
+}
@@ -0,0 +1,71 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"math"
+	"testing"
+)
+
+var centroidVectors = []map[string]float64{
+	{"a": 1, "b": 2},
+	{"b": 4, "c": 3},
+	{"a": 5, "c": 6},
+}
+
+// assertVectorはgotとwantの全ての要素が一致するかどうかを確かめる（片方にしかない要素は0とする）
+func assertVector(t *testing.T, got, want map[string]float64) {
+	t.Helper()
+	keys := make(map[string]bool)
+	for k := range got {
+		keys[k] = true
+	}
+	for k := range want {
+		keys[k] = true
+	}
+	for k := range keys {
+		if math.Abs(got[k]-want[k]) > 1e-12 {
+			t.Errorf("got %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+func TestCentroidIsOrderIndependent(t *testing.T) {
+	mean := map[string]float64{"a": 2, "b": 2, "c": 3}
+	orders := [][]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
+	for _, order := range orders {
+		t.Run(fmt.Sprint(order), func(t *testing.T) {
+			topic := pipeline.NewTopic(order[0], pipeline.Document{}, centroidVectors[order[0]])
+			for _, i := range order[1:] {
+				topic.CulcCenterOfGravity(centroidVectors[i])
+			}
+			assertVector(t, topic.CenterGravity, mean)
+			if topic.Count != 3 {
+				t.Errorf("Count = %d, want 3", topic.Count)
+			}
+		})
+	}
+}
+
+func TestCentroidDoesNotModifyFirstVector(t *testing.T) {
+	first := map[string]float64{"a": 1, "b": 2}
+	topic := pipeline.NewTopic(0, pipeline.Document{}, first)
+	topic.CulcCenterOfGravity(centroidVectors[1])
+	assertVector(t, first, centroidVectors[0])
+}
+
+func TestCentroidDecay(t *testing.T) {
+	// decayでは新しいベクトルほど重く扱われる
+	t.Run("decay 0.5", func(t *testing.T) {
+		topic := pipeline.NewTopic(0, pipeline.Document{}, centroidVectors[0])
+		topic.CulcCenterOfGravityDecay(centroidVectors[1], 0.5)
+		topic.CulcCenterOfGravityDecay(centroidVectors[2], 0.5)
+		assertVector(t, topic.CenterGravity, map[string]float64{"a": 2.75, "b": 1.5, "c": 3.75})
+	})
+	t.Run("decay 1 keeps only the last vector", func(t *testing.T) {
+		topic := pipeline.NewTopic(0, pipeline.Document{}, centroidVectors[1])
+		topic.CulcCenterOfGravityDecay(centroidVectors[0], 1)
+		assertVector(t, topic.CenterGravity, centroidVectors[0])
+	})
+}
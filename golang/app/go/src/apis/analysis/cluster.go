@@ -0,0 +1,555 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Clustererはイベントのベクトルからトピックを分類する。
+// どの方法でも結果は同じTopicsの形式にし、全てのイベントがいずれかのトピックに含まれる。
+type Clusterer interface {
+	Name() string
+	Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error)
+}
+
+// ClustererNamesはNewClustererで指定できる名前
+var ClustererNames = []string{"single-pass", "agglomerative", "dbscan", "kmeans", "tdt"}
+
+// ClusterOptionは分類の方法ごとの値。使わない値は無視する。
+type ClusterOption struct {
+	// single-pass、agglomerative、tdtで、同じトピックにするコサイン類似度の閾値
+	Threshold float64
+	// single-passで、トピックの重心をイベントを足すたびに近づける割合（0の場合は平均）
+	Decay float64
+	// single-passで、情報エントロピーが時間と共に増大するかどうかの確かめ方
+	Constraint EntropyConstraint
+	// agglomerativeで、トピック間の類似度の求め方（average, complete）
+	Linkage string
+	// dbscanで、近傍とするコサイン距離（1-コサイン類似度）と、コアとする近傍のイベントの数（自身を含む）
+	Eps       float64
+	MinPoints int
+	// kmeansで、トピックの数（0の場合はイベントの数から決める）と、繰り返しの上限と乱数のシード
+	K       int
+	MaxIter int
+	Seed    int64
+	// tdtで、トピックが続く日数（最後にイベントが加わってから）と、トピックをまとめるコサイン類似度の閾値（0の場合はまとめない）
+	Window         int
+	MergeThreshold float64
+}
+
+func DefaultClusterOption() ClusterOption {
+	return ClusterOption{
+		Threshold:      0.35,
+		Decay:          0,
+		Constraint:     DefaultEntropyConstraint(),
+		Linkage:        "average",
+		Eps:            0.65,
+		MinPoints:      2,
+		K:              0,
+		MaxIter:        50,
+		Seed:           1,
+		Window:         7,
+		MergeThreshold: 0.8,
+	}
+}
+
+// NewClustererは名前に対応するClustererを戻す
+func NewClusterer(name string, opt ClusterOption) (Clusterer, error) {
+	switch name {
+	case "single-pass":
+		if opt.Decay < 0 || 1 < opt.Decay {
+			return nil, fmt.Errorf("centroid decay must be in [0, 1]: %v", opt.Decay)
+		}
+		if err := opt.Constraint.Validate(); err != nil {
+			return nil, err
+		}
+		return SinglePass{Threshold: opt.Threshold, Decay: opt.Decay, Constraint: opt.Constraint}, nil
+	case "agglomerative":
+		if opt.Linkage != "average" && opt.Linkage != "complete" {
+			return nil, fmt.Errorf("unknown linkage: %s (average, complete)", opt.Linkage)
+		}
+		return Agglomerative{Threshold: opt.Threshold, Linkage: opt.Linkage}, nil
+	case "dbscan":
+		return DBSCAN{Eps: opt.Eps, MinPoints: opt.MinPoints}, nil
+	case "kmeans":
+		return KMeans{K: opt.K, MaxIter: opt.MaxIter, Seed: opt.Seed}, nil
+	case "tdt":
+		if opt.Window < 1 {
+			return nil, fmt.Errorf("window must be positive: %d", opt.Window)
+		}
+		return TDT{Threshold: opt.Threshold, Window: opt.Window, MergeThreshold: opt.MergeThreshold}, nil
+	}
+	return nil, fmt.Errorf("unknown clusterer: %s (%s)", name, strings.Join(ClustererNames, ", "))
+}
+
+// SinglePassはイベントを順に見て、最も類似したトピックに加える（これまでの分類方法）。
+// 類似度が閾値を超えるトピックがない場合や、情報エントロピーが時間と共に増大しなくなる場合は、新しいトピックにする。
+// 最も類似したトピックが情報エントロピーの制約（Constraint）を満たさない場合は、満たすトピックのうち最も類似したものに加える。
+// イベントの順番によって結果が変わるため、新しい順に並べてから用いる。
+// 比べるトピックは、トピックの重心の転置インデックスでイベントと単語を共有するものに絞る（閾値が負の場合は全てのトピック）。
+// Scanをtrueにすると、索引を使わずに全てのトピックと比べる（速さを比べるため）。
+type SinglePass struct {
+	Threshold  float64
+	Decay      float64
+	Constraint EntropyConstraint
+	Scan       bool
+}
+
+func (SinglePass) Name() string { return "single-pass" }
+
+func (c SinglePass) Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error) {
+	topics, _, err := c.Explain(d, vectors)
+	return topics, err
+}
+
+// Explainerはトピックの分類に加えて、情報エントロピーの制約で最も類似したトピックに加えなかったイベントを記録するClusterer
+type Explainer interface {
+	Clusterer
+	Explain(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, pipeline.Rejections, error)
+}
+
+func (c SinglePass) Explain(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, pipeline.Rejections, error) {
+	var topics []pipeline.Topic
+	rejections := pipeline.Rejections{Mode: c.Constraint.Mode, Epsilon: c.Constraint.Epsilon}
+	if rejections.Mode == "" {
+		rejections.Mode = ConstraintStrict
+	}
+	type candidate struct {
+		idx    int
+		cosSim float64
+	}
+	vocab := NewVocabulary()
+	index := NewTopicIndex(vocab)
+	for _, event := range d.Events {
+		date, err := time.Parse("2006-01-02", event.Date)
+		if err != nil {
+			return nil, pipeline.Rejections{}, err
+		}
+		inData := pipeline.Document{Date: date, Entropy: event.Entropy}
+		// 閾値を超えるトピックを類似度の高い順に並べ、制約を満たす最初のトピックに加える
+		var candidates []candidate
+		if c.Scan {
+			for j, topic := range topics {
+				cosSim := CulcCosSim(vectors[event.Id], topic.CenterGravity)
+				if c.Threshold < cosSim {
+					candidates = append(candidates, candidate{idx: j, cosSim: cosSim})
+				}
+			}
+		} else {
+			vec := NewSparseVector(vocab, vectors[event.Id])
+			var shared []int
+			if c.Threshold < 0 {
+				for j := range topics {
+					shared = append(shared, j)
+				}
+			} else {
+				shared = index.Candidates(vec)
+			}
+			for _, j := range shared {
+				cosSim := index.Cosine(j, vec)
+				if c.Threshold < cosSim {
+					candidates = append(candidates, candidate{idx: j, cosSim: cosSim})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].cosSim > candidates[j].cosSim })
+		highestSim := candidate{idx: -1}
+		var violation entropyViolation
+		for i, v := range candidates {
+			check := c.Constraint.Check(topics[v.idx], inData)
+			if check.ok {
+				highestSim = v
+				break
+			}
+			if i == 0 {
+				violation = check
+			}
+		}
+		if highestSim.idx == -1 {
+			topics = append(topics, pipeline.NewTopic(event.Id, inData, vectors[event.Id]))
+			if !c.Scan {
+				index.Add(topics[len(topics)-1].CenterGravity)
+			}
+		} else {
+			topics[highestSim.idx].DocIds[event.Id] = inData
+			if c.Decay > 0 {
+				topics[highestSim.idx].CulcCenterOfGravityDecay(vectors[event.Id], c.Decay)
+			} else {
+				topics[highestSim.idx].CulcCenterOfGravity(vectors[event.Id])
+			}
+			if !c.Scan {
+				index.Update(highestSim.idx, topics[highestSim.idx].CenterGravity)
+			}
+		}
+		// 最も類似したトピックに加えなかった場合は、その理由を記録する
+		if len(candidates) == 0 || highestSim.idx == candidates[0].idx {
+			continue
+		}
+		rejection := pipeline.Rejection{
+			EventId:            event.Id,
+			Date:               event.Date,
+			Entropy:            event.Entropy,
+			Topic:              candidates[0].idx + 1,
+			Similarity:         candidates[0].cosSim,
+			AssignedTopic:      len(topics),
+			AssignedSimilarity: highestSim.cosSim,
+			Slope:              violation.slope,
+			Reason:             violation.reason,
+		}
+		if highestSim.idx != -1 {
+			rejection.AssignedTopic = highestSim.idx + 1
+		}
+		if !violation.date.IsZero() {
+			rejection.ConflictDate = violation.date.Format("2006-01-02")
+			rejection.ConflictEntropy = violation.mean
+		}
+		rejections.Rejections = append(rejections.Rejections, rejection)
+	}
+	// 作った順の番号を、分類を終えたトピックの最も小さいイベントのIDに置き換える（refine.jsonと同じ表し方）
+	for i, v := range rejections.Rejections {
+		rejections.Rejections[i].Topic = topicKey(topics[v.Topic-1])
+		rejections.Rejections[i].AssignedTopic = topicKey(topics[v.AssignedTopic-1])
+	}
+	return topics, rejections, nil
+}
+
+// Agglomerativeは全てのイベントを別のトピックとして始め、最も類似した二つのトピックをまとめることを繰り返す。
+// トピック間の類似度は、averageでは含まれるイベントの組みの類似度の平均、completeでは最小値とする。
+// 最も類似した二つのトピックの類似度が閾値以下になったら終わる。
+// 全てのイベントの組みの類似度を持つため、イベントはMaxMatrixEventsまでとする。
+type Agglomerative struct {
+	Threshold float64
+	Linkage   string
+}
+
+func (Agglomerative) Name() string { return "agglomerative" }
+
+func (c Agglomerative) Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error) {
+	n := len(d.Events)
+	sims, err := similarityMatrix(d, vectors)
+	if err != nil {
+		return nil, err
+	}
+	size := make([]int, n)
+	members := make([][]int, n)
+	active := make([]bool, n)
+	for i := range size {
+		size[i] = 1
+		members[i] = []int{i}
+		active[i] = true
+	}
+	// 各トピックの最も類似したトピック（前から順に探し、同じ類似度の場合は前のものにする）
+	best := make([]int, n)
+	bestSim := make([]float64, n)
+	findBest := func(i int) {
+		best[i], bestSim[i] = -1, math.Inf(-1)
+		for k := 0; k < n; k++ {
+			if k != i && active[k] && sims[i][k] > bestSim[i] {
+				best[i], bestSim[i] = k, sims[i][k]
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		findBest(i)
+	}
+	for {
+		i := -1
+		for k := 0; k < n; k++ {
+			if active[k] && best[k] != -1 && (i == -1 || bestSim[k] > bestSim[i]) {
+				i = k
+			}
+		}
+		if i == -1 || bestSim[i] <= c.Threshold {
+			break
+		}
+		j := best[i]
+		// jをiにまとめ、他のトピックとの類似度を更新する（Lance-Williamsの式）
+		for k := 0; k < n; k++ {
+			if !active[k] || k == i || k == j {
+				continue
+			}
+			var s float64
+			if c.Linkage == "complete" {
+				s = math.Min(sims[i][k], sims[j][k])
+			} else {
+				s = (float64(size[i])*sims[i][k] + float64(size[j])*sims[j][k]) / float64(size[i]+size[j])
+			}
+			sims[i][k], sims[k][i] = s, s
+		}
+		size[i] += size[j]
+		members[i] = append(members[i], members[j]...)
+		active[j] = false
+		for k := 0; k < n; k++ {
+			if !active[k] {
+				continue
+			}
+			if k == i || best[k] == i || best[k] == j {
+				findBest(k)
+			} else if sims[k][i] > bestSim[k] {
+				best[k], bestSim[k] = i, sims[k][i]
+			}
+		}
+	}
+	var groups [][]int
+	for i := 0; i < n; i++ {
+		if active[i] {
+			groups = append(groups, members[i])
+		}
+	}
+	return topicsFromGroups(d, vectors, groups)
+}
+
+// DBSCANはコサイン距離がEps以下のイベントを近傍とし、近傍の多いイベント（コア）からつながるイベントを一つのトピックにする。
+// どのコアともつながらないイベント（ノイズ）は、それぞれ一つのイベントだけのトピックにする。
+// 全てのイベントの組みの類似度を持つため、イベントはMaxMatrixEventsまでとする。
+type DBSCAN struct {
+	Eps       float64
+	MinPoints int
+}
+
+func (DBSCAN) Name() string { return "dbscan" }
+
+func (c DBSCAN) Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error) {
+	n := len(d.Events)
+	sims, err := similarityMatrix(d, vectors)
+	if err != nil {
+		return nil, err
+	}
+	neighbors := make([][]int, n)
+	for i := 0; i < n; i++ {
+		for k := 0; k < n; k++ {
+			if k != i && 1-sims[i][k] <= c.Eps {
+				neighbors[i] = append(neighbors[i], k)
+			}
+		}
+	}
+	isCore := func(i int) bool { return len(neighbors[i])+1 >= c.MinPoints }
+	label := make([]int, n)
+	for i := range label {
+		label[i] = -1
+	}
+	var groups [][]int
+	for i := 0; i < n; i++ {
+		if label[i] != -1 || !isCore(i) {
+			continue
+		}
+		g := len(groups)
+		groups = append(groups, []int{i})
+		label[i] = g
+		queue := []int{i}
+		for len(queue) > 0 {
+			p := queue[0]
+			queue = queue[1:]
+			for _, k := range neighbors[p] {
+				if label[k] != -1 {
+					continue
+				}
+				label[k] = g
+				groups[g] = append(groups[g], k)
+				// コアの近傍はさらに広げ、コアでないもの（境界）はトピックに含めるだけにする
+				if isCore(k) {
+					queue = append(queue, k)
+				}
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		if label[i] == -1 {
+			groups = append(groups, []int{i})
+		}
+	}
+	return topicsFromGroups(d, vectors, groups)
+}
+
+// KMeansは長さを1にしたベクトルをK個のトピックに分ける（コサイン類似度を用いるk-means）。
+// 初期の重心はk-means++で選ぶ。Kが0の場合は、イベントの数nからsqrt(n/2)とする。
+// MaxIterが1未満の場合も、イベントを初期の重心に一度は割り当てる。
+type KMeans struct {
+	K       int
+	MaxIter int
+	Seed    int64
+}
+
+func (KMeans) Name() string { return "kmeans" }
+
+func (c KMeans) Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error) {
+	n := len(d.Events)
+	if n == 0 {
+		return nil, nil
+	}
+	k := c.K
+	if k <= 0 {
+		k = int(math.Sqrt(float64(n) / 2))
+	}
+	if k < 1 {
+		k = 1
+	}
+	if k > n {
+		k = n
+	}
+	points := make([]map[string]float64, n)
+	for i, e := range d.Events {
+		points[i] = normalizedCopy(vectors[e.Id])
+	}
+	rnd := rand.New(rand.NewSource(c.Seed))
+	// k-means++：既に選んだ重心から遠いイベントほど選ばれやすくする
+	centers := []map[string]float64{points[rnd.Intn(n)]}
+	dist := make([]float64, n)
+	for len(centers) < k {
+		var total float64
+		for i, p := range points {
+			dist[i] = math.Inf(1)
+			for _, center := range centers {
+				dist[i] = math.Min(dist[i], 1-dot(p, center))
+			}
+			dist[i] = math.Max(dist[i], 0)
+			total += dist[i]
+		}
+		next := rnd.Intn(n)
+		if total > 0 {
+			r := rnd.Float64() * total
+			for i, v := range dist {
+				r -= v
+				if r <= 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centers = append(centers, points[next])
+	}
+	assign := make([]int, n)
+	for i := range assign {
+		assign[i] = -1
+	}
+	for iter := 0; iter == 0 || iter < c.MaxIter; iter++ {
+		changed := false
+		for i, p := range points {
+			bestK, bestSim := 0, math.Inf(-1)
+			for j, center := range centers {
+				if s := dot(p, center); s > bestSim {
+					bestK, bestSim = j, s
+				}
+			}
+			if assign[i] != bestK {
+				assign[i] = bestK
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([]map[string]float64, k)
+		for j := range sums {
+			sums[j] = make(map[string]float64)
+		}
+		for i, p := range points {
+			for key, v := range p {
+				sums[assign[i]][key] += v
+			}
+		}
+		for j := range centers {
+			// イベントが一つもないトピックは、重心をそのままにする
+			if len(sums[j]) > 0 {
+				centers[j] = normalize(sums[j])
+			}
+		}
+	}
+	groups := make([][]int, k)
+	for i, j := range assign {
+		groups[j] = append(groups[j], i)
+	}
+	return topicsFromGroups(d, vectors, groups)
+}
+
+// MaxMatrixEventsは、全てのイベントの組みの類似度を持つ分類方法（agglomerative、dbscan）で扱えるイベントの数の上限。
+// 類似度はn×nのfloat64で持つため、10000件で約800MBになる（一年分のイベントを分類する場合はsingle-passかkmeansを用いる）。
+var MaxMatrixEvents = 10000
+
+// similarityMatrixは全てのイベントの組みのコサイン類似度を計算する（添字はd.Eventsの順番）。
+// イベントがMaxMatrixEventsを超える場合は、計算せずにエラーを戻す。
+func similarityMatrix(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([][]float64, error) {
+	n := len(d.Events)
+	if n > MaxMatrixEvents {
+		return nil, fmt.Errorf("%d events exceed the limit of %d for the similarity matrix (about %d MB), use single-pass or kmeans", n, MaxMatrixEvents, n*n*8>>20)
+	}
+	points := make([]map[string]float64, n)
+	for i, e := range d.Events {
+		points[i] = normalizedCopy(vectors[e.Id])
+	}
+	sims := make([][]float64, n)
+	for i := range sims {
+		sims[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		sims[i][i] = 1
+		for k := i + 1; k < n; k++ {
+			s := dot(points[i], points[k])
+			sims[i][k], sims[k][i] = s, s
+		}
+	}
+	return sims, nil
+}
+
+// topicsFromGroupsはイベントの添字のまとまりからトピックを作る。
+// トピックの重心は含まれるイベントのベクトルの平均とし、トピックはd.Eventsで最初に現れるイベントの順に並べる。
+func topicsFromGroups(d pipeline.EventsDataJSON, vectors map[int]map[string]float64, groups [][]int) ([]pipeline.Topic, error) {
+	for _, g := range groups {
+		sort.Ints(g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i]) == 0 || len(groups[j]) == 0 {
+			return len(groups[i]) > len(groups[j])
+		}
+		return groups[i][0] < groups[j][0]
+	})
+	var topics []pipeline.Topic
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		var topic pipeline.Topic
+		for j, idx := range g {
+			e := d.Events[idx]
+			date, err := time.Parse("2006-01-02", e.Date)
+			if err != nil {
+				return nil, err
+			}
+			doc := pipeline.Document{Date: date, Entropy: e.Entropy}
+			if j == 0 {
+				topic = pipeline.NewTopic(e.Id, doc, vectors[e.Id])
+				continue
+			}
+			topic.DocIds[e.Id] = doc
+			topic.CulcCenterOfGravity(vectors[e.Id])
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
+
+// normalizedCopyは長さを1にしたベクトルを新しく作って戻す
+func normalizedCopy(vec map[string]float64) map[string]float64 {
+	c := make(map[string]float64, len(vec))
+	for k, v := range vec {
+		c[k] = v
+	}
+	return normalize(c)
+}
+
+// dotは二つのベクトルの内積を計算する
+func dot(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var s float64
+	for k, v := range a {
+		s += v * b[k]
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// clusterEventsはベクトルごとに、ID順に一日ずつずらしたイベントを作る（IDは1から）
+func clusterEvents(vecs ...map[string]float64) (pipeline.EventsDataJSON, map[int]map[string]float64) {
+	d := pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion}
+	vectors := make(map[int]map[string]float64)
+	for i, vec := range vecs {
+		id := i + 1
+		d.Events = append(d.Events, pipeline.EventData{Id: id, Date: fmt.Sprintf("2022-01-%02d", id), Entropy: 1})
+		vectors[id] = vec
+	}
+	return d, vectors
+}
+
+// partitionは全てのイベントがちょうど一つのトピックに含まれることを確かめ、トピックごとのイベントのIDを戻す
+func partition(t *testing.T, d pipeline.EventsDataJSON, topics []pipeline.Topic) [][]int {
+	t.Helper()
+	seen := make(map[int]int)
+	var groups [][]int
+	for _, topic := range topics {
+		var g []int
+		for id := range topic.DocIds {
+			seen[id]++
+			g = append(g, id)
+		}
+		sort.Ints(g)
+		groups = append(groups, g)
+	}
+	for _, e := range d.Events {
+		if seen[e.Id] != 1 {
+			t.Errorf("event %d is in %d topics, want 1", e.Id, seen[e.Id])
+		}
+	}
+	if len(seen) != len(d.Events) {
+		t.Errorf("topics have %d events, want %d", len(seen), len(d.Events))
+	}
+	return groups
+}
+
+// chainEventsは、1と2、2と3が似ていて（0.707）1と3が似ていない三つのイベントと、よく似た二つのイベント（4と5）
+func chainEvents() (pipeline.EventsDataJSON, map[int]map[string]float64) {
+	return clusterEvents(
+		map[string]float64{"x": 1},
+		map[string]float64{"x": 1, "y": 1},
+		map[string]float64{"y": 1},
+		map[string]float64{"z": 1},
+		map[string]float64{"z": 1, "w": 0.1},
+	)
+}
+
+func TestAgglomerative(t *testing.T) {
+	tests := []struct {
+		linkage string
+		want    [][]int
+	}{
+		// {1,2}と3の平均は0.354で閾値を超える
+		{"average", [][]int{{1, 2, 3}, {4, 5}}},
+		// {1,2}と3の最小値は0
+		{"complete", [][]int{{1, 2}, {3}, {4, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.linkage, func(t *testing.T) {
+			d, vectors := chainEvents()
+			c, err := NewClusterer("agglomerative", ClusterOption{Threshold: 0.3, Linkage: tt.linkage})
+			if err != nil {
+				t.Fatal(err)
+			}
+			topics, err := c.Cluster(d, vectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := partition(t, d, topics); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDBSCAN(t *testing.T) {
+	tests := []struct {
+		name      string
+		minPoints int
+		want      [][]int
+	}{
+		{"every event is a core", 2, [][]int{{1, 2, 3}, {4, 5}}},
+		// 2だけがコアで、1と3は境界、4と5はノイズ
+		{"border and noise", 3, [][]int{{1, 2, 3}, {4}, {5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, vectors := chainEvents()
+			topics, err := DBSCAN{Eps: 0.35, MinPoints: tt.minPoints}.Cluster(d, vectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := partition(t, d, topics); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKMeans(t *testing.T) {
+	d, vectors := clusterEvents(
+		map[string]float64{"x": 1},
+		map[string]float64{"x": 1, "y": 0.2},
+		map[string]float64{"x": 0.9, "y": 0.1},
+		map[string]float64{"z": 1},
+		map[string]float64{"z": 1, "w": 0.2},
+	)
+	want := [][]int{{1, 2, 3}, {4, 5}}
+	for _, c := range []KMeans{
+		{K: 2, MaxIter: 50, Seed: 1},
+		{K: 2, MaxIter: 50, Seed: 2},
+		{K: 2, MaxIter: 50, Seed: 3},
+		// MaxIterが0（ゼロ値）でも一度は割り当てる
+		{K: 2},
+	} {
+		t.Run(fmt.Sprintf("seed %d, max iter %d", c.Seed, c.MaxIter), func(t *testing.T) {
+			topics, err := c.Cluster(d, vectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := partition(t, d, topics); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSimilarityMatrixLimit(t *testing.T) {
+	limit := MaxMatrixEvents
+	MaxMatrixEvents = 4
+	defer func() { MaxMatrixEvents = limit }()
+	d, vectors := chainEvents()
+	for _, c := range []Clusterer{Agglomerative{Threshold: 0.3, Linkage: "average"}, DBSCAN{Eps: 0.35, MinPoints: 2}} {
+		if _, err := c.Cluster(d, vectors); err == nil {
+			t.Errorf("%s: no error for %d events with the limit of %d", c.Name(), len(d.Events), MaxMatrixEvents)
+		}
+	}
+}
+
+func TestSinglePassRejectionTopics(t *testing.T) {
+	// 10でトピックを作り、5は制約に違反するため新しいトピックにし、3は10のトピックに加える
+	d := pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion, Events: []pipeline.EventData{
+		{Id: 10, Date: "2022-01-10", Entropy: 1},
+		{Id: 5, Date: "2022-01-05", Entropy: 5},
+		{Id: 3, Date: "2022-01-03", Entropy: 0.5},
+	}}
+	vectors := map[int]map[string]float64{10: {"x": 1}, 5: {"x": 1}, 3: {"x": 1}}
+	topics, rejections, err := SinglePass{Threshold: 0.35, Constraint: DefaultEntropyConstraint()}.Explain(d, vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := partition(t, d, topics), [][]int{{3, 10}, {5}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if len(rejections.Rejections) != 1 {
+		t.Fatalf("got %d rejections, want 1", len(rejections.Rejections))
+	}
+	// トピックは作った順の番号ではなく、最も小さいイベントのIDで表す
+	r := rejections.Rejections[0]
+	if r.EventId != 5 || r.Topic != 3 || r.AssignedTopic != 5 {
+		t.Errorf("event %d: topic %d, assigned %d, want event 5: topic 3, assigned 5", r.EventId, r.Topic, r.AssignedTopic)
+	}
+	rejections.SchemaVersion = pipeline.RejectionsSchemaVersion
+	if err := rejections.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,162 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 情報エントロピーが時間と共に増大するという制約の確かめ方
+const (
+	// 前の日の平均は全て加えるイベント以下、後の日の平均は全て加えるイベント以上とする（これまでの制約）
+	ConstraintStrict = "strict"
+	// strictと同じだが、Epsilonまでの違反は認める
+	ConstraintTolerance = "tolerance"
+	// イベントを加えた場合の、日ごとの平均の回帰直線の傾きが-Epsilon以上とする
+	ConstraintTrend = "trend"
+	// 制約を確かめない
+	ConstraintOff = "off"
+)
+
+// ConstraintNamesはEntropyConstraintで指定できる名前
+var ConstraintNames = []string{ConstraintStrict, ConstraintTolerance, ConstraintTrend, ConstraintOff}
+
+// EntropyConstraintは、トピックにイベントを加えても情報エントロピーが時間と共に増大するかどうかを確かめる。
+// 日ごとの情報エントロピーは、その日のイベントの平均とする。Modeが空の場合はstrictとする。
+type EntropyConstraint struct {
+	Mode string
+	// toleranceで認める違反の幅と、trendで認める1日あたりの減少の幅
+	Epsilon float64
+}
+
+func DefaultEntropyConstraint() EntropyConstraint {
+	return EntropyConstraint{Mode: ConstraintStrict, Epsilon: 0.1}
+}
+
+// Validateは制約の確かめ方が指定できるものかどうかを確認する
+func (c EntropyConstraint) Validate() error {
+	if c.Epsilon < 0 {
+		return fmt.Errorf("entropy epsilon must not be negative: %v", c.Epsilon)
+	}
+	if c.Mode == "" {
+		return nil
+	}
+	for _, v := range ConstraintNames {
+		if v == c.Mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown entropy constraint: %s (%s)", c.Mode, strings.Join(ConstraintNames, ", "))
+}
+
+// entropyViolationは制約に違反した理由（Checkで違反しなかった場合はokがtrue）
+type entropyViolation struct {
+	ok     bool
+	date   time.Time
+	mean   float64
+	slope  float64
+	reason string
+}
+
+// dayMeanは一日の情報エントロピーの平均
+type dayMean struct {
+	date time.Time
+	mean float64
+}
+
+// dailyMeansはトピックのイベントの情報エントロピーを日ごとに平均し、日付の順に並べて戻す
+func dailyMeans(docs map[int]pipeline.Document) []dayMean {
+	sums := make(map[time.Time]float64)
+	counts := make(map[time.Time]int)
+	for _, doc := range docs {
+		sums[doc.Date] += doc.Entropy
+		counts[doc.Date]++
+	}
+	means := make([]dayMean, 0, len(sums))
+	for date, sum := range sums {
+		means = append(means, dayMean{date: date, mean: sum / float64(counts[date])})
+	}
+	sort.Slice(means, func(i, j int) bool { return means[i].date.Before(means[j].date) })
+	return means
+}
+
+// Checkはトピックにinを加えても制約を満たすかどうかを確かめ、満たさない場合はその理由を戻す
+func (c EntropyConstraint) Check(topic pipeline.Topic, in pipeline.Document) entropyViolation {
+	switch c.Mode {
+	case ConstraintOff:
+		return entropyViolation{ok: true}
+	case ConstraintTrend:
+		return c.checkTrend(topic, in)
+	case ConstraintTolerance:
+		return c.checkOrder(topic, in, c.Epsilon)
+	}
+	return c.checkOrder(topic, in, 0)
+}
+
+// checkOrderは、前の日の平均がinよりepsilonを超えて高い日と、後の日の平均がinよりepsilonを超えて低い日がないかを確かめる。
+// 違反した日が複数ある場合は、違反の幅が最も大きい日を理由とする。
+func (c EntropyConstraint) checkOrder(topic pipeline.Topic, in pipeline.Document, epsilon float64) entropyViolation {
+	v := entropyViolation{ok: true}
+	worst := epsilon
+	for _, day := range dailyMeans(topic.DocIds) {
+		var diff float64
+		var relation string
+		switch {
+		case day.date.Before(in.Date):
+			diff, relation = day.mean-in.Entropy, "higher"
+		case in.Date.Before(day.date):
+			diff, relation = in.Entropy-day.mean, "lower"
+		default:
+			continue
+		}
+		if diff > worst {
+			worst = diff
+			v = entropyViolation{
+				date: day.date,
+				mean: day.mean,
+				reason: fmt.Sprintf("mean entropy %.4f on %s is %s than %.4f on %s (by %.4f, allowed %.4f)",
+					day.mean, day.date.Format("2006-01-02"), relation, in.Entropy, in.Date.Format("2006-01-02"), diff, epsilon),
+			}
+		}
+	}
+	return v
+}
+
+// checkTrendは、inを加えた場合の日ごとの平均に最小二乗法で直線を当てはめ、傾きが-Epsilon以上かどうかを確かめる。
+// 日が二つ未満の場合は傾きが求まらないため、満たすとする。
+func (c EntropyConstraint) checkTrend(topic pipeline.Topic, in pipeline.Document) entropyViolation {
+	docs := make(map[int]pipeline.Document, len(topic.DocIds)+1)
+	for id, doc := range topic.DocIds {
+		docs[id] = doc
+	}
+	// inのIDは使わないため、トピックのIDと重ならない負の値にする
+	docs[-1] = in
+	means := dailyMeans(docs)
+	if len(means) < 2 {
+		return entropyViolation{ok: true}
+	}
+	var sumX, sumY float64
+	xs := make([]float64, len(means))
+	for i, day := range means {
+		xs[i] = day.date.Sub(means[0].date).Hours() / 24
+		sumX += xs[i]
+		sumY += day.mean
+	}
+	n := float64(len(means))
+	meanX, meanY := sumX/n, sumY/n
+	var cov, varX float64
+	for i, day := range means {
+		cov += (xs[i] - meanX) * (day.mean - meanY)
+		varX += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	slope := cov / varX
+	if slope >= -c.Epsilon {
+		return entropyViolation{ok: true, slope: slope}
+	}
+	return entropyViolation{
+		slope:  slope,
+		reason: fmt.Sprintf("entropy trend over %d days falls by %.4f per day (allowed %.4f)", len(means), -slope, c.Epsilon),
+	}
+}
@@ -0,0 +1,104 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"testing"
+	"time"
+)
+
+// constraintCaseはトピックの日ごとのイベントの情報エントロピーと、加えるイベントの日付と情報エントロピーから、加えられるかどうかを決める例
+type constraintCase struct {
+	name    string
+	days    map[string][]float64
+	date    string
+	entropy float64
+	want    bool
+}
+
+// checkConstraintCasesは各例をmodeの制約（Epsilonは0.1）で確かめる
+func checkConstraintCases(t *testing.T, mode string, cases []constraintCase) {
+	t.Helper()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			topic := pipeline.Topic{DocIds: make(map[int]pipeline.Document)}
+			id := 0
+			for day, entropies := range c.days {
+				for _, e := range entropies {
+					id++
+					topic.DocIds[id] = pipeline.Document{Date: mustDate(t, day), Entropy: e}
+				}
+			}
+			constraint := EntropyConstraint{Mode: mode, Epsilon: 0.1}
+			got := constraint.Check(topic, pipeline.Document{Date: mustDate(t, c.date), Entropy: c.entropy})
+			if got.ok != c.want {
+				t.Errorf("ok = %v, want %v (%s)", got.ok, c.want, got.reason)
+			}
+			if !got.ok && got.reason == "" {
+				t.Error("rejected without a reason")
+			}
+		})
+	}
+}
+
+func mustDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// 日ごとの平均は2.0、1.5と下がっていく
+var fallingTopic = pipeline.Topic{DocIds: map[int]pipeline.Document{
+	1: {Date: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC), Entropy: 2},
+	2: {Date: time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC), Entropy: 1.5},
+}}
+
+func TestEntropyConstraint(t *testing.T) {
+	t.Run(ConstraintStrict, func(t *testing.T) {
+		checkConstraintCases(t, ConstraintStrict, []constraintCase{
+			// 3月1日の平均は2（(1+1)/2と4の平均の2.5ではない）
+			{"uses the true mean", map[string][]float64{"2022-03-01": {1, 1, 4}}, "2022-03-05", 2.2, true},
+			{"rejects a lower entropy", map[string][]float64{"2022-03-01": {1, 1, 4}}, "2022-03-05", 1.95, false},
+			{"rejects a higher entropy before", map[string][]float64{"2022-03-05": {2}}, "2022-03-01", 2.05, false},
+			{"ignores the same day", map[string][]float64{"2022-03-05": {3}}, "2022-03-05", 1, true},
+		})
+		// 違反した場合は、最も大きく違反した日とその日の平均を戻す
+		got := EntropyConstraint{Mode: ConstraintStrict}.Check(fallingTopic, pipeline.Document{Date: time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC), Entropy: 1})
+		if got.ok || got.date.Day() != 1 || got.mean != 2 {
+			t.Errorf("conflict = %s %v, want the largest violation on 2022-03-01 with mean 2", got.date.Format("2006-01-02"), got.mean)
+		}
+	})
+	t.Run("empty mode is strict", func(t *testing.T) {
+		checkConstraintCases(t, "", []constraintCase{
+			{"rejects a lower entropy", map[string][]float64{"2022-03-01": {1, 1, 4}}, "2022-03-05", 1.95, false},
+		})
+	})
+	t.Run(ConstraintTolerance, func(t *testing.T) {
+		checkConstraintCases(t, ConstraintTolerance, []constraintCase{
+			{"accepts within epsilon", map[string][]float64{"2022-03-01": {1, 1, 4}}, "2022-03-05", 1.95, true},
+			{"rejects beyond epsilon", map[string][]float64{"2022-03-01": {1, 1, 4}}, "2022-03-05", 1.85, false},
+		})
+	})
+	t.Run(ConstraintTrend, func(t *testing.T) {
+		checkConstraintCases(t, ConstraintTrend, []constraintCase{
+			// 日ごとの平均1、2と加える1.5の傾きは0.25
+			{"accepts a rising slope", map[string][]float64{"2022-03-01": {1}, "2022-03-02": {2}}, "2022-03-03", 1.5, true},
+			// 日ごとの平均2、1.5と加える1の傾きは-0.5
+			{"rejects a falling slope", map[string][]float64{"2022-03-01": {2}, "2022-03-02": {1.5}}, "2022-03-03", 1, false},
+			{"accepts a single day", map[string][]float64{"2022-03-01": {3}}, "2022-03-01", 1, true},
+		})
+		got := EntropyConstraint{Mode: ConstraintTrend}.Check(fallingTopic, pipeline.Document{Date: time.Date(2022, 3, 3, 0, 0, 0, 0, time.UTC), Entropy: 1})
+		if math.Abs(got.slope+0.5) > 1e-12 {
+			t.Errorf("slope = %v, want -0.5", got.slope)
+		}
+	})
+	t.Run(ConstraintOff, func(t *testing.T) {
+		checkConstraintCases(t, ConstraintOff, []constraintCase{
+			{"accepts a lower entropy", map[string][]float64{"2022-03-01": {3}}, "2022-03-05", 1, true},
+			{"accepts a higher entropy before", map[string][]float64{"2022-03-05": {1}}, "2022-03-01", 3, true},
+		})
+	})
+}
@@ -0,0 +1,419 @@
+package analysis
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Embedderはイベントの密なベクトル（埋め込み）を用意する。
+// TF-IDFでは言い換えられた同じ話題のイベントを見落とすため、文の意味を表すベクトルを外で作って読み込む。
+// 戻り値のキーはイベントのIDで、全てのベクトルは同じ次元数にする。
+type Embedder interface {
+	Name() string
+	Embed(d pipeline.EventsDataJSON) (map[int][]float64, error)
+}
+
+// NewEmbedderは指定に対応するEmbedderを戻す。
+// 「http://」か「https://」で始まる場合はそのURLのAPIを、それ以外はファイル（.jsonlか.npy）を用いる。
+func NewEmbedder(spec string) (Embedder, error) {
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return NewHTTPEmbedder(spec), nil
+	}
+	switch strings.ToLower(filepath.Ext(spec)) {
+	case ".jsonl", ".npy":
+		return FileEmbedder{Path: spec}, nil
+	}
+	return nil, fmt.Errorf("unknown embeddings: %s (a .jsonl or .npy file, or an http url)", spec)
+}
+
+// EmbeddingsKeyは埋め込みの指定を表す文字列を戻す（再実行の判定に用いる）。
+// ファイルの場合は、同じ名前のまま書き換えた場合も別の指定として扱うように、内容（.npyでは.idsも）のハッシュ値を含める。
+// APIの場合は、モデルを変えても分からないためURLだけを戻す。
+func EmbeddingsKey(spec string) string {
+	if spec == "" || strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return spec
+	}
+	paths := []string{spec}
+	if strings.ToLower(filepath.Ext(spec)) == ".npy" {
+		paths = append(paths, npyIdsPath(spec))
+	}
+	h := sha256.New()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return spec
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return spec
+		}
+	}
+	return fmt.Sprintf("%s sha256=%s", spec, hex.EncodeToString(h.Sum(nil)))
+}
+
+// NewEmbeddingVectorizerは、指定（NewEmbedderと同じ）の埋め込みを用いるVectorizerを戻す
+func NewEmbeddingVectorizer(spec string) (Vectorizer, error) {
+	e, err := NewEmbedder(spec)
+	if err != nil {
+		return nil, err
+	}
+	return EmbeddingVectorizer{Embedder: e}, nil
+}
+
+// EmbeddingVectorizerはEmbedderの埋め込みを、トピックの分類や似たイベントの検索で用いるベクトルにする。
+// 次元の番号を特徴量の名前とし、0の値は除く（LSIと同じ形）。
+type EmbeddingVectorizer struct {
+	Embedder Embedder
+}
+
+func (v EmbeddingVectorizer) Name() string { return "embedding:" + v.Embedder.Name() }
+
+func (v EmbeddingVectorizer) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	embeddings, err := v.Embedder.Embed(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEmbeddings(d, embeddings); err != nil {
+		return nil, err
+	}
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	for _, e := range d.Events {
+		vec := make(map[string]float64)
+		for i, x := range embeddings[e.Id] {
+			if x != 0 {
+				vec[strconv.Itoa(i)] = x
+			}
+		}
+		vectors[e.Id] = vec
+	}
+	return vectors, nil
+}
+
+// checkEmbeddingsは全てのイベントに埋め込みがあり、次元数が揃っていて、値が有限かどうかを確認する
+func checkEmbeddings(d pipeline.EventsDataJSON, embeddings map[int][]float64) error {
+	dim := -1
+	var missing []int
+	for _, e := range d.Events {
+		vec, found := embeddings[e.Id]
+		if !found {
+			missing = append(missing, e.Id)
+			continue
+		}
+		if dim == -1 {
+			dim = len(vec)
+		}
+		if len(vec) != dim {
+			return fmt.Errorf("embedding of event %d has %d dimensions (want %d)", e.Id, len(vec), dim)
+		}
+		for _, x := range vec {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				return fmt.Errorf("embedding of event %d is not finite", e.Id)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no embeddings for %d events (e.g. %d)", len(missing), missing[0])
+	}
+	return nil
+}
+
+// FileEmbedderは前もって計算した埋め込みをファイルから読み込む。
+//
+//	.jsonl：1行に1イベント（{"id": 123, "embedding": [0.1, ...]}）
+//	.npy：イベント×次元の行列（float32かfloat64、C順）。行に対応するイベントのIDは、同じ名前の.idsファイルに1行に1つ書く
+type FileEmbedder struct {
+	Path string
+}
+
+func (f FileEmbedder) Name() string { return filepath.Base(f.Path) }
+
+func (f FileEmbedder) Embed(d pipeline.EventsDataJSON) (map[int][]float64, error) {
+	if strings.ToLower(filepath.Ext(f.Path)) == ".npy" {
+		return ReadEmbeddingsNpy(f.Path)
+	}
+	return ReadEmbeddingsJsonl(f.Path)
+}
+
+// EmbeddingLineは.jsonlの1行
+type EmbeddingLine struct {
+	Id        int       `json:"id"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// ReadEmbeddingsJsonlは.jsonlのファイルから埋め込みを読み込む
+func ReadEmbeddingsJsonl(path string) (map[int][]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	embeddings := make(map[int][]float64)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var v EmbeddingLine
+		if err := json.Unmarshal(line, &v); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		if _, found := embeddings[v.Id]; found {
+			return nil, fmt.Errorf("%s:%d: duplicate id %d", path, n, v.Id)
+		}
+		embeddings[v.Id] = v.Embedding
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return embeddings, nil
+}
+
+// WriteEmbeddingsJsonlは埋め込みをIDの順に.jsonlのファイルに書き込む
+func WriteEmbeddingsJsonl(path string, embeddings map[int][]float64) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, id := range embeddingIds(embeddings) {
+		if err := enc.Encode(EmbeddingLine{Id: id, Embedding: embeddings[id]}); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// npyIdsPathは.npyのファイルに対応する、IDを書いたファイルのパスを戻す
+func npyIdsPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".ids"
+}
+
+var npyHeaderPattern = regexp.MustCompile(`'descr':\s*'([<|]f[48])'.*'fortran_order':\s*(True|False).*'shape':\s*\((\d+),\s*(\d+)\)`)
+
+// ReadEmbeddingsNpyは.npyのファイル（numpy.saveで書いた2次元の行列）と.idsのファイルから埋め込みを読み込む
+func ReadEmbeddingsNpy(path string) (map[int][]float64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 10 || string(b[:6]) != "\x93NUMPY" {
+		return nil, fmt.Errorf("%s: not a npy file", path)
+	}
+	// バージョン1では2バイト、2と3では4バイトでヘッダーの長さを表す
+	var headerLen, offset int
+	switch b[6] {
+	case 1:
+		headerLen, offset = int(binary.LittleEndian.Uint16(b[8:10])), 10
+	case 2, 3:
+		if len(b) < 12 {
+			return nil, fmt.Errorf("%s: truncated header", path)
+		}
+		headerLen, offset = int(binary.LittleEndian.Uint32(b[8:12])), 12
+	default:
+		return nil, fmt.Errorf("%s: unsupported npy version %d", path, b[6])
+	}
+	if len(b) < offset+headerLen {
+		return nil, fmt.Errorf("%s: truncated header", path)
+	}
+	m := npyHeaderPattern.FindStringSubmatch(string(b[offset : offset+headerLen]))
+	if m == nil {
+		return nil, fmt.Errorf("%s: unsupported header (want a 2-d little-endian float32 or float64 array): %s", path, strings.TrimSpace(string(b[offset:offset+headerLen])))
+	}
+	if m[2] == "True" {
+		return nil, fmt.Errorf("%s: fortran order is not supported", path)
+	}
+	rows, _ := strconv.Atoi(m[3])
+	cols, _ := strconv.Atoi(m[4])
+	size := 4
+	if m[1][2] == '8' {
+		size = 8
+	}
+	data := b[offset+headerLen:]
+	if len(data) != rows*cols*size {
+		return nil, fmt.Errorf("%s: %d bytes of data for shape (%d, %d)", path, len(data), rows, cols)
+	}
+	ids, err := readIds(npyIdsPath(path))
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) != rows {
+		return nil, fmt.Errorf("%s: %d ids for %d rows", npyIdsPath(path), len(ids), rows)
+	}
+	embeddings := make(map[int][]float64, rows)
+	for r, id := range ids {
+		if _, found := embeddings[id]; found {
+			return nil, fmt.Errorf("%s: duplicate id %d", npyIdsPath(path), id)
+		}
+		vec := make([]float64, cols)
+		for c := range vec {
+			at := (r*cols + c) * size
+			if size == 4 {
+				vec[c] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[at:])))
+			} else {
+				vec[c] = math.Float64frombits(binary.LittleEndian.Uint64(data[at:]))
+			}
+		}
+		embeddings[id] = vec
+	}
+	return embeddings, nil
+}
+
+// WriteEmbeddingsNpyは埋め込みをIDの順にfloat32の.npyのファイルと.idsのファイルに書き込む（全て同じ次元数にする）
+func WriteEmbeddingsNpy(path string, embeddings map[int][]float64) error {
+	ids := embeddingIds(embeddings)
+	cols := 0
+	if len(ids) > 0 {
+		cols = len(embeddings[ids[0]])
+	}
+	header := fmt.Sprintf("{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", len(ids), cols)
+	// データの始まりを64バイトの境界に揃え、ヘッダーは改行で終える
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+	var buf bytes.Buffer
+	buf.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&buf, binary.LittleEndian, uint16(len(header)))
+	buf.WriteString(header)
+	var idLines strings.Builder
+	for _, id := range ids {
+		vec := embeddings[id]
+		if len(vec) != cols {
+			return fmt.Errorf("embedding of event %d has %d dimensions (want %d)", id, len(vec), cols)
+		}
+		for _, x := range vec {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(float32(x)))
+		}
+		fmt.Fprintln(&idLines, id)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(npyIdsPath(path), []byte(idLines.String()), 0644)
+}
+
+// readIdsは1行に1つのIDを書いたファイルを読み込む
+func readIds(path string) ([]int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		id, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n+1, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func embeddingIds(embeddings map[int][]float64) []int {
+	ids := make([]int, 0, len(embeddings))
+	for id := range embeddings {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// 埋め込みのAPIとのやり取りの定義
+//
+//	POST /embed   EmbedRequest → EmbedResponse
+//
+// 失敗した場合は、4xxか5xxのステータスと{"error": "..."}を戻す。
+const EmbedPath = "/embed"
+
+// EmbedRequestは埋め込みを求めるイベントのIDと本文
+type EmbedRequest struct {
+	Ids   []int    `json:"ids"`
+	Texts []string `json:"texts"`
+}
+
+// EmbedResponseは送った順の埋め込み
+type EmbedResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// HTTPEmbedderは手元で動かしている埋め込みのAPIに、イベントの本文をBatchSize件ずつ送って埋め込みを求める
+type HTTPEmbedder struct {
+	BaseUrl   string
+	BatchSize int
+	Timeout   time.Duration
+}
+
+// NewHTTPEmbedderは初期値のHTTPEmbedderを戻す
+func NewHTTPEmbedder(baseUrl string) HTTPEmbedder {
+	return HTTPEmbedder{BaseUrl: strings.TrimRight(baseUrl, "/"), BatchSize: 256, Timeout: 5 * time.Minute}
+}
+
+func (h HTTPEmbedder) Name() string { return h.BaseUrl }
+
+func (h HTTPEmbedder) Embed(d pipeline.EventsDataJSON) (map[int][]float64, error) {
+	client := &http.Client{Timeout: h.Timeout}
+	batch := h.BatchSize
+	if batch <= 0 {
+		batch = len(d.Events)
+	}
+	embeddings := make(map[int][]float64, len(d.Events))
+	for start := 0; start < len(d.Events); start += batch {
+		end := start + batch
+		if end > len(d.Events) {
+			end = len(d.Events)
+		}
+		var req EmbedRequest
+		for _, e := range d.Events[start:end] {
+			req.Ids = append(req.Ids, e.Id)
+			req.Texts = append(req.Texts, e.Text)
+		}
+		body, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Post(h.BaseUrl+EmbedPath, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("embedding api: %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
+		}
+		var out EmbedResponse
+		if err := json.Unmarshal(b, &out); err != nil {
+			return nil, fmt.Errorf("embedding api: %v", err)
+		}
+		if len(out.Embeddings) != len(req.Ids) {
+			return nil, fmt.Errorf("embedding api: got %d embeddings for %d events", len(out.Embeddings), len(req.Ids))
+		}
+		for i, id := range req.Ids {
+			embeddings[id] = out.Embeddings[i]
+		}
+	}
+	return embeddings, nil
+}
@@ -0,0 +1,157 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var embedEvents = pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion, Events: []pipeline.EventData{
+	{Id: 1, Date: "2022-03-02", Text: "Russian forces shell Kharkiv.", Entropy: 1},
+	{Id: 2, Date: "2022-03-01", Text: "Kharkiv is shelled by Russian forces.", Entropy: 1},
+	{Id: 3, Date: "2022-03-01", Text: "A magnitude 7.3 earthquake strikes off the coast of Fukushima.", Entropy: 1},
+	{Id: 4, Date: "2022-02-28", Text: "", Entropy: 1},
+}}
+
+// fixedEmbeddingsは、言い換えた1と2が似ていて、3と4はそれぞれ異なる埋め込み
+func fixedEmbeddings() map[int][]float64 {
+	return map[int][]float64{
+		1: {1, 0.25, 0},
+		2: {0.875, 0.375, 0},
+		3: {0, 0.125, 1},
+		4: {0.125, -1, 0.25},
+	}
+}
+
+// writeJsonlは埋め込みを一時ディレクトリのjsonlに書き、そのFileEmbedderを戻す
+func writeJsonl(t *testing.T, embeddings map[int][]float64) FileEmbedder {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "embeddings.jsonl")
+	if err := WriteEmbeddingsJsonl(path, embeddings); err != nil {
+		t.Fatal(err)
+	}
+	return FileEmbedder{Path: path}
+}
+
+func TestEmbeddingsFileRoundTrip(t *testing.T) {
+	embeddings := fixedEmbeddings()
+	// ファイルに書いて読み込んでも同じ埋め込みになる（.npyはfloat32のため誤差を認める）
+	for _, name := range []string{"embeddings.jsonl", "embeddings.npy"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			var err error
+			if name == "embeddings.npy" {
+				err = WriteEmbeddingsNpy(path, embeddings)
+			} else {
+				err = WriteEmbeddingsJsonl(path, embeddings)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := NewEmbedder(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.Embed(embedEvents)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(embeddings) {
+				t.Errorf("read %d embeddings, want %d", len(got), len(embeddings))
+			}
+			for id, want := range embeddings {
+				if len(got[id]) != len(want) {
+					t.Errorf("event %d has %d dimensions, want %d", id, len(got[id]), len(want))
+					continue
+				}
+				for i := range want {
+					if math.Abs(got[id][i]-want[i]) > 1e-6 {
+						t.Errorf("event %d differs at %d: %v, want %v", id, i, got[id][i], want[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddingVectorizer(t *testing.T) {
+	vectors, err := EmbeddingVectorizer{Embedder: writeJsonl(t, fixedEmbeddings())}.Vectorize(embedEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 次元の番号を特徴量の名前とし、0の値は除く
+	if want := map[string]float64{"0": 1, "1": 0.25}; !reflect.DeepEqual(vectors[1], want) {
+		t.Errorf("vectors[1] = %v, want %v", vectors[1], want)
+	}
+	if len(vectors) != len(embedEvents.Events) {
+		t.Errorf("got %d vectors, want %d", len(vectors), len(embedEvents.Events))
+	}
+}
+
+func TestEmbeddingVectorizerMissingEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(d *pipeline.EventsDataJSON, embeddings map[int][]float64)
+	}{
+		// 埋め込みがないイベントがある
+		{"missing event", func(d *pipeline.EventsDataJSON, embeddings map[int][]float64) {
+			d.Events = append(d.Events, pipeline.EventData{Id: 5, Date: "2022-03-01", Text: "x"})
+		}},
+		{"different dimensions", func(d *pipeline.EventsDataJSON, embeddings map[int][]float64) {
+			embeddings[3] = []float64{0, 1}
+		}},
+		{"not finite", func(d *pipeline.EventsDataJSON, embeddings map[int][]float64) {
+			embeddings[2][1] = math.Inf(1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := pipeline.EventsDataJSON{SchemaVersion: embedEvents.SchemaVersion, Events: append([]pipeline.EventData(nil), embedEvents.Events...)}
+			embeddings := fixedEmbeddings()
+			tt.change(&d, embeddings)
+			// jsonlには有限でない値を書けないため、ファイルを介さずに確かめる
+			if err := checkEmbeddings(d, embeddings); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+	missing := pipeline.EventsDataJSON{Events: append(append([]pipeline.EventData(nil), embedEvents.Events...), pipeline.EventData{Id: 5, Date: "2022-03-01", Text: "x"})}
+	if _, err := (EmbeddingVectorizer{Embedder: writeJsonl(t, fixedEmbeddings())}).Vectorize(missing); err == nil {
+		t.Error("missing embeddings: no error")
+	}
+}
+
+func TestEmbeddingsClassifyAndSearch(t *testing.T) {
+	vectors, err := EmbeddingVectorizer{Embedder: writeJsonl(t, fixedEmbeddings())}.Vectorize(embedEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 埋め込みで分類すると、言い換えた二つのイベントが同じトピックになる
+	together := false
+	for _, topic := range Classification(embedEvents, vectors, 0.35) {
+		_, has1 := topic.DocIds[1]
+		_, has2 := topic.DocIds[2]
+		_, has3 := topic.DocIds[3]
+		if has1 && has2 && !has3 {
+			together = true
+		}
+	}
+	if !together {
+		t.Error("classification with embeddings: events 1 and 2 are not in the same topic")
+	}
+
+	// 埋め込みの索引で似たイベントを探せる
+	index, err := NewLSHIndex(DefaultLSHOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.Add(embedEvents, vectors)
+	neighbors, err := index.SimilarExact(1, 1)
+	if err != nil || len(neighbors) != 1 || neighbors[0].Id != 2 {
+		t.Errorf("similar with embeddings: got %v %v, want event 2", neighbors, err)
+	}
+}
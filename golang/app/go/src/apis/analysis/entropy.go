@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"main/apis/util"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EntropyMethodは情報エントロピーの定義
+type EntropyMethod string
+
+const (
+	// EntropyTokensは本文の全てのトークンの分布のエントロピー。
+	// 本文に現れたエンティティは（複数の単語でも）一つのトークンとし、残りの単語もそれぞれトークンとする。
+	// 各トークンの確率は出現回数/トークンの総数で、確率の和は1になる。
+	EntropyTokens EntropyMethod = "tokens"
+	// EntropyEntitiesは本文に現れたエンティティの出現回数の分布のエントロピー
+	EntropyEntities EntropyMethod = "entities"
+	// EntropyNormalizedはEntropyEntitiesを、現れたエンティティの種類数での最大値で割ったもの（0から1）
+	EntropyNormalized EntropyMethod = "normalized"
+	// EntropyLegacyはこれまでの定義で、各エンティティの出現回数×単語数を本文の単語数で割った割合だけを足す。
+	// エンティティ以外の単語を足さないため確率の和が1にならないが、以前の結果と比べるために残している。
+	EntropyLegacy EntropyMethod = "legacy"
+)
+
+// EntropyMethodsは選べる情報エントロピーの定義の名前
+var EntropyMethods = []string{string(EntropyTokens), string(EntropyEntities), string(EntropyNormalized), string(EntropyLegacy)}
+
+// ParseEntropyMethodは名前から情報エントロピーの定義を戻す
+func ParseEntropyMethod(name string) (EntropyMethod, error) {
+	for _, v := range EntropyMethods {
+		if v == name {
+			return EntropyMethod(name), nil
+		}
+	}
+	return "", fmt.Errorf("unknown entropy: %s (%s)", name, strings.Join(EntropyMethods, ", "))
+}
+
+// 単語の区切りはTokenizeと同じだが、ストップワードやステミングは行わない
+var entropyWordPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// entropyWordsは記号を取り除き、小文字の単語に分ける（本文とエンティティで同じ分け方をする）
+func entropyWords(s string) []string {
+	return entropyWordPattern.FindAllString(strings.ToLower(util.CutRemoveWords(s)), -1)
+}
+
+// CountEntitiesは本文の単語の並びに、各エンティティの単語の並びが現れる回数を数える。
+// 単語の区切りで比べるため、「US」は「business」の中では数えない。重なった出現は数えない。
+// 大文字と小文字は区別せず、同じエンティティが複数ある場合は一つとして数える。
+// 本文の単語数も戻す。
+func CountEntities(text string, entities []string) (map[string]int, int) {
+	words := entropyWords(text)
+	counts := make(map[string]int)
+	for _, entity := range entities {
+		ew := entropyWords(entity)
+		if len(ew) == 0 {
+			continue
+		}
+		key := strings.Join(ew, " ")
+		if _, found := counts[key]; found {
+			continue
+		}
+		count := 0
+		for i := 0; i+len(ew) <= len(words); {
+			matched := true
+			for j, w := range ew {
+				if words[i+j] != w {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				count++
+				i += len(ew)
+			} else {
+				i++
+			}
+		}
+		counts[key] = count
+	}
+	return counts, len(words)
+}
+
+// CountTokensは本文をトークンに分け、トークンごとの出現回数とトークンの総数を戻す。
+// エンティティの単語の並びは一つのトークン（キーはCountEntitiesと同じ）とし、複数のエンティティが当てはまる場合は長いものを選ぶ。
+// 残りの単語はそれぞれ一つのトークンとする。
+func CountTokens(text string, entities []string) (map[string]int, int) {
+	words := entropyWords(text)
+	var patterns [][]string
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		ew := entropyWords(entity)
+		key := strings.Join(ew, " ")
+		if len(ew) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		patterns = append(patterns, ew)
+	}
+	sort.SliceStable(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	counts := make(map[string]int)
+	total := 0
+	for i := 0; i < len(words); {
+		n := 1
+		key := words[i]
+		for _, ew := range patterns {
+			if i+len(ew) > len(words) {
+				continue
+			}
+			matched := true
+			for j, w := range ew {
+				if words[i+j] != w {
+					matched = false
+					break
+				}
+			}
+			if matched {
+				n = len(ew)
+				key = strings.Join(ew, " ")
+				break
+			}
+		}
+		counts[key]++
+		total++
+		i += n
+	}
+	return counts, total
+}
+
+// Entropyは本文に含まれるエンティティの出現回数から、methodの定義で情報エントロピーを計算する。
+// 出現しなかったエンティティは0として扱い（0log0=0）、本文が空の場合は0を戻す。
+// tokens以外では、エンティティが現れない場合も0を戻す。
+func Entropy(text string, entities []string, method EntropyMethod) float64 {
+	if method == EntropyTokens {
+		counts, total := CountTokens(text, entities)
+		h := 0.0
+		for _, count := range counts {
+			h -= plogp(float64(count) / float64(total))
+		}
+		return h
+	}
+	counts, wordsLen := CountEntities(text, entities)
+	switch method {
+	case EntropyLegacy:
+		if wordsLen == 0 {
+			return 0
+		}
+		h := 0.0
+		for key, count := range counts {
+			h -= plogp(float64(count*len(strings.Fields(key))) / float64(wordsLen))
+		}
+		return h
+	case EntropyEntities, EntropyNormalized:
+		total, kinds := 0, 0
+		for _, count := range counts {
+			if count > 0 {
+				total += count
+				kinds++
+			}
+		}
+		if total == 0 {
+			return 0
+		}
+		h := 0.0
+		for _, count := range counts {
+			h -= plogp(float64(count) / float64(total))
+		}
+		if method == EntropyNormalized {
+			// 一種類しか現れない場合は、ばらつきがないため0とする
+			if kinds < 2 {
+				return 0
+			}
+			return h / math.Log2(float64(kinds))
+		}
+		return h
+	}
+	return 0
+}
+
+// plogpはp*log2(p)を戻す（p=0の場合は0）
+func plogp(p float64) float64 {
+	if p <= 0 {
+		return 0
+	}
+	return p * math.Log2(p)
+}
+
+// CulcEntropyは本文に含まれるエンティティの出現割合から、情報エントロピーを計算する
+func CulcEntropy(texts string, entities []string) float64 {
+	return Entropy(texts, entities, EntropyTokens)
+}
+
+// SetEntropyは全てのイベントの情報エントロピーを計算する
+func SetEntropy(d *pipeline.EventsDataJSON) {
+	SetEntropyWith(d, EntropyTokens)
+}
+
+// SetEntropyWithは全てのイベントの情報エントロピーをmethodの定義で計算する
+func SetEntropyWith(d *pipeline.EventsDataJSON, method EntropyMethod) {
+	for i, v := range d.Events {
+		d.Events[i].Entropy = Entropy(v.Text, v.Entities, method)
+	}
+}
@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEntropy(t *testing.T) {
+	log2 := math.Log2
+	tests := []struct {
+		name     string
+		text     string
+		entities []string
+		method   EntropyMethod
+		want     float64
+	}{
+		// tokens：エンティティを一つのトークンとした、全てのトークンの分布
+		{"empty text", "", []string{"US"}, EntropyTokens, 0},
+		{"no entities", "The business grew.", []string{"US"}, EntropyTokens, log2(3)},
+		{"multi-word entity is one token", "Joe Biden spoke.", []string{"Joe Biden", "Obama"}, EntropyTokens, 1},
+		{"entities and words", "New York and Paris", []string{"New York", "Paris"}, EntropyTokens, log2(3)},
+		{"repeated tokens", "U.S. troops left the u.s.", []string{"U.S."}, EntropyTokens, -(0.4*log2(0.4) + 3*0.2*log2(0.2))},
+		{"non-overlapping matches", "a a a", []string{"a a"}, EntropyTokens, 1},
+		{"longest entity first", "New York City and York", []string{"York", "New York", "New York City"}, EntropyTokens, log2(3)},
+		{"single token", "Paris Paris", []string{"Paris"}, EntropyTokens, 0},
+
+		// entities：現れたエンティティの出現回数の分布
+		{"entities without text", "", []string{"US"}, EntropyEntities, 0},
+		{"entities none", "The president spoke.", nil, EntropyEntities, 0},
+		{"case and punctuation", "U.S. troops left the u.s.", []string{"US"}, EntropyEntities, 0},
+		{"duplicate entities", "Paris and Paris", []string{"Paris", "paris"}, EntropyEntities, 0},
+		{"uniform entities", "Paris Berlin Rome Madrid", []string{"Paris", "Berlin", "Rome", "Madrid"}, EntropyEntities, 2},
+		{"skewed entities", "Paris Paris Paris Berlin", []string{"Paris", "Berlin"}, EntropyEntities, -(0.75*log2(0.75) + 0.25*log2(0.25))},
+
+		// normalized：entitiesを種類数での最大値で割ったもの
+		{"normalized uniform", "Paris Berlin Rome", []string{"Paris", "Berlin", "Rome"}, EntropyNormalized, 1},
+		{"normalized skewed", "Paris Paris Paris Berlin", []string{"Paris", "Berlin"}, EntropyNormalized, -(0.75*log2(0.75) + 0.25*log2(0.25))},
+		{"normalized single kind", "Paris Paris", []string{"Paris", "Berlin"}, EntropyNormalized, 0},
+
+		// legacy：これまでの定義（エンティティの出現回数×単語数/本文の単語数だけを足す）
+		{"legacy substring is not a match", "The business grew.", []string{"US"}, EntropyLegacy, 0},
+		{"legacy absent entity is zero", "Joe Biden spoke.", []string{"Joe Biden", "Obama"}, EntropyLegacy, -(2.0 / 3) * log2(2.0/3)},
+		{"legacy abbreviation", "U.S. troops left the u.s.", []string{"U.S."}, EntropyLegacy, -(2.0 / 5) * log2(2.0/5)},
+		{"legacy multi-word", "New York and Paris", []string{"New York", "Paris"}, EntropyLegacy, -(0.5*log2(0.5) + 0.25*log2(0.25))},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.method)+"/"+tt.name, func(t *testing.T) {
+			got := Entropy(tt.text, tt.entities, tt.method)
+			if math.IsNaN(got) || math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("Entropy(%q, %q) = %v, want %v", tt.text, tt.entities, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		entities []string
+		want     map[string]int
+	}{
+		{"words only", "Kyiv and Kyiv", nil, map[string]int{"kyiv": 2, "and": 1}},
+		{"entity replaces its words", "Joe Biden met Joe", []string{"Joe Biden"}, map[string]int{"joe biden": 1, "met": 1, "joe": 1}},
+		{"word boundaries", "US business", []string{"US"}, map[string]int{"us": 1, "business": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := CountTokens(tt.text, tt.entities)
+			sum := 0
+			for _, c := range tt.want {
+				sum += c
+			}
+			if total != sum || len(got) != len(tt.want) {
+				t.Fatalf("CountTokens = %v (total %d), want %v (total %d)", got, total, tt.want, sum)
+			}
+			for k, c := range tt.want {
+				if got[k] != c {
+					t.Errorf("count of %q = %d, want %d", k, got[k], c)
+				}
+			}
+		})
+	}
+}
+
+func TestParseEntropyMethod(t *testing.T) {
+	for _, name := range EntropyMethods {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseEntropyMethod(name); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if _, err := ParseEntropyMethod("shannon"); err == nil {
+		t.Error("ParseEntropyMethod(shannon): want an error")
+	}
+}
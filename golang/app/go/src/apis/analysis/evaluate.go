@@ -0,0 +1,310 @@
+package analysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 正解のトピックとする見出し（Event.Tags）の選び方
+const (
+	// 最も内側の見出し（例：Battle of Kyiv）
+	LabelLeaf = "leaf"
+	// 最も外側の見出し（例：2022 Russian invasion of Ukraine）
+	LabelRoot = "root"
+	// 全ての見出しをつなげたもの
+	LabelPath = "path"
+)
+
+// LabelNamesはEventLabelで指定できる名前
+var LabelNames = []string{LabelLeaf, LabelRoot, LabelPath}
+
+// CheckLabelは正解のトピックの選び方が指定できるものかどうかを確認する
+func CheckLabel(how string) error {
+	for _, v := range LabelNames {
+		if v == how {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown label: %s (%s)", how, strings.Join(LabelNames, ", "))
+}
+
+// EventLabelはイベントの見出しから、正解のトピックの名前を戻す（見出しがない場合は空文字）
+func EventLabel(e pipeline.EventData, how string) string {
+	if len(e.Tags) == 0 {
+		return ""
+	}
+	switch how {
+	case LabelRoot:
+		return e.Tags[0]
+	case LabelPath:
+		return strings.Join(e.Tags, " > ")
+	}
+	return e.Tags[len(e.Tags)-1]
+}
+
+// ClusterScoreはイベントのまとまりに対する、分類の評価
+type ClusterScore struct {
+	// まとまりの名前（全体、月、カテゴリ）
+	Group string `json:"group"`
+	// 評価したイベント（見出しがあるもの）と、分類したトピックの数と、正解のトピックの数
+	Events   int `json:"events"`
+	Clusters int `json:"clusters"`
+	Labels   int `json:"labels"`
+
+	Purity            float64 `json:"purity"`
+	NMI               float64 `json:"nmi"`
+	ARI               float64 `json:"ari"`
+	BCubedPrecision   float64 `json:"bcubed_precision"`
+	BCubedRecall      float64 `json:"bcubed_recall"`
+	BCubedF1          float64 `json:"bcubed_f1"`
+	PairwisePrecision float64 `json:"pairwise_precision"`
+	PairwiseRecall    float64 `json:"pairwise_recall"`
+	PairwiseF1        float64 `json:"pairwise_f1"`
+}
+
+// MetricNamesはMetricで指定できる指標の名前
+var MetricNames = []string{"purity", "nmi", "ari", "bcubed_precision", "bcubed_recall", "bcubed_f1", "pairwise_precision", "pairwise_recall", "pairwise_f1"}
+
+// Metricは名前に対応する指標の値を戻す
+func (s ClusterScore) Metric(name string) (float64, error) {
+	switch name {
+	case "purity":
+		return s.Purity, nil
+	case "nmi":
+		return s.NMI, nil
+	case "ari":
+		return s.ARI, nil
+	case "bcubed_precision":
+		return s.BCubedPrecision, nil
+	case "bcubed_recall":
+		return s.BCubedRecall, nil
+	case "bcubed_f1":
+		return s.BCubedF1, nil
+	case "pairwise_precision":
+		return s.PairwisePrecision, nil
+	case "pairwise_recall":
+		return s.PairwiseRecall, nil
+	case "pairwise_f1":
+		return s.PairwiseF1, nil
+	}
+	return 0, fmt.Errorf("unknown metric: %s (%s)", name, strings.Join(MetricNames, ", "))
+}
+
+// Evaluationは全体と、月ごと、カテゴリごとの評価
+type Evaluation struct {
+	// 正解のトピックの選び方
+	Label   string         `json:"label"`
+	Overall ClusterScore   `json:"overall"`
+	ByMonth []ClusterScore `json:"by_month"`
+	// カテゴリがないイベントは「(none)」にまとめる
+	ByCategory []ClusterScore `json:"by_category"`
+	// 見出しがないため評価しなかったイベントと、どのトピックにも含まれなかったイベントの数
+	Unlabeled  int `json:"unlabeled"`
+	Unassigned int `json:"unassigned"`
+}
+
+// EvaluateTopicsは、イベントの見出し（Wikipediaの編集者が付けたもの）を正解として、トピックの分類を評価する
+func EvaluateTopics(d pipeline.EventsDataJSON, topics pipeline.Topics, label string) Evaluation {
+	cluster := make(map[int]int)
+	for i, t := range topics.Result {
+		for id := range t.DocIds {
+			cluster[id] = i
+		}
+	}
+	ev := Evaluation{Label: label}
+	var all []labeledEvent
+	byMonth := make(map[string][]labeledEvent)
+	byCategory := make(map[string][]labeledEvent)
+	for _, e := range d.Events {
+		l := EventLabel(e, label)
+		if l == "" {
+			ev.Unlabeled++
+			continue
+		}
+		c, found := cluster[e.Id]
+		if !found {
+			ev.Unassigned++
+			continue
+		}
+		it := labeledEvent{cluster: c, label: l}
+		all = append(all, it)
+		byMonth[e.Date[:7]] = append(byMonth[e.Date[:7]], it)
+		category := strings.TrimSpace(e.Category)
+		if category == "" {
+			category = "(none)"
+		}
+		byCategory[category] = append(byCategory[category], it)
+	}
+	score := func(group string, items []labeledEvent) ClusterScore {
+		clusters := make([]int, len(items))
+		labels := make([]string, len(items))
+		for i, it := range items {
+			clusters[i], labels[i] = it.cluster, it.label
+		}
+		s := ScoreClusters(clusters, labels)
+		s.Group = group
+		return s
+	}
+	ev.Overall = score("all", all)
+	for _, month := range sortedGroups(byMonth) {
+		ev.ByMonth = append(ev.ByMonth, score(month, byMonth[month]))
+	}
+	for _, category := range sortedGroups(byCategory) {
+		ev.ByCategory = append(ev.ByCategory, score(category, byCategory[category]))
+	}
+	return ev
+}
+
+// labeledEventは一つのイベントの、分類したトピックと正解のトピック
+type labeledEvent struct {
+	cluster int
+	label   string
+}
+
+// sortedGroupsはまとまりの名前を辞書順に並べて戻す
+func sortedGroups(m map[string][]labeledEvent) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ScoreClustersは、i番目のイベントの分類したトピックclusters[i]と正解のトピックlabels[i]から、各指標を計算する
+func ScoreClusters(clusters []int, labels []string) ClusterScore {
+	n := len(clusters)
+	s := ClusterScore{Events: n}
+	if n == 0 {
+		return s
+	}
+	// 分割表（分類したトピックごと、正解のトピックごとのイベントの数）
+	table := make(map[int]map[string]int)
+	clusterSize := make(map[int]int)
+	labelSize := make(map[string]int)
+	for i := range clusters {
+		if table[clusters[i]] == nil {
+			table[clusters[i]] = make(map[string]int)
+		}
+		table[clusters[i]][labels[i]]++
+		clusterSize[clusters[i]]++
+		labelSize[labels[i]]++
+	}
+	s.Clusters, s.Labels = len(clusterSize), len(labelSize)
+	total := float64(n)
+
+	var majority int
+	var mutual, sumComb, bPrecision, bRecall float64
+	for c, row := range table {
+		best := 0
+		for l, nij := range row {
+			if nij > best {
+				best = nij
+			}
+			x := float64(nij)
+			mutual += x / total * math.Log(x*total/(float64(clusterSize[c])*float64(labelSize[l])))
+			sumComb += comb2(x)
+			bPrecision += x * x / float64(clusterSize[c])
+			bRecall += x * x / float64(labelSize[l])
+		}
+		majority += best
+	}
+	s.Purity = float64(majority) / total
+
+	var hClusters, hLabels, clusterComb, labelComb float64
+	for _, a := range clusterSize {
+		p := float64(a) / total
+		hClusters -= p * math.Log(p)
+		clusterComb += comb2(float64(a))
+	}
+	for _, b := range labelSize {
+		p := float64(b) / total
+		hLabels -= p * math.Log(p)
+		labelComb += comb2(float64(b))
+	}
+	// どちらも一つのトピックしかない場合は、完全に一致しているとする
+	if hClusters+hLabels == 0 {
+		s.NMI = 1
+	} else {
+		s.NMI = 2 * mutual / (hClusters + hLabels)
+	}
+
+	// イベントが一つの場合は組みがないため、完全に一致しているとする
+	expected := 0.0
+	if comb2(total) > 0 {
+		expected = clusterComb * labelComb / comb2(total)
+	}
+	maxIndex := (clusterComb + labelComb) / 2
+	if maxIndex == expected {
+		s.ARI = 1
+	} else {
+		s.ARI = (sumComb - expected) / (maxIndex - expected)
+	}
+
+	s.BCubedPrecision = bPrecision / total
+	s.BCubedRecall = bRecall / total
+	s.BCubedF1 = f1(s.BCubedPrecision, s.BCubedRecall)
+
+	// 同じトピックに分類したイベントの組みのうち、正解でも同じトピックである組みの割合
+	s.PairwisePrecision = ratio(sumComb, clusterComb)
+	s.PairwiseRecall = ratio(sumComb, labelComb)
+	s.PairwiseF1 = f1(s.PairwisePrecision, s.PairwiseRecall)
+	return s
+}
+
+// comb2はn個から二つを選ぶ組みの数を戻す
+func comb2(n float64) float64 {
+	return n * (n - 1) / 2
+}
+
+// ratioはa/bを戻す（bが0の場合は、a=bとして1を戻す）
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 1
+	}
+	return a / b
+}
+
+func f1(p, r float64) float64 {
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// WriteEvaluationは評価を表にして書き出す
+func WriteEvaluation(w io.Writer, ev Evaluation) {
+	fmt.Fprintf(w, "label: %s, unlabeled events: %d, unassigned events: %d\n", ev.Label, ev.Unlabeled, ev.Unassigned)
+	writeScores := func(title string, scores []ClusterScore) {
+		fmt.Fprintf(w, "\n[%s]\n", title)
+		fmt.Fprintf(w, "%-24s %7s %8s %7s %7s %7s %7s %7s %7s %7s %7s %7s %7s\n",
+			"group", "events", "clusters", "labels", "purity", "nmi", "ari", "b3-p", "b3-r", "b3-f1", "pair-p", "pair-r", "pair-f1")
+		for _, s := range scores {
+			group := s.Group
+			if len([]rune(group)) > 24 {
+				group = string([]rune(group)[:23]) + "…"
+			}
+			fmt.Fprintf(w, "%-24s %7d %8d %7d %7.3f %7.3f %7.3f %7.3f %7.3f %7.3f %7.3f %7.3f %7.3f\n",
+				group, s.Events, s.Clusters, s.Labels, s.Purity, s.NMI, s.ARI,
+				s.BCubedPrecision, s.BCubedRecall, s.BCubedF1, s.PairwisePrecision, s.PairwiseRecall, s.PairwiseF1)
+		}
+	}
+	writeScores("overall", []ClusterScore{ev.Overall})
+	writeScores("by month", ev.ByMonth)
+	writeScores("by category", ev.ByCategory)
+}
+
+// WriteEvaluationJsonは評価をJSONでファイルに書き出す（比較や集計に用いる）
+func WriteEvaluationJson(path string, ev Evaluation) error {
+	b, err := json.MarshalIndent(ev, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,158 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEventLabel(t *testing.T) {
+	e := pipeline.EventData{Tags: []string{"2022 Russian invasion of Ukraine", "Battle of Kyiv"}}
+	tests := []struct {
+		how, want string
+	}{
+		{LabelLeaf, "Battle of Kyiv"},
+		{LabelRoot, "2022 Russian invasion of Ukraine"},
+		{LabelPath, "2022 Russian invasion of Ukraine > Battle of Kyiv"},
+	}
+	for _, tt := range tests {
+		if got := EventLabel(e, tt.how); got != tt.want {
+			t.Errorf("EventLabel(%s) = %q, want %q", tt.how, got, tt.want)
+		}
+	}
+	if got := EventLabel(pipeline.EventData{}, LabelLeaf); got != "" {
+		t.Errorf("EventLabel without tags = %q, want empty", got)
+	}
+	if err := CheckLabel("branch"); err == nil {
+		t.Error("CheckLabel(branch): no error")
+	}
+}
+
+func TestScoreClusters(t *testing.T) {
+	tests := []struct {
+		name     string
+		clusters []int
+		labels   []string
+		want     ClusterScore
+	}{
+		// 分割表は{a: 2}, {a: 1, b: 1}, {b: 2}
+		{"three clusters for two labels", []int{0, 0, 1, 1, 2, 2}, []string{"a", "a", "a", "b", "b", "b"}, ClusterScore{
+			Events: 6, Clusters: 3, Labels: 2,
+			Purity: 5.0 / 6,
+			// 相互情報量は(2/3)ln2、エントロピーはln3とln2
+			NMI: 4.0 / 3 * math.Log(2) / math.Log(6),
+			// 組みの数は2、分類は3、正解は6で、期待値は3*6/15
+			ARI:               (2 - 1.2) / (4.5 - 1.2),
+			BCubedPrecision:   5.0 / 6,
+			BCubedRecall:      5.0 / 9,
+			BCubedF1:          2.0 / 3,
+			PairwisePrecision: 2.0 / 3,
+			PairwiseRecall:    1.0 / 3,
+			PairwiseF1:        4.0 / 9,
+		}},
+		{"identical", []int{7, 7, 3}, []string{"x", "x", "y"}, ClusterScore{
+			Events: 3, Clusters: 2, Labels: 2,
+			Purity: 1, NMI: 1, ARI: 1,
+			BCubedPrecision: 1, BCubedRecall: 1, BCubedF1: 1,
+			PairwisePrecision: 1, PairwiseRecall: 1, PairwiseF1: 1,
+		}},
+		// 一つのトピックにまとめると、再現率は1で適合率は正解の組みの割合
+		{"one cluster", []int{0, 0, 0, 0}, []string{"a", "a", "b", "b"}, ClusterScore{
+			Events: 4, Clusters: 1, Labels: 2,
+			Purity: 0.5, NMI: 0, ARI: 0,
+			BCubedPrecision: 0.5, BCubedRecall: 1, BCubedF1: 2.0 / 3,
+			PairwisePrecision: 2.0 / 6, PairwiseRecall: 1, PairwiseF1: 0.5,
+		}},
+		// どちらも全て別々の場合は組みがなく、完全に一致しているとする
+		{"singletons", []int{0, 1, 2}, []string{"a", "b", "c"}, ClusterScore{
+			Events: 3, Clusters: 3, Labels: 3,
+			Purity: 1, NMI: 1, ARI: 1,
+			BCubedPrecision: 1, BCubedRecall: 1, BCubedF1: 1,
+			PairwisePrecision: 1, PairwiseRecall: 1, PairwiseF1: 1,
+		}},
+		{"one event", []int{0}, []string{"a"}, ClusterScore{
+			Events: 1, Clusters: 1, Labels: 1,
+			Purity: 1, NMI: 1, ARI: 1,
+			BCubedPrecision: 1, BCubedRecall: 1, BCubedF1: 1,
+			PairwisePrecision: 1, PairwiseRecall: 1, PairwiseF1: 1,
+		}},
+		{"no events", nil, nil, ClusterScore{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScoreClusters(tt.clusters, tt.labels)
+			if got.Events != tt.want.Events || got.Clusters != tt.want.Clusters || got.Labels != tt.want.Labels {
+				t.Errorf("events, clusters, labels = %d, %d, %d, want %d, %d, %d",
+					got.Events, got.Clusters, got.Labels, tt.want.Events, tt.want.Clusters, tt.want.Labels)
+			}
+			for _, name := range MetricNames {
+				g, err := got.Metric(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				w, _ := tt.want.Metric(name)
+				if math.Abs(g-w) > 1e-12 {
+					t.Errorf("%s = %v, want %v", name, g, w)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreClustersReference(t *testing.T) {
+	// scikit-learnのnormalized_mutual_info_score（算術平均）とadjusted_rand_scoreの値
+	s := ScoreClusters([]int{0, 0, 1, 1, 2, 2}, []string{"a", "a", "a", "b", "b", "b"})
+	if math.Abs(s.NMI-0.5158) > 1e-4 || math.Abs(s.ARI-0.2424) > 1e-4 {
+		t.Errorf("NMI, ARI = %.4f, %.4f, want 0.5158, 0.2424", s.NMI, s.ARI)
+	}
+}
+
+func TestEvaluateTopics(t *testing.T) {
+	d := pipeline.EventsDataJSON{Events: []pipeline.EventData{
+		{Id: 1, Date: "2022-01-01", Category: "Armed conflicts", Tags: []string{"War", "Battle A"}},
+		{Id: 2, Date: "2022-01-02", Category: "Armed conflicts", Tags: []string{"War", "Battle A"}},
+		{Id: 3, Date: "2022-02-01", Category: "Armed conflicts", Tags: []string{"War", "Battle B"}},
+		{Id: 4, Date: "2022-02-02", Category: " ", Tags: []string{"Election"}},
+		// 見出しがない
+		{Id: 5, Date: "2022-02-03", Category: "Politics"},
+		// どのトピックにも含まれない
+		{Id: 6, Date: "2022-02-04", Category: "Politics", Tags: []string{"Election"}},
+	}}
+	topics := pipeline.Topics{Result: []pipeline.Topic{
+		{DocIds: map[int]pipeline.Document{1: {}, 2: {}, 3: {}}},
+		{DocIds: map[int]pipeline.Document{4: {}, 5: {}}},
+	}}
+
+	leaf := EvaluateTopics(d, topics, LabelLeaf)
+	if leaf.Label != LabelLeaf || leaf.Unlabeled != 1 || leaf.Unassigned != 1 {
+		t.Errorf("label, unlabeled, unassigned = %s, %d, %d, want leaf, 1, 1", leaf.Label, leaf.Unlabeled, leaf.Unassigned)
+	}
+	if o := leaf.Overall; o.Group != "all" || o.Events != 4 || o.Clusters != 2 || o.Labels != 3 || o.Purity != 0.75 {
+		t.Errorf("overall = %+v", o)
+	}
+	// 外側の見出しでは、分け方が正解と一致する
+	if root := EvaluateTopics(d, topics, LabelRoot).Overall; root.Labels != 2 || root.Purity != 1 || root.ARI != 1 {
+		t.Errorf("overall with root labels = %+v", root)
+	}
+
+	groups := func(scores []ClusterScore) []string {
+		var g []string
+		for _, s := range scores {
+			g = append(g, s.Group)
+		}
+		return g
+	}
+	if got, want := groups(leaf.ByMonth), []string{"2022-01", "2022-02"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("months = %v, want %v", got, want)
+	}
+	if got, want := groups(leaf.ByCategory), []string{"(none)", "Armed conflicts"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("categories = %v, want %v", got, want)
+	}
+	if m := leaf.ByMonth[1]; m.Events != 2 || m.Clusters != 2 || m.Labels != 2 || m.Purity != 1 {
+		t.Errorf("2022-02 = %+v", m)
+	}
+	if c := leaf.ByCategory[1]; c.Events != 3 || c.Purity != 2.0/3 {
+		t.Errorf("Armed conflicts = %+v", c)
+	}
+}
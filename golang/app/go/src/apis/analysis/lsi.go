@@ -0,0 +1,258 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// LsiはSourceのベクトル（初期値ではTF-IDF）を、ランダム化SVDでDim次元に縮約する。
+// Python側で読み込んでいるgensimのLsiModelと同じく、文書のベクトルはU・Σの各行になる。
+type Lsi struct {
+	Source Vectorizer
+	Dim    int
+	// ランダムな射影に加える次元数と、精度を上げるための反復回数
+	Oversample int
+	PowerIter  int
+	Seed       int64
+}
+
+func DefaultLsi() Lsi {
+	return Lsi{Source: PrecomputedTfIdf{}, Dim: 100, Oversample: 10, PowerIter: 2, Seed: 1}
+}
+
+func (Lsi) Name() string { return "lsi" }
+
+// sparseRowは行列の一行（列の番号と値）
+type sparseRow struct {
+	cols []int
+	vals []float64
+}
+
+func (v Lsi) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	if v.Dim < 1 {
+		return nil, fmt.Errorf("lsi: invalid Dim=%d", v.Dim)
+	}
+	source, err := v.Source.Vectorize(d)
+	if err != nil {
+		return nil, err
+	}
+	// 文書×特徴量の疎行列を作る
+	colOf := make(map[string]int)
+	rows := make([]sparseRow, len(d.Events))
+	for i, e := range d.Events {
+		vec := source[e.Id]
+		for _, k := range sortedKeys(vec) {
+			c, found := colOf[k]
+			if !found {
+				c = len(colOf)
+				colOf[k] = c
+			}
+			rows[i].cols = append(rows[i].cols, c)
+			rows[i].vals = append(rows[i].vals, vec[k])
+		}
+	}
+	nDocs, nCols := len(rows), len(colOf)
+	l := v.Dim + v.Oversample
+	if l > nDocs {
+		l = nDocs
+	}
+	if l > nCols {
+		l = nCols
+	}
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	if l == 0 {
+		for _, e := range d.Events {
+			vectors[e.Id] = map[string]float64{}
+		}
+		return vectors, nil
+	}
+
+	// Y = A・Ω、（A・Aᵀ）を掛けて大きい特異値の成分を強める
+	rng := rand.New(rand.NewSource(v.Seed))
+	omega := make([][]float64, nCols)
+	for c := range omega {
+		omega[c] = make([]float64, l)
+		for j := range omega[c] {
+			omega[c][j] = rng.NormFloat64()
+		}
+	}
+	y := mulSparse(rows, omega, l)
+	orthonormalize(y, l)
+	for it := 0; it < v.PowerIter; it++ {
+		z := mulSparseT(rows, y, nCols, l)
+		orthonormalize(z, l)
+		y = mulSparse(rows, z, l)
+		orthonormalize(y, l)
+	}
+	// B = Qᵀ・A（l×特徴量）とし、B・Bᵀの固有値分解からBの特異値分解を求める
+	bt := mulSparseT(rows, y, nCols, l)
+	gram := make([][]float64, l)
+	for i := range gram {
+		gram[i] = make([]float64, l)
+	}
+	for _, r := range bt {
+		for i := 0; i < l; i++ {
+			if r[i] == 0 {
+				continue
+			}
+			for j := i; j < l; j++ {
+				gram[i][j] += r[i] * r[j]
+			}
+		}
+	}
+	for i := 0; i < l; i++ {
+		for j := 0; j < i; j++ {
+			gram[i][j] = gram[j][i]
+		}
+	}
+	eigVals, eigVecs := jacobiEigen(gram)
+	order := make([]int, l)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return eigVals[order[i]] > eigVals[order[j]] })
+	k := v.Dim
+	if k > l {
+		k = l
+	}
+	// 文書のベクトル = Q・U_B・Σ（上位k次元）
+	for i, e := range d.Events {
+		vec := make(map[string]float64, k)
+		for t := 0; t < k; t++ {
+			sigma := math.Sqrt(math.Max(eigVals[order[t]], 0))
+			var s float64
+			for j := 0; j < l; j++ {
+				s += y[i][j] * eigVecs[j][order[t]]
+			}
+			if s*sigma != 0 {
+				vec[strconv.Itoa(t)] = s * sigma
+			}
+		}
+		vectors[e.Id] = vec
+	}
+	return vectors, nil
+}
+
+// mulSparseは疎行列A（n×m）と密行列X（m×l）の積を戻す
+func mulSparse(rows []sparseRow, x [][]float64, l int) [][]float64 {
+	out := make([][]float64, len(rows))
+	for i, r := range rows {
+		out[i] = make([]float64, l)
+		for p, c := range r.cols {
+			for j := 0; j < l; j++ {
+				out[i][j] += r.vals[p] * x[c][j]
+			}
+		}
+	}
+	return out
+}
+
+// mulSparseTは疎行列Aの転置（m×n）と密行列Y（n×l）の積を戻す
+func mulSparseT(rows []sparseRow, y [][]float64, m, l int) [][]float64 {
+	out := make([][]float64, m)
+	for c := range out {
+		out[c] = make([]float64, l)
+	}
+	for i, r := range rows {
+		for p, c := range r.cols {
+			for j := 0; j < l; j++ {
+				out[c][j] += r.vals[p] * y[i][j]
+			}
+		}
+	}
+	return out
+}
+
+// orthonormalizeは行列の各列を、修正グラム・シュミット法で正規直交化する
+func orthonormalize(x [][]float64, l int) {
+	for j := 0; j < l; j++ {
+		for p := 0; p < j; p++ {
+			var dot float64
+			for i := range x {
+				dot += x[i][j] * x[i][p]
+			}
+			for i := range x {
+				x[i][j] -= dot * x[i][p]
+			}
+		}
+		var norm float64
+		for i := range x {
+			norm += x[i][j] * x[i][j]
+		}
+		norm = math.Sqrt(norm)
+		for i := range x {
+			if norm > 1e-12 {
+				x[i][j] /= norm
+			} else {
+				x[i][j] = 0
+			}
+		}
+	}
+}
+
+// jacobiEigenは対称行列の固有値と固有ベクトル（列）をヤコビ法で求める
+func jacobiEigen(a [][]float64) ([]float64, [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	v := make([][]float64, n)
+	for i := range m {
+		m[i] = append([]float64(nil), a[i]...)
+		v[i] = make([]float64, n)
+		v[i][i] = 1
+	}
+	var total float64
+	for i := range a {
+		for j := range a[i] {
+			total += a[i][j] * a[i][j]
+		}
+	}
+	for sweep := 0; sweep < 100; sweep++ {
+		var off float64
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				off += m[i][j] * m[i][j]
+			}
+		}
+		if off <= 1e-24*total {
+			break
+		}
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(m[p][q]) < 1e-300 {
+					continue
+				}
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				if theta < 0 {
+					t = -t
+				}
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p] = c*vkp - s*vkq
+					v[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	vals := make([]float64, n)
+	for i := range vals {
+		vals[i] = m[i][i]
+	}
+	return vals, v
+}
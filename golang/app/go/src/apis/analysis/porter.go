@@ -0,0 +1,275 @@
+package analysis
+
+import "strings"
+
+// PorterStemはPorterのステミングを行う。
+// Python側で使っていたNLTKのPorterStemmer（NLTK_EXTENSIONSモード）と同じ結果になるようにしている。
+func PorterStem(word string) string {
+	word = strings.ToLower(word)
+	if v, found := porterIrregular[word]; found {
+		return v
+	}
+	if len([]rune(word)) <= 2 {
+		return word
+	}
+	w := []rune(word)
+	w = porterStep1a(w)
+	w = porterStep1b(w)
+	w = porterStep1c(w)
+	w = porterStep2(w)
+	w = porterStep3(w)
+	w = porterStep4(w)
+	w = porterStep5a(w)
+	w = porterStep5b(w)
+	return string(w)
+}
+
+// NLTKで例外として扱われる語
+var porterIrregular = map[string]string{
+	"sky": "sky", "skies": "sky",
+	"dying": "die", "lying": "lie", "tying": "tie",
+	"news":    "news",
+	"innings": "inning", "inning": "inning",
+	"outings": "outing", "outing": "outing",
+	"cannings": "canning", "canning": "canning",
+	"howe":    "howe",
+	"proceed": "proceed", "exceed": "exceed", "succeed": "succeed",
+}
+
+// porterRuleは「末尾がsuffixで、残りの語幹がcondを満たせばreplに置き換える」という規則
+// suffixが「*d」の場合は、同じ子音が二つ続く語尾を表す
+type porterRule struct {
+	suffix string
+	repl   string
+	cond   func(stem []rune) bool
+}
+
+func isConsonant(w []rune, i int) bool {
+	switch w[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		if i == 0 {
+			return true
+		}
+		return !isConsonant(w, i-1)
+	}
+	return true
+}
+
+// measureは語幹の「母音の並び → 子音の並び」の数を戻す
+func measure(w []rune) int {
+	m := 0
+	prevVowel := false
+	for i := range w {
+		c := isConsonant(w, i)
+		if c && prevVowel {
+			m++
+		}
+		prevVowel = !c
+	}
+	return m
+}
+
+func positiveMeasure(w []rune) bool { return measure(w) > 0 }
+
+func containsVowel(w []rune) bool {
+	for i := range w {
+		if !isConsonant(w, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsDoubleConsonant(w []rune) bool {
+	n := len(w)
+	return n >= 2 && w[n-1] == w[n-2] && isConsonant(w, n-1)
+}
+
+func endsCVC(w []rune) bool {
+	n := len(w)
+	if n >= 3 && isConsonant(w, n-3) && !isConsonant(w, n-2) && isConsonant(w, n-1) {
+		return w[n-1] != 'w' && w[n-1] != 'x' && w[n-1] != 'y'
+	}
+	return n == 2 && !isConsonant(w, 0) && isConsonant(w, 1)
+}
+
+func hasSuffix(w []rune, suffix string) bool {
+	return strings.HasSuffix(string(w), suffix)
+}
+
+func trimSuffix(w []rune, suffix string) []rune {
+	return w[:len(w)-len([]rune(suffix))]
+}
+
+func concat(w []rune, s string) []rune {
+	r := make([]rune, 0, len(w)+len(s))
+	r = append(r, w...)
+	return append(r, []rune(s)...)
+}
+
+// applyRulesは最初に末尾が一致した規則だけを適用する
+func applyRules(w []rune, rules []porterRule) []rune {
+	for _, r := range rules {
+		if r.suffix == "*d" {
+			if endsDoubleConsonant(w) {
+				stem := w[:len(w)-2]
+				if r.cond == nil || r.cond(stem) {
+					return concat(stem, r.repl)
+				}
+				return w
+			}
+			continue
+		}
+		if hasSuffix(w, r.suffix) {
+			stem := trimSuffix(w, r.suffix)
+			if r.cond == nil || r.cond(stem) {
+				return concat(stem, r.repl)
+			}
+			return w
+		}
+	}
+	return w
+}
+
+func porterStep1a(w []rune) []rune {
+	if hasSuffix(w, "ies") && len(w) == 4 {
+		return concat(trimSuffix(w, "ies"), "ie")
+	}
+	return applyRules(w, []porterRule{
+		{"sses", "ss", nil},
+		{"ies", "i", nil},
+		{"ss", "ss", nil},
+		{"s", "", nil},
+	})
+}
+
+func porterStep1b(w []rune) []rune {
+	if hasSuffix(w, "ied") {
+		if len(w) == 4 {
+			return concat(trimSuffix(w, "ied"), "ie")
+		}
+		return concat(trimSuffix(w, "ied"), "i")
+	}
+	if hasSuffix(w, "eed") {
+		stem := trimSuffix(w, "eed")
+		if measure(stem) > 0 {
+			return concat(stem, "ee")
+		}
+		return w
+	}
+	var stem []rune
+	found := false
+	for _, suffix := range []string{"ed", "ing"} {
+		if hasSuffix(w, suffix) {
+			stem = trimSuffix(w, suffix)
+			if containsVowel(stem) {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return w
+	}
+	last := string(stem[len(stem)-1])
+	return applyRules(stem, []porterRule{
+		{"at", "ate", nil},
+		{"bl", "ble", nil},
+		{"iz", "ize", nil},
+		{"*d", last, func([]rune) bool { return last != "l" && last != "s" && last != "z" }},
+		{"", "e", func(s []rune) bool { return measure(s) == 1 && endsCVC(s) }},
+	})
+}
+
+func porterStep1c(w []rune) []rune {
+	return applyRules(w, []porterRule{
+		{"y", "i", func(s []rune) bool { return len(s) > 1 && isConsonant(s, len(s)-1) }},
+	})
+}
+
+func porterStep2(w []rune) []rune {
+	if hasSuffix(w, "alli") && positiveMeasure(trimSuffix(w, "alli")) {
+		return porterStep2(concat(trimSuffix(w, "alli"), "al"))
+	}
+	return applyRules(w, []porterRule{
+		{"ational", "ate", positiveMeasure},
+		{"tional", "tion", positiveMeasure},
+		{"enci", "ence", positiveMeasure},
+		{"anci", "ance", positiveMeasure},
+		{"izer", "ize", positiveMeasure},
+		{"bli", "ble", positiveMeasure},
+		{"alli", "al", positiveMeasure},
+		{"entli", "ent", positiveMeasure},
+		{"eli", "e", positiveMeasure},
+		{"ousli", "ous", positiveMeasure},
+		{"ization", "ize", positiveMeasure},
+		{"ation", "ate", positiveMeasure},
+		{"ator", "ate", positiveMeasure},
+		{"alism", "al", positiveMeasure},
+		{"iveness", "ive", positiveMeasure},
+		{"fulness", "ful", positiveMeasure},
+		{"ousness", "ous", positiveMeasure},
+		{"aliti", "al", positiveMeasure},
+		{"iviti", "ive", positiveMeasure},
+		{"biliti", "ble", positiveMeasure},
+		{"fulli", "ful", positiveMeasure},
+		// 「logi」の「l」は語幹に含めて測る
+		{"logi", "log", func([]rune) bool { return positiveMeasure(w[:len(w)-3]) }},
+	})
+}
+
+func porterStep3(w []rune) []rune {
+	return applyRules(w, []porterRule{
+		{"icate", "ic", positiveMeasure},
+		{"ative", "", positiveMeasure},
+		{"alize", "al", positiveMeasure},
+		{"iciti", "ic", positiveMeasure},
+		{"ical", "ic", positiveMeasure},
+		{"ful", "", positiveMeasure},
+		{"ness", "", positiveMeasure},
+	})
+}
+
+func porterStep4(w []rune) []rune {
+	gt1 := func(s []rune) bool { return measure(s) > 1 }
+	return applyRules(w, []porterRule{
+		{"al", "", gt1},
+		{"ance", "", gt1},
+		{"ence", "", gt1},
+		{"er", "", gt1},
+		{"ic", "", gt1},
+		{"able", "", gt1},
+		{"ible", "", gt1},
+		{"ant", "", gt1},
+		{"ement", "", gt1},
+		{"ment", "", gt1},
+		{"ent", "", gt1},
+		{"ion", "", func(s []rune) bool { return measure(s) > 1 && (s[len(s)-1] == 's' || s[len(s)-1] == 't') }},
+		{"ou", "", gt1},
+		{"ism", "", gt1},
+		{"ate", "", gt1},
+		{"iti", "", gt1},
+		{"ous", "", gt1},
+		{"ive", "", gt1},
+		{"ize", "", gt1},
+	})
+}
+
+func porterStep5a(w []rune) []rune {
+	if hasSuffix(w, "e") {
+		stem := trimSuffix(w, "e")
+		m := measure(stem)
+		if m > 1 || (m == 1 && !endsCVC(stem)) {
+			return stem
+		}
+	}
+	return w
+}
+
+func porterStep5b(w []rune) []rune {
+	return applyRules(w, []porterRule{
+		{"ll", "l", func([]rune) bool { return measure(w[:len(w)-1]) > 1 }},
+	})
+}
@@ -0,0 +1,284 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"sort"
+	"time"
+)
+
+// RefineOptionは分類した後にトピックをまとめたり分けたりする条件
+type RefineOption struct {
+	// 重心のコサイン類似度がMergeThreshold以上で、期間が重なる（MaxGap日までの隙間を含む）トピックをまとめる
+	MergeThreshold float64
+	MaxGap         int
+	// イベントがMinSplitDocs以上あり、まとまり（イベントのベクトルと重心の類似度の平均）がSplitCohesionより低いトピックを二つに分ける
+	SplitCohesion float64
+	MinSplitDocs  int
+}
+
+func DefaultRefineOption() RefineOption {
+	return RefineOption{
+		MergeThreshold: 0.5,
+		MaxGap:         0,
+		SplitCohesion:  0.3,
+		MinSplitDocs:   4,
+	}
+}
+
+// Refineは分類したトピックをまとめる処理と、分ける処理を順に行い、判断の記録と共に戻す。
+// 一つの話題が小さなトピックに分かれたものをまとめ、まとめすぎたトピックを分ける。
+func Refine(topics []pipeline.Topic, vectors map[int]map[string]float64, opt RefineOption) ([]pipeline.Topic, pipeline.RefineLog) {
+	var log pipeline.RefineLog
+	topics = mergeTopics(topics, opt, &log)
+	topics = splitTopics(topics, vectors, opt, &log)
+	return topics, log
+}
+
+// topicKeyはトピックを表すID（含まれるイベントのうち最も小さいID）を戻す
+func topicKey(t pipeline.Topic) int {
+	key, first := 0, true
+	for id := range t.DocIds {
+		if first || id < key {
+			key, first = id, false
+		}
+	}
+	return key
+}
+
+// topicSpanはトピックに含まれるイベントの最も古い日付と新しい日付を戻す
+func topicSpan(t pipeline.Topic) (time.Time, time.Time) {
+	var start, end time.Time
+	for _, doc := range t.DocIds {
+		if start.IsZero() || doc.Date.Before(start) {
+			start = doc.Date
+		}
+		if end.IsZero() || doc.Date.After(end) {
+			end = doc.Date
+		}
+	}
+	return start, end
+}
+
+// mergeTopicsは重心の類似度が高い組みから順に、期間が重なるトピックをまとめる。
+// まとめるたびに、まとめたトピックと他のトピックの類似度を計算し直して、まとめる組みの候補を入れ替える。
+// 与えられたトピックは変えず、写したものをまとめる。
+func mergeTopics(src []pipeline.Topic, opt RefineOption, log *pipeline.RefineLog) []pipeline.Topic {
+	topics := make([]pipeline.Topic, len(src))
+	for i, t := range src {
+		topics[i] = t.Copy()
+	}
+	centers := make([]map[string]float64, len(topics))
+	active := make([]bool, len(topics))
+	for i, t := range topics {
+		centers[i] = normalizedCopy(t.CenterGravity)
+		active[i] = true
+	}
+	// まとめる組みの候補（添字の小さい方が先）と、その類似度
+	candidates := make(map[[2]int]float64)
+	for i := range topics {
+		for j := i + 1; j < len(topics); j++ {
+			if s := dot(centers[i], centers[j]); s >= opt.MergeThreshold {
+				candidates[[2]int{i, j}] = s
+			}
+		}
+	}
+	gap := time.Duration(opt.MaxGap) * 24 * time.Hour
+	for len(candidates) > 0 {
+		// 類似度の最も高い組み（同じ類似度の場合は添字の小さい組み）
+		var p [2]int
+		sim, first := 0.0, true
+		for c, s := range candidates {
+			if first || s > sim || (s == sim && (c[0] < p[0] || (c[0] == p[0] && c[1] < p[1]))) {
+				p, sim, first = c, s, false
+			}
+		}
+		delete(candidates, p)
+		i, j := p[0], p[1]
+		decision := pipeline.RefineDecision{
+			Action:     pipeline.RefineMerge,
+			Topics:     []int{topicKey(topics[i]), topicKey(topics[j])},
+			Similarity: sim,
+		}
+		startI, endI := topicSpan(topics[i])
+		startJ, endJ := topicSpan(topics[j])
+		if startI.After(endJ.Add(gap)) || startJ.After(endI.Add(gap)) {
+			decision.Sizes = []int{len(topics[i].DocIds), len(topics[j].DocIds)}
+			decision.Reason = fmt.Sprintf("time spans do not overlap (%s..%s, %s..%s)",
+				startI.Format("2006-01-02"), endI.Format("2006-01-02"), startJ.Format("2006-01-02"), endJ.Format("2006-01-02"))
+			log.Decisions = append(log.Decisions, decision)
+			continue
+		}
+		topics[i].Merge(topics[j])
+		centers[i] = normalizedCopy(topics[i].CenterGravity)
+		active[j] = false
+		decision.Accepted = true
+		decision.Result = []int{topicKey(topics[i])}
+		decision.Sizes = []int{len(topics[i].DocIds)}
+		decision.Reason = fmt.Sprintf("similarity %.3f reaches threshold %.3f and time spans overlap", sim, opt.MergeThreshold)
+		log.Decisions = append(log.Decisions, decision)
+
+		// まとめたトピックは重心と期間が変わるため、他のトピックとの組みを計算し直す
+		// （候補でなかった組みが候補になることも、候補だった組みが外れることもある）
+		for k := range topics {
+			if !active[k] || k == i {
+				continue
+			}
+			pk := [2]int{i, k}
+			if k < i {
+				pk = [2]int{k, i}
+			}
+			was, found := candidates[pk]
+			if s, ok := candidates[[2]int{k, j}]; ok && (!found || s > was) {
+				was, found = s, true
+			}
+			if s, ok := candidates[[2]int{j, k}]; ok && (!found || s > was) {
+				was, found = s, true
+			}
+			delete(candidates, [2]int{k, j})
+			delete(candidates, [2]int{j, k})
+			s := dot(centers[pk[0]], centers[pk[1]])
+			if s >= opt.MergeThreshold {
+				candidates[pk] = s
+				continue
+			}
+			delete(candidates, pk)
+			if found {
+				log.Decisions = append(log.Decisions, pipeline.RefineDecision{
+					Action:     pipeline.RefineMerge,
+					Topics:     []int{topicKey(topics[pk[0]]), topicKey(topics[pk[1]])},
+					Sizes:      []int{len(topics[pk[0]].DocIds), len(topics[pk[1]].DocIds)},
+					Similarity: s,
+					Reason:     fmt.Sprintf("similarity %.3f fell below threshold %.3f after earlier merges (was %.3f)", s, opt.MergeThreshold, was),
+				})
+			}
+		}
+	}
+	var merged []pipeline.Topic
+	for i, t := range topics {
+		if active[i] {
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
+
+// splitTopicsはまとまりの低いトピックを二つに分けることを、条件を満たさなくなるまで繰り返す
+func splitTopics(topics []pipeline.Topic, vectors map[int]map[string]float64, opt RefineOption, log *pipeline.RefineLog) []pipeline.Topic {
+	var result []pipeline.Topic
+	queue := append([]pipeline.Topic(nil), topics...)
+	for len(queue) > 0 {
+		t := queue[0]
+		queue = queue[1:]
+		if len(t.DocIds) < opt.MinSplitDocs || opt.MinSplitDocs < 2 {
+			result = append(result, t)
+			continue
+		}
+		cohesion := topicCohesion(t, vectors)
+		if cohesion >= opt.SplitCohesion {
+			result = append(result, t)
+			continue
+		}
+		decision := pipeline.RefineDecision{
+			Action:   pipeline.RefineSplit,
+			Topics:   []int{topicKey(t)},
+			Cohesion: cohesion,
+		}
+		a, b, ok := bisectTopic(t, vectors)
+		if !ok {
+			decision.Sizes = []int{len(t.DocIds)}
+			decision.Reason = fmt.Sprintf("cohesion %.3f is below threshold %.3f but the events could not be divided", cohesion, opt.SplitCohesion)
+			log.Decisions = append(log.Decisions, decision)
+			result = append(result, t)
+			continue
+		}
+		decision.Accepted = true
+		decision.Result = []int{topicKey(a), topicKey(b)}
+		decision.Sizes = []int{len(a.DocIds), len(b.DocIds)}
+		decision.Reason = fmt.Sprintf("cohesion %.3f is below threshold %.3f", cohesion, opt.SplitCohesion)
+		log.Decisions = append(log.Decisions, decision)
+		queue = append(queue, a, b)
+	}
+	return result
+}
+
+// topicCohesionはトピックのイベントのベクトルと重心のコサイン類似度の平均を戻す
+func topicCohesion(t pipeline.Topic, vectors map[int]map[string]float64) float64 {
+	if len(t.DocIds) == 0 {
+		return 0
+	}
+	var sum float64
+	for id := range t.DocIds {
+		sum += cosine(vectors[id], t.CenterGravity)
+	}
+	return sum / float64(len(t.DocIds))
+}
+
+// bisectTopicはトピックのイベントを二つに分ける（コサイン類似度を用いるk-meansで、kを2とする）。
+// 初期の重心は、重心から最も遠いイベントと、そのイベントから最も遠いイベントにする。
+// どちらかが空になった場合はokをfalseにする。
+func bisectTopic(t pipeline.Topic, vectors map[int]map[string]float64) (pipeline.Topic, pipeline.Topic, bool) {
+	ids := make([]int, 0, len(t.DocIds))
+	for id := range t.DocIds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	farthest := func(from map[string]float64) int {
+		best, bestSim := ids[0], 2.0
+		for _, id := range ids {
+			if s := cosine(vectors[id], from); s < bestSim {
+				best, bestSim = id, s
+			}
+		}
+		return best
+	}
+	first := farthest(t.CenterGravity)
+	second := farthest(vectors[first])
+	if first == second {
+		return pipeline.Topic{}, pipeline.Topic{}, false
+	}
+	centers := [2]map[string]float64{normalizedCopy(vectors[first]), normalizedCopy(vectors[second])}
+	side := make(map[int]int, len(ids))
+	for iter := 0; iter < 20; iter++ {
+		changed := false
+		for _, id := range ids {
+			s := 0
+			if cosine(vectors[id], centers[1]) > cosine(vectors[id], centers[0]) {
+				s = 1
+			}
+			if prev, found := side[id]; !found || prev != s {
+				side[id] = s
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := [2]map[string]float64{{}, {}}
+		for _, id := range ids {
+			for k, v := range normalizedCopy(vectors[id]) {
+				sums[side[id]][k] += v
+			}
+		}
+		for i := range centers {
+			if len(sums[i]) > 0 {
+				centers[i] = normalize(sums[i])
+			}
+		}
+	}
+	var halves [2]*pipeline.Topic
+	for _, id := range ids {
+		s := side[id]
+		if halves[s] == nil {
+			topic := pipeline.NewTopic(id, t.DocIds[id], vectors[id])
+			halves[s] = &topic
+			continue
+		}
+		halves[s].DocIds[id] = t.DocIds[id]
+		halves[s].CulcCenterOfGravity(vectors[id])
+	}
+	if halves[0] == nil || halves[1] == nil {
+		return pipeline.Topic{}, pipeline.Topic{}, false
+	}
+	return *halves[0], *halves[1], true
+}
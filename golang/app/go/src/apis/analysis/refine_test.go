@@ -0,0 +1,191 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMergeTopicsRecomputesSimilarity(t *testing.T) {
+	day := pipeline.Document{Date: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	// AとBの類似度は0.707、AとCは0.677だが、Bをまとめた後のAとCは0.428になる
+	topics := []pipeline.Topic{
+		pipeline.NewTopic(1, day, map[string]float64{"x": 1, "y": 1}),
+		pipeline.NewTopic(2, day, map[string]float64{"y": 1}),
+		pipeline.NewTopic(3, day, map[string]float64{"x": 1, "z": 0.3}),
+	}
+	opt := DefaultRefineOption()
+	var log pipeline.RefineLog
+	merged := mergeTopics(topics, opt, &log)
+	if len(merged) != 2 {
+		t.Fatalf("got %d topics, want 2 (only A and B merged)", len(merged))
+	}
+	if _, found := merged[0].DocIds[2]; !found || len(merged[0].DocIds) != 2 {
+		t.Errorf("first topic = %v, want events 1 and 2", merged[0].DocIds)
+	}
+	if len(log.Decisions) != 2 || !log.Decisions[0].Accepted || log.Decisions[1].Accepted {
+		t.Errorf("decisions = %+v, want an accepted merge and a rejected one", log.Decisions)
+	}
+}
+
+func TestMergeTopicsDoesNotModifyInput(t *testing.T) {
+	day := pipeline.Document{Date: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	topics := []pipeline.Topic{
+		pipeline.NewTopic(1, day, map[string]float64{"x": 1}),
+		pipeline.NewTopic(2, day, map[string]float64{"x": 1, "y": 0.1}),
+	}
+	var log pipeline.RefineLog
+	merged := mergeTopics(topics, DefaultRefineOption(), &log)
+	if len(merged) != 1 {
+		t.Fatalf("got %d topics, want 1", len(merged))
+	}
+	if len(topics[0].DocIds) != 1 || topics[0].Count != 1 || len(topics[0].CenterGravity) != 1 {
+		t.Errorf("input topic was modified: %+v", topics[0])
+	}
+}
+
+// refineTopicは、イベントのIDごとのベクトルを平均した重心のトピックを作る（日付は全て同じ日）
+func refineTopic(vectors map[int]map[string]float64, ids ...int) pipeline.Topic {
+	day := pipeline.Document{Date: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)}
+	topic := pipeline.NewTopic(ids[0], day, vectors[ids[0]])
+	for _, id := range ids[1:] {
+		topic.DocIds[id] = day
+		topic.CulcCenterOfGravity(vectors[id])
+	}
+	return topic
+}
+
+func TestMergeTopicsFindsNewCandidates(t *testing.T) {
+	// AとBの類似度は0.8、AとC、BとCは0.596で閾値に届かないが、AとBをまとめた重心とCは0.629になる
+	vectors := map[int]map[string]float64{
+		1: {"x": 1, "y": 0.5},
+		2: {"x": 1, "z": 0.5},
+		3: {"x": 0.5, "y": 1, "z": 1},
+	}
+	topics := []pipeline.Topic{refineTopic(vectors, 1), refineTopic(vectors, 2), refineTopic(vectors, 3)}
+	opt := DefaultRefineOption()
+	opt.MergeThreshold = 0.6
+	var log pipeline.RefineLog
+	merged := mergeTopics(topics, opt, &log)
+	if len(merged) != 1 || len(merged[0].DocIds) != 3 {
+		t.Fatalf("got %d topics (%v), want one topic with all events", len(merged), merged)
+	}
+	if len(log.Decisions) != 2 || !log.Decisions[1].Accepted || !reflect.DeepEqual(log.Decisions[1].Topics, []int{1, 3}) {
+		t.Errorf("decisions = %+v, want merges of 1 and 2, then 1 and 3", log.Decisions)
+	}
+}
+
+func TestTopicCohesion(t *testing.T) {
+	vectors := map[int]map[string]float64{1: {"x": 1}, 2: {"y": 1}, 3: {"x": 2}}
+	tests := []struct {
+		name string
+		ids  []int
+		want float64
+	}{
+		{"one event", []int{1}, 1},
+		{"same direction", []int{1, 3}, 1},
+		// 重心は{x: 0.5, y: 0.5}で、どちらのイベントとも1/sqrt(2)
+		{"orthogonal events", []int{1, 2}, 1 / math.Sqrt2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := topicCohesion(refineTopic(vectors, tt.ids...), vectors); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("cohesion = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := topicCohesion(pipeline.Topic{}, vectors); got != 0 {
+		t.Errorf("cohesion of an empty topic = %v, want 0", got)
+	}
+}
+
+// splitVectorsは、二つの話題（xとz）が二件ずつ混ざったベクトル
+var splitVectors = map[int]map[string]float64{
+	1: {"x": 1},
+	2: {"z": 1, "w": 0.1},
+	3: {"x": 1, "y": 0.1},
+	4: {"z": 1},
+}
+
+func TestBisectTopic(t *testing.T) {
+	a, b, ok := bisectTopic(refineTopic(splitVectors, 1, 2, 3, 4), splitVectors)
+	if !ok {
+		t.Fatal("could not bisect")
+	}
+	got := [][]int{topicIds(a), topicIds(b)}
+	if want := [][]int{{1, 3}, {2, 4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// 同じ向きのイベントだけのトピックは分けられない
+	same := map[int]map[string]float64{1: {"x": 1}, 2: {"x": 2}, 3: {"x": 3}}
+	if _, _, ok := bisectTopic(refineTopic(same, 1, 2, 3), same); ok {
+		t.Error("bisected events of the same direction")
+	}
+}
+
+func TestSplitTopics(t *testing.T) {
+	mixed := refineTopic(splitVectors, 1, 2, 3, 4)
+	tests := []struct {
+		name      string
+		cohesion  float64
+		minDocs   int
+		want      [][]int
+		decisions []pipeline.RefineDecision
+	}{
+		{"split once", 0.8, 4, [][]int{{1, 3}, {2, 4}}, []pipeline.RefineDecision{
+			{Action: pipeline.RefineSplit, Accepted: true, Topics: []int{1}, Result: []int{1, 2}, Sizes: []int{2, 2}},
+		}},
+		// 分けたトピックも条件を満たす場合は、さらに分ける
+		{"split again", 1.1, 2, [][]int{{1}, {3}, {4}, {2}}, []pipeline.RefineDecision{
+			{Action: pipeline.RefineSplit, Accepted: true, Topics: []int{1}, Result: []int{1, 2}, Sizes: []int{2, 2}},
+			{Action: pipeline.RefineSplit, Accepted: true, Topics: []int{1}, Result: []int{1, 3}, Sizes: []int{1, 1}},
+			{Action: pipeline.RefineSplit, Accepted: true, Topics: []int{2}, Result: []int{4, 2}, Sizes: []int{1, 1}},
+		}},
+		{"cohesive enough", 0.5, 4, [][]int{{1, 2, 3, 4}}, nil},
+		{"too few events", 0.8, 5, [][]int{{1, 2, 3, 4}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := RefineOption{SplitCohesion: tt.cohesion, MinSplitDocs: tt.minDocs}
+			var log pipeline.RefineLog
+			result := splitTopics([]pipeline.Topic{mixed}, splitVectors, opt, &log)
+			var got [][]int
+			for _, topic := range result {
+				got = append(got, topicIds(topic))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(log.Decisions) != len(tt.decisions) {
+				t.Fatalf("decisions = %+v, want %d", log.Decisions, len(tt.decisions))
+			}
+			for i, w := range tt.decisions {
+				g := log.Decisions[i]
+				if g.Action != w.Action || g.Accepted != w.Accepted || !reflect.DeepEqual(g.Topics, w.Topics) ||
+					!reflect.DeepEqual(g.Result, w.Result) || !reflect.DeepEqual(g.Sizes, w.Sizes) {
+					t.Errorf("decisions[%d] = %+v, want %+v", i, g, w)
+				}
+			}
+		})
+	}
+	// 同じ向きのイベントだけのトピックは、まとまりが低くても分けられないことを記録する
+	same := map[int]map[string]float64{1: {"x": 1}, 2: {"x": 2}}
+	var log pipeline.RefineLog
+	result := splitTopics([]pipeline.Topic{refineTopic(same, 1, 2)}, same, RefineOption{SplitCohesion: 2, MinSplitDocs: 2}, &log)
+	if len(result) != 1 || len(log.Decisions) != 1 || log.Decisions[0].Accepted {
+		t.Errorf("got %d topics and decisions %+v, want the topic kept with a rejected split", len(result), log.Decisions)
+	}
+}
+
+// topicIdsはトピックのイベントのIDを小さい順に戻す
+func topicIds(t pipeline.Topic) []int {
+	var ids []int
+	for id := range t.DocIds {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,37 @@
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"sort"
+	"time"
+)
+
+// WriteReportは分類したトピックごとに、イベントを日付の順に書き出す。
+// イベントの数がminDocsより少ないトピックは書き出さない。
+func WriteReport(w io.Writer, d pipeline.EventsDataJSON, topics pipeline.Topics, minDocs int) {
+	eventText := make(map[int]string)
+	for _, v := range d.Events {
+		eventText[v.Id] = v.Date + " - " + v.Text
+	}
+	for _, topic := range topics.Result {
+		if len(topic.DocIds) < minDocs {
+			continue
+		}
+		events := make([]string, 0)
+		for id := range topic.DocIds {
+			events = append(events, eventText[id])
+		}
+		sort.Slice(events, func(i, j int) bool {
+			dateI, _ := time.Parse("2006-01-02", events[i][:10])
+			dateJ, _ := time.Parse("2006-01-02", events[j][:10])
+			return dateI.Before(dateJ)
+		})
+		fmt.Fprintln(w, "・Topic")
+		for _, e := range events {
+			fmt.Fprintln(w, e)
+		}
+		fmt.Fprintln(w, "")
+	}
+}
@@ -0,0 +1,181 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+)
+
+// Vocabularyは単語（ベクトルの次元）に整数のIDを振る。同じ単語には同じIDを戻す。
+type Vocabulary struct {
+	ids   map[string]int32
+	terms []string
+}
+
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{ids: make(map[string]int32)}
+}
+
+// IDは単語のIDを戻す（初めての単語には新しいIDを振る）
+func (v *Vocabulary) ID(term string) int32 {
+	if id, found := v.ids[term]; found {
+		return id
+	}
+	id := int32(len(v.terms))
+	v.ids[term] = id
+	v.terms = append(v.terms, term)
+	return id
+}
+
+// Lookupは単語のIDを戻す。初めての単語にはIDを振らず、falseを戻す。
+func (v *Vocabulary) Lookup(term string) (int32, bool) {
+	id, found := v.ids[term]
+	return id, found
+}
+
+// TermはIDに対応する単語を戻す
+func (v *Vocabulary) Term(id int32) string {
+	return v.terms[id]
+}
+
+func (v *Vocabulary) Len() int {
+	return len(v.terms)
+}
+
+// SparseVectorは0でない値のみを、単語のIDの順に持つベクトル。長さは作る時に一度だけ計算する。
+type SparseVector struct {
+	Ids    []int32
+	Values []float64
+	norm   float64
+}
+
+// NewSparseVectorは単語をキーとするベクトルを、vocabでIDに置き換えて作る（0の値は除く）
+func NewSparseVector(vocab *Vocabulary, vec map[string]float64) SparseVector {
+	ids := make([]int32, 0, len(vec))
+	byId := make(map[int32]float64, len(vec))
+	for term, value := range vec {
+		if value == 0 {
+			continue
+		}
+		id := vocab.ID(term)
+		ids = append(ids, id)
+		byId[id] = value
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	s := SparseVector{Ids: ids, Values: make([]float64, len(ids))}
+	for i, id := range ids {
+		s.Values[i] = byId[id]
+		s.norm += byId[id] * byId[id]
+	}
+	s.norm = math.Sqrt(s.norm)
+	return s
+}
+
+// Normはベクトルの長さを戻す
+func (s SparseVector) Norm() float64 {
+	return s.norm
+}
+
+// Dotは内積を計算する（どちらもIDの順に並んでいるため、一度ずつ見るだけでよい）
+func (s SparseVector) Dot(o SparseVector) float64 {
+	var d float64
+	i, j := 0, 0
+	for i < len(s.Ids) && j < len(o.Ids) {
+		switch {
+		case s.Ids[i] < o.Ids[j]:
+			i++
+		case s.Ids[i] > o.Ids[j]:
+			j++
+		default:
+			d += s.Values[i] * o.Values[j]
+			i++
+			j++
+		}
+	}
+	return d
+}
+
+// Cosineはコサイン類似度を計算する（どちらかの長さが0の場合は0）
+func (s SparseVector) Cosine(o SparseVector) float64 {
+	if s.norm == 0 || o.norm == 0 {
+		return 0
+	}
+	return s.Dot(o) / (s.norm * o.norm)
+}
+
+// TopicIndexはトピックの重心を単語のIDで引けるようにしたもの（転置インデックス）。
+// 重心と単語を一つも共有しないトピックはコサイン類似度が0になるため、比べる必要がない。
+// 重心から消えた単語も索引には残すが、比べる相手が増えるだけで類似度は変わらない。
+type TopicIndex struct {
+	vocab     *Vocabulary
+	centroids []map[int32]float64
+	norms     []float64
+	// 単語のIDごとの、その単語を重心に含むトピック
+	postings map[int32][]int
+}
+
+func NewTopicIndex(vocab *Vocabulary) *TopicIndex {
+	return &TopicIndex{vocab: vocab, postings: make(map[int32][]int)}
+}
+
+// Lenは索引のトピックの数を戻す
+func (x *TopicIndex) Len() int {
+	return len(x.centroids)
+}
+
+// Addは新しいトピックの重心を索引に加え、トピックの番号を戻す
+func (x *TopicIndex) Add(center map[string]float64) int {
+	x.centroids = append(x.centroids, make(map[int32]float64, len(center)))
+	x.norms = append(x.norms, 0)
+	i := len(x.centroids) - 1
+	x.Update(i, center)
+	return i
+}
+
+// Updateはi番目のトピックの重心を置き換える
+func (x *TopicIndex) Update(i int, center map[string]float64) {
+	old := x.centroids[i]
+	c := make(map[int32]float64, len(center))
+	var norm float64
+	for term, value := range center {
+		if value == 0 {
+			continue
+		}
+		id := x.vocab.ID(term)
+		if _, found := old[id]; !found {
+			x.postings[id] = append(x.postings[id], i)
+		}
+		c[id] = value
+		norm += value * value
+	}
+	x.centroids[i] = c
+	x.norms[i] = math.Sqrt(norm)
+}
+
+// Candidatesはvと単語を共有するトピックの番号を、小さい順に戻す
+func (x *TopicIndex) Candidates(v SparseVector) []int {
+	seen := make(map[int]bool)
+	var candidates []int
+	for _, id := range v.Ids {
+		for _, i := range x.postings[id] {
+			if !seen[i] {
+				seen[i] = true
+				candidates = append(candidates, i)
+			}
+		}
+	}
+	sort.Ints(candidates)
+	return candidates
+}
+
+// Cosineはi番目のトピックの重心とvのコサイン類似度を計算する
+func (x *TopicIndex) Cosine(i int, v SparseVector) float64 {
+	if x.norms[i] == 0 || v.norm == 0 {
+		return 0
+	}
+	c := x.centroids[i]
+	var d float64
+	for k, id := range v.Ids {
+		d += v.Values[k] * c[id]
+	}
+	return d / (x.norms[i] * v.norm)
+}
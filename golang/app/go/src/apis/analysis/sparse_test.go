@@ -0,0 +1,144 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// syntheticEventsは、いくつかの話題の単語と共通の単語を混ぜた人工的なイベントを、新しい順にn件作る（1年分に散らばる）
+func syntheticEvents(n int, seed int64) (pipeline.EventsDataJSON, map[int]map[string]float64) {
+	rng := rand.New(rand.NewSource(seed))
+	const vocab = 20000
+	topics := n/20 + 1
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion}
+	vectors := make(map[int]map[string]float64, n)
+	for i := 0; i < n; i++ {
+		id := i + 1
+		topic := rng.Intn(topics)
+		vec := make(map[string]float64)
+		for j := 0; j < 6; j++ {
+			vec[fmt.Sprint(topic*8+rng.Intn(8))] += 0.5 + rng.Float64()
+		}
+		for j := 0; j < 6; j++ {
+			vec[fmt.Sprint(rng.Intn(vocab))] += 0.2 * rng.Float64()
+		}
+		vectors[id] = vec
+		d.Events = append(d.Events, pipeline.EventData{
+			Id:      id,
+			Date:    start.AddDate(0, 0, 364-i*365/n).Format("2006-01-02"),
+			Entropy: 1 + rng.Float64(),
+		})
+	}
+	return d, vectors
+}
+
+// samePartitionは二つの分類結果が、同じイベントを同じ順番のトピックに分けているかどうかを戻す
+func samePartition(a, b []pipeline.Topic) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i].DocIds) != len(b[i].DocIds) {
+			return false
+		}
+		for id := range a[i].DocIds {
+			if _, found := b[i].DocIds[id]; !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSinglePassIndexMatchesScan(t *testing.T) {
+	d, vectors := syntheticEvents(1000, 1)
+	for _, threshold := range []float64{0.2, 0.35, 0.6} {
+		t.Run(fmt.Sprint(threshold), func(t *testing.T) {
+			scan, err := SinglePass{Threshold: threshold, Scan: true}.Cluster(d, vectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			index, err := SinglePass{Threshold: threshold}.Cluster(d, vectors)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !samePartition(scan, index) {
+				t.Errorf("scan found %d topics and index found %d, or they differ", len(scan), len(index))
+			}
+		})
+	}
+}
+
+func TestSparseCosineMatchesMaps(t *testing.T) {
+	_, vectors := syntheticEvents(200, 2)
+	ids := make([]int, 0, len(vectors))
+	for id := range vectors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	vocab := NewVocabulary()
+	sparse := make(map[int]SparseVector, len(ids))
+	for _, id := range ids {
+		sparse[id] = NewSparseVector(vocab, vectors[id])
+	}
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			want := CulcCosSim(vectors[a], vectors[b])
+			if got := sparse[a].Cosine(sparse[b]); math.Abs(got-want) > 1e-12 {
+				t.Fatalf("cosine of %d and %d = %v, want %v", a, b, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkSinglePass(b *testing.B) {
+	for _, n := range []int{1000, 5000} {
+		d, vectors := syntheticEvents(n, 1)
+		for _, scan := range []bool{true, false} {
+			name := "index"
+			if scan {
+				name = "scan"
+			}
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				c := SinglePass{Threshold: DefaultClusterOption().Threshold, Scan: scan}
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Cluster(d, vectors); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// 同じイベントの組みで、コサイン類似度の計算をmapとSparseVectorで比べる
+func BenchmarkCosine(b *testing.B) {
+	_, vectors := syntheticEvents(1000, 1)
+	ids := make([]int, 0, len(vectors))
+	for id := range vectors {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			CulcCosSim(vectors[ids[i%len(ids)]], vectors[ids[(i*7+1)%len(ids)]])
+		}
+	})
+	b.Run("sparse", func(b *testing.B) {
+		vocab := NewVocabulary()
+		sparse := make([]SparseVector, len(ids))
+		for i, id := range ids {
+			sparse[i] = NewSparseVector(vocab, vectors[id])
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sparse[i%len(sparse)].Cosine(sparse[(i*7+1)%len(sparse)])
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package analysis
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"main/apis/pipeline"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// イベントを分類する順番
+const (
+	OrderDesc = "desc"
+	OrderAsc  = "asc"
+)
+
+// SweepGridはClassificationを試す設定の組み合わせ（全ての組み合わせを試す）
+type SweepGrid struct {
+	Vectorizers []string
+	Thresholds  []float64
+	// 情報エントロピーの制約の確かめ方（strict, tolerance, trend, off）と、許容する幅
+	Constraints []string
+	Epsilon     float64
+	// イベントを分類する順番（desc, asc）
+	Orders []string
+}
+
+// SweepConfigは一つの設定
+type SweepConfig struct {
+	Vectorizer string  `json:"vectorizer"`
+	Threshold  float64 `json:"threshold"`
+	Constraint string  `json:"constraint"`
+	Order      string  `json:"order"`
+}
+
+// SweepResultは一つの設定で分類したトピックの評価
+type SweepResult struct {
+	Rank   int          `json:"rank"`
+	Config SweepConfig  `json:"config"`
+	Topics int          `json:"topics"`
+	Metric float64      `json:"metric"`
+	Score  ClusterScore `json:"score"`
+}
+
+// Sweepはgridの全ての設定でClassificationを行い、イベントの見出しを正解として評価する。
+// 結果はmetricの高い順に並べて、最も高い設定で分類したトピックと共に戻す。
+func Sweep(d pipeline.EventsDataJSON, grid SweepGrid, label, metric string) ([]SweepResult, []pipeline.Topic, error) {
+	if _, err := (ClusterScore{}).Metric(metric); err != nil {
+		return nil, nil, err
+	}
+	for _, mode := range grid.Constraints {
+		if err := (EntropyConstraint{Mode: mode, Epsilon: grid.Epsilon}).Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, order := range grid.Orders {
+		if order != OrderDesc && order != OrderAsc {
+			return nil, nil, fmt.Errorf("unknown order: %s (%s, %s)", order, OrderDesc, OrderAsc)
+		}
+	}
+	// 並べ替えても元のイベントデータが変わらないよう、順番ごとに写しを作る
+	ordered := make(map[string]pipeline.EventsDataJSON)
+	for _, order := range grid.Orders {
+		c := d
+		c.Events = append([]pipeline.EventData(nil), d.Events...)
+		if order == OrderAsc {
+			SortByDateAsc(&c)
+		} else {
+			SortByDateDesc(&c)
+		}
+		ordered[order] = c
+	}
+	var results []SweepResult
+	var best []pipeline.Topic
+	bestMetric := -1.0
+	for _, name := range grid.Vectorizers {
+		vectorizer, err := NewVectorizer(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		// ベクトルはイベントの順番によらないため、ベクトルの作り方ごとに一度だけ作る
+		vectors, err := vectorizer.Vectorize(d)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, threshold := range grid.Thresholds {
+			for _, mode := range grid.Constraints {
+				for _, order := range grid.Orders {
+					config := SweepConfig{Vectorizer: name, Threshold: threshold, Constraint: mode, Order: order}
+					constraint := EntropyConstraint{Mode: mode, Epsilon: grid.Epsilon}
+					topics, err := SinglePass{Threshold: threshold, Constraint: constraint}.Cluster(ordered[order], vectors)
+					if err != nil {
+						return nil, nil, err
+					}
+					ev := EvaluateTopics(d, pipeline.Topics{Result: topics}, label)
+					m, _ := ev.Overall.Metric(metric)
+					results = append(results, SweepResult{Config: config, Topics: len(topics), Metric: m, Score: ev.Overall})
+					if m > bestMetric {
+						best, bestMetric = topics, m
+					}
+				}
+			}
+		}
+	}
+	// 同じ値の場合は試した順のままにする
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Metric > results[j].Metric })
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+	return results, best, nil
+}
+
+// WriteSweepCsvは結果を順位表としてCSVでファイルに書き出す
+func WriteSweepCsv(path string, results []SweepResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := append([]string{"rank", "vectorizer", "threshold", "constraint", "order", "topics", "metric", "events", "clusters", "labels"}, MetricNames...)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+	for _, r := range results {
+		row := []string{
+			strconv.Itoa(r.Rank), r.Config.Vectorizer, format(r.Config.Threshold), r.Config.Constraint, r.Config.Order,
+			strconv.Itoa(r.Topics), format(r.Metric), strconv.Itoa(r.Score.Events), strconv.Itoa(r.Score.Clusters), strconv.Itoa(r.Score.Labels),
+		}
+		for _, name := range MetricNames {
+			v, _ := r.Score.Metric(name)
+			row = append(row, format(v))
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteSweepJsonは結果を順位表としてJSONでファイルに書き出す
+func WriteSweepJson(path string, results []SweepResult) error {
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,155 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"sort"
+	"time"
+)
+
+// Trackerはトピックの分類に加えて、トピックが生まれてから終わるまでの変化を記録するClusterer
+type Tracker interface {
+	Clusterer
+	Track(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, pipeline.Lifecycle, error)
+}
+
+// ClusterAndTrackはcでトピックを分類する。cがTrackerの場合は、トピックの変化の記録も戻す（そうでない場合は空の記録）。
+func ClusterAndTrack(c Clusterer, d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, pipeline.Lifecycle, error) {
+	if t, ok := c.(Tracker); ok {
+		return t.Track(d, vectors)
+	}
+	topics, err := c.Cluster(d, vectors)
+	return topics, pipeline.Lifecycle{}, err
+}
+
+// TDTはイベントを日付の古い順に一つずつ処理し、トピックを検出して追跡する（Topic Detection and Tracking）。
+// 最後にイベントが加わってからWindow日を過ぎたトピックは終わり（dormant）、以降のイベントは加えない。
+// 続いているトピックのいずれともコサイン類似度がThreshold以下のイベントは、新しいトピックの最初の記事とする。
+// MergeThresholdが0より大きい場合は、イベントを加えたトピックの重心と類似度がそれ以上の続いているトピックをまとめる。
+// 記録では、トピックを最初のイベントのIDで表す（まとめられなかったトピックは、そのイベントを含むtopics.jsonのトピックになる）。
+type TDT struct {
+	Threshold      float64
+	Window         int
+	MergeThreshold float64
+}
+
+func (TDT) Name() string { return "tdt" }
+
+func (c TDT) Cluster(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, error) {
+	topics, _, err := c.Track(d, vectors)
+	return topics, err
+}
+
+// tdtTopicは処理中のトピック。idは最初のイベントのID、orderは生まれた順番。
+type tdtTopic struct {
+	topic  pipeline.Topic
+	id     int
+	order  int
+	last   time.Time
+	active bool
+	merged bool
+}
+
+func (c TDT) Track(d pipeline.EventsDataJSON, vectors map[int]map[string]float64) ([]pipeline.Topic, pipeline.Lifecycle, error) {
+	type dated struct {
+		event pipeline.EventData
+		date  time.Time
+	}
+	events := make([]dated, len(d.Events))
+	for i, e := range d.Events {
+		date, err := time.Parse("2006-01-02", e.Date)
+		if err != nil {
+			return nil, pipeline.Lifecycle{}, err
+		}
+		events[i] = dated{event: e, date: date}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].date.Equal(events[j].date) {
+			return events[i].date.Before(events[j].date)
+		}
+		return events[i].event.Id < events[j].event.Id
+	})
+	window := time.Duration(c.Window) * 24 * time.Hour
+	var topics []*tdtTopic
+	var lifecycle pipeline.Lifecycle
+	record := func(e pipeline.TopicEvent) {
+		lifecycle.Events = append(lifecycle.Events, e)
+	}
+	for _, v := range events {
+		e, date := v.event, v.date
+		// 期間を過ぎたトピックを、終わった日付の順に終わらせる
+		var dormant []*tdtTopic
+		for _, t := range topics {
+			if t.active && date.Sub(t.last) > window {
+				t.active = false
+				dormant = append(dormant, t)
+			}
+		}
+		sort.SliceStable(dormant, func(i, j int) bool { return dormant[i].last.Before(dormant[j].last) })
+		for _, t := range dormant {
+			record(pipeline.TopicEvent{Type: pipeline.TopicDormant, Topic: t.id, Date: t.last.Add(window).Format("2006-01-02")})
+		}
+		var best *tdtTopic
+		bestSim := 0.0
+		for _, t := range topics {
+			if !t.active {
+				continue
+			}
+			if s := cosine(vectors[e.Id], t.topic.CenterGravity); best == nil || s > bestSim {
+				best, bestSim = t, s
+			}
+		}
+		doc := pipeline.Document{Date: date, Entropy: e.Entropy}
+		if best == nil || bestSim <= c.Threshold {
+			t := &tdtTopic{topic: pipeline.NewTopic(e.Id, doc, vectors[e.Id]), id: e.Id, order: len(topics), last: date, active: true}
+			topics = append(topics, t)
+			record(pipeline.TopicEvent{Type: pipeline.TopicBorn, Topic: t.id, Date: e.Date, EventId: e.Id, Novelty: 1 - bestSim})
+			continue
+		}
+		best.topic.DocIds[e.Id] = doc
+		best.topic.CulcCenterOfGravity(vectors[e.Id])
+		best.last = date
+		record(pipeline.TopicEvent{Type: pipeline.TopicUpdated, Topic: best.id, Date: e.Date, EventId: e.Id, Similarity: bestSim})
+		if c.MergeThreshold <= 0 {
+			continue
+		}
+		// 重心が近づいたトピックをまとめる（新しく生まれた方を古い方にまとめる）
+		for _, o := range topics {
+			if o == best || !o.active {
+				continue
+			}
+			s := cosine(best.topic.CenterGravity, o.topic.CenterGravity)
+			if s < c.MergeThreshold {
+				continue
+			}
+			into, from := best, o
+			if from.order < into.order {
+				into, from = from, into
+			}
+			into.topic.Merge(from.topic)
+			if from.last.After(into.last) {
+				into.last = from.last
+			}
+			from.active = false
+			from.merged = true
+			record(pipeline.TopicEvent{Type: pipeline.TopicMerged, Topic: from.id, Date: e.Date, Similarity: s, Into: into.id})
+			best = into
+		}
+	}
+	var result []pipeline.Topic
+	for _, t := range topics {
+		if !t.merged {
+			result = append(result, t.topic)
+		}
+	}
+	return result, lifecycle, nil
+}
+
+// cosineは二つのベクトルのコサイン類似度を計算する（どちらかの長さが0の場合は0）
+func cosine(a, b map[string]float64) float64 {
+	la, lb := math.Sqrt(dot(a, a)), math.Sqrt(dot(b, b))
+	if la == 0 || lb == 0 {
+		return 0
+	}
+	return dot(a, b) / (la * lb)
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// tdtEventsは、1と2から生まれた二つのトピックが3でまとまり、4が別のトピックになり、
+// 期間が過ぎて全て終わった後に5が新しいトピックになるイベント（処理する順番と逆に並べる）
+func tdtEvents() (pipeline.EventsDataJSON, map[int]map[string]float64) {
+	d := pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion, Events: []pipeline.EventData{
+		{Id: 5, Date: "2022-01-09", Entropy: 1},
+		{Id: 4, Date: "2022-01-03", Entropy: 1},
+		{Id: 3, Date: "2022-01-02", Entropy: 1},
+		{Id: 2, Date: "2022-01-01", Entropy: 1},
+		{Id: 1, Date: "2022-01-01", Entropy: 1},
+	}}
+	vectors := map[int]map[string]float64{
+		1: {"x": 1},
+		2: {"x": 1, "y": 0.6},
+		3: {"x": 1, "y": 0.4},
+		4: {"z": 1},
+		5: {"z": 1},
+	}
+	return d, vectors
+}
+
+func TestTDTLifecycle(t *testing.T) {
+	d, vectors := tdtEvents()
+	topics, lifecycle, err := TDT{Threshold: 0.9, Window: 3, MergeThreshold: 0.8}.Track(d, vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pipeline.TopicEvent{
+		{Type: pipeline.TopicBorn, Topic: 1, Date: "2022-01-01", EventId: 1, Novelty: 1},
+		// 1との類似度は1/sqrt(1.36)で、閾値以下のため新しいトピックにする
+		{Type: pipeline.TopicBorn, Topic: 2, Date: "2022-01-01", EventId: 2, Novelty: 1 - 1/math.Sqrt(1.36)},
+		{Type: pipeline.TopicUpdated, Topic: 2, Date: "2022-01-02", EventId: 3, Similarity: 1.24 / math.Sqrt(1.16*1.36)},
+		// 2の重心は{x: 1, y: 0.5}になり、1と似るため古い方の1にまとめる
+		{Type: pipeline.TopicMerged, Topic: 2, Date: "2022-01-02", Similarity: 1 / math.Sqrt(1.25), Into: 1},
+		{Type: pipeline.TopicBorn, Topic: 4, Date: "2022-01-03", EventId: 4, Novelty: 1},
+		// 最後にイベントが加わった日（1は2022-01-02、4は2022-01-03）から3日を過ぎて終わる
+		{Type: pipeline.TopicDormant, Topic: 1, Date: "2022-01-05"},
+		{Type: pipeline.TopicDormant, Topic: 4, Date: "2022-01-06"},
+		// 続いているトピックがないため、新しさは1
+		{Type: pipeline.TopicBorn, Topic: 5, Date: "2022-01-09", EventId: 5, Novelty: 1},
+	}
+	if len(lifecycle.Events) != len(want) {
+		t.Fatalf("got %d lifecycle events %+v, want %d", len(lifecycle.Events), lifecycle.Events, len(want))
+	}
+	for i, w := range want {
+		g := lifecycle.Events[i]
+		if g.Type != w.Type || g.Topic != w.Topic || g.Date != w.Date || g.EventId != w.EventId || g.Into != w.Into ||
+			math.Abs(g.Novelty-w.Novelty) > 1e-12 || math.Abs(g.Similarity-w.Similarity) > 1e-12 {
+			t.Errorf("events[%d] = %+v, want %+v", i, g, w)
+		}
+	}
+	lifecycle.SchemaVersion = pipeline.LifecycleSchemaVersion
+	if err := lifecycle.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// まとめられたトピックは結果に含めず、残りのトピックは最初のイベントを含む
+	if got, want := partition(t, d, topics), [][]int{{1, 2, 3}, {4}, {5}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i, id := range []int{1, 4, 5} {
+		if _, found := topics[i].DocIds[id]; !found {
+			t.Errorf("topics[%d] does not contain the first event %d of the lifecycle topic %d", i, id, id)
+		}
+	}
+}
+
+func TestTDTWindow(t *testing.T) {
+	d := pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion, Events: []pipeline.EventData{
+		{Id: 1, Date: "2022-01-01", Entropy: 1},
+		{Id: 2, Date: "2022-01-04", Entropy: 1},
+		{Id: 3, Date: "2022-01-08", Entropy: 1},
+	}}
+	vectors := map[int]map[string]float64{1: {"x": 1}, 2: {"x": 1}, 3: {"x": 1}}
+	topics, lifecycle, err := TDT{Threshold: 0.5, Window: 3}.Track(d, vectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ちょうど3日後の2は加え、その4日後の3は終わったトピックに加えない
+	if got, want := partition(t, d, topics), [][]int{{1, 2}, {3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var types []string
+	for _, e := range lifecycle.Events {
+		types = append(types, e.Type+" "+e.Date)
+	}
+	want := []string{"born 2022-01-01", "updated 2022-01-04", "dormant 2022-01-07", "born 2022-01-08"}
+	if !reflect.DeepEqual(types, want) {
+		t.Errorf("got %v, want %v", types, want)
+	}
+}
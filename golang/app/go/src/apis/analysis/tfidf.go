@@ -0,0 +1,270 @@
+package analysis
+
+import (
+	"main/apis/pipeline"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Python側（python3/main.py）と同じストップワード
+var enStopList = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`i me my myself we our ours ourselves you your yours
+		yourself yourselves he him his himself she her hers herself
+		it its itself they them their theirs themselves what which
+		who whom this that these those am is are was were be
+		been being have has had having do does did doing a an
+		the and but if or because as until while of at by for
+		with about against between into through during before after
+		above below to from up down in out on off over under
+		again further then once here there when where why how all
+		any both each few more most other some such no nor not
+		only own same so than too very s t can will just don
+		should now`) {
+		enStopList[w] = true
+	}
+}
+
+// PythonのRegexpTokenizer(r'\w+')と同じく、Unicodeの文字と数字、「_」の並びを単語とする
+var tokenPattern = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// Tokenizeは文字列を小文字にして単語に分け、ストップワードを取り除いてステミングする
+func Tokenize(text string) []string {
+	words := tokenPattern.FindAllString(strings.ToLower(strings.TrimSpace(text)), -1)
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if enStopList[w] {
+			continue
+		}
+		tokens = append(tokens, PorterStem(w))
+	}
+	return tokens
+}
+
+// TfIdfOptionはTF-IDFの計算方法を指定する。
+// DefaultTfIdfOptionはPython側（gensimのTfidfModelの初期値）と同じ計算になる。
+type TfIdfOption struct {
+	// コーパス全体での出現回数がMinFreq以下の単語は取り除く
+	MinFreq int
+	// 出現する文書数がNoBelowより少ない単語と、文書全体のNoAboveの割合より多い単語は取り除く
+	NoBelow int
+	NoAbove float64
+	// 文書数の多い順にKeepN個までの単語を残す
+	KeepN int
+	// trueの場合、TFを1+log2(tf)にする
+	Sublinear bool
+	// trueの場合、IDFをlog2((1+N)/(1+df))+1にする（falseの場合はlog2(N/df)）
+	Smooth bool
+	// trueの場合、文書ごとにベクトルの長さを1にする
+	Normalize bool
+}
+
+func DefaultTfIdfOption() TfIdfOption {
+	return TfIdfOption{
+		MinFreq:   5,
+		NoBelow:   2,
+		NoAbove:   0.8,
+		KeepN:     100000,
+		Sublinear: false,
+		Smooth:    false,
+		Normalize: true,
+	}
+}
+
+// Dictionaryは単語とIDの対応と、各単語が出現する文書数を保持する。
+// IDの振り方はgensimのDictionaryと同じにしている。
+type Dictionary struct {
+	Token2Id map[string]int
+	Id2Token []string
+	Dfs      []int
+	NumDocs  int
+}
+
+// BowEntryは単語のIDと出現回数の組み
+type BowEntry struct {
+	Id    int
+	Count int
+}
+
+// Bowは文書のBag of Words（IDの昇順に並ぶ）
+type Bow []BowEntry
+
+// BuildCorpusは文書ごとの単語の並びから辞書を作り、文書ごとのBag of Wordsを戻す
+func BuildCorpus(docs [][]string, opt TfIdfOption) (Dictionary, []Bow) {
+	// 出現回数がMinFreq以下の単語を取り除く
+	frequency := make(map[string]int)
+	for _, tokens := range docs {
+		for _, t := range tokens {
+			frequency[t]++
+		}
+	}
+	filtered := make([][]string, len(docs))
+	for i, tokens := range docs {
+		for _, t := range tokens {
+			if frequency[t] > opt.MinFreq {
+				filtered[i] = append(filtered[i], t)
+			}
+		}
+	}
+	// 文書ごとに、新しい単語へ辞書順にIDを振る（gensimのdoc2bowと同じ）
+	token2id := make(map[string]int)
+	var dfs []int
+	for _, tokens := range filtered {
+		uniq := uniqueSorted(tokens)
+		for _, t := range uniq {
+			if _, found := token2id[t]; !found {
+				token2id[t] = len(token2id)
+				dfs = append(dfs, 0)
+			}
+			dfs[token2id[t]]++
+		}
+	}
+	// 出現する文書数が極端な単語を取り除き、残った単語のIDを詰める（gensimのfilter_extremes）
+	noAboveAbs := int(opt.NoAbove * float64(len(docs)))
+	var goodIds []int
+	for id, df := range dfs {
+		if opt.NoBelow <= df && df <= noAboveAbs {
+			goodIds = append(goodIds, id)
+		}
+	}
+	sort.SliceStable(goodIds, func(i, j int) bool { return dfs[goodIds[i]] > dfs[goodIds[j]] })
+	if opt.KeepN > 0 && len(goodIds) > opt.KeepN {
+		goodIds = goodIds[:opt.KeepN]
+	}
+	sort.Ints(goodIds)
+	dict := Dictionary{Token2Id: make(map[string]int), NumDocs: len(docs)}
+	id2token := make([]string, len(dfs))
+	for t, id := range token2id {
+		id2token[id] = t
+	}
+	for newId, oldId := range goodIds {
+		t := id2token[oldId]
+		dict.Token2Id[t] = newId
+		dict.Id2Token = append(dict.Id2Token, t)
+		dict.Dfs = append(dict.Dfs, dfs[oldId])
+	}
+	corpus := make([]Bow, len(docs))
+	for i, tokens := range filtered {
+		corpus[i] = dict.Doc2Bow(tokens)
+	}
+	return dict, corpus
+}
+
+// Doc2Bowは辞書にある単語の出現回数を数える
+func (d Dictionary) Doc2Bow(tokens []string) Bow {
+	counts := make(map[int]int)
+	for _, t := range tokens {
+		if id, found := d.Token2Id[t]; found {
+			counts[id]++
+		}
+	}
+	bow := make(Bow, 0, len(counts))
+	for id, c := range counts {
+		bow = append(bow, BowEntry{Id: id, Count: c})
+	}
+	sort.Slice(bow, func(i, j int) bool { return bow[i].Id < bow[j].Id })
+	return bow
+}
+
+func uniqueSorted(tokens []string) []string {
+	seen := make(map[string]bool)
+	var uniq []string
+	for _, t := range tokens {
+		if !seen[t] {
+			seen[t] = true
+			uniq = append(uniq, t)
+		}
+	}
+	sort.Strings(uniq)
+	return uniq
+}
+
+// Idfは単語ごとのIDFを戻す
+func (d Dictionary) Idf(opt TfIdfOption) []float64 {
+	idfs := make([]float64, len(d.Dfs))
+	n := float64(d.NumDocs)
+	for id, df := range d.Dfs {
+		if opt.Smooth {
+			idfs[id] = math.Log2((1+n)/(1+float64(df))) + 1
+		} else {
+			idfs[id] = math.Log2(n / float64(df))
+		}
+	}
+	return idfs
+}
+
+// TfIdfVectorはBag of WordsをTF-IDFのベクトル（キーは単語のID）にする
+func TfIdfVector(bow Bow, idfs []float64, opt TfIdfOption) map[string]float64 {
+	vec := make(map[string]float64)
+	var norm float64
+	for _, b := range bow {
+		if idfs[b.Id] == 0 {
+			continue
+		}
+		tf := float64(b.Count)
+		if opt.Sublinear {
+			tf = 1 + math.Log2(tf)
+		}
+		w := tf * idfs[b.Id]
+		vec[strconv.Itoa(b.Id)] = w
+		norm += w * w
+	}
+	if opt.Normalize && norm > 0 {
+		norm = math.Sqrt(norm)
+		for k, v := range vec {
+			vec[k] = v / norm
+			// gensimと同じく、ほぼ0の値は取り除く
+			if math.Abs(vec[k]) <= 1e-12 {
+				delete(vec, k)
+			}
+		}
+	}
+	return vec
+}
+
+// SetTfIdfは全てのイベントの本文からTF-IDFを計算して、各イベントのTfIdfに設定する。
+// Pythonを使わずに、Python側と同じ計算を行う。
+func SetTfIdf(d *pipeline.EventsDataJSON, opt TfIdfOption) Dictionary {
+	docs := make([][]string, len(d.Events))
+	for i, e := range d.Events {
+		docs[i] = Tokenize(e.Text)
+	}
+	dict, corpus := BuildCorpus(docs, opt)
+	idfs := dict.Idf(opt)
+	for i := range d.Events {
+		d.Events[i].TfIdf = TfIdfVector(corpus[i], idfs, opt)
+	}
+	return dict
+}
+
+// CompareTfIdfは二つのイベントデータのTF-IDFを比べて、値の差の最大値と、一致しなかったイベントの数を戻す。
+// Python側の計算結果と一致するかどうかの確認に用いる。
+func CompareTfIdf(a, b pipeline.EventsDataJSON, tolerance float64) (float64, int) {
+	byId := make(map[int]map[string]float64)
+	for _, e := range b.Events {
+		byId[e.Id] = e.TfIdf
+	}
+	maxDiff := 0.0
+	mismatched := 0
+	for _, e := range a.Events {
+		other := byId[e.Id]
+		ok := len(other) == len(e.TfIdf)
+		for k, v := range e.TfIdf {
+			diff := math.Abs(v - other[k])
+			if diff > maxDiff {
+				maxDiff = diff
+			}
+			if diff > tolerance {
+				ok = false
+			}
+		}
+		if !ok {
+			mismatched++
+		}
+	}
+	return maxDiff, mismatched
+}
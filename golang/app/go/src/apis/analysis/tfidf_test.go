@@ -0,0 +1,59 @@
+package analysis
+
+import (
+	"encoding/json"
+	"main/apis/pipeline"
+	"math"
+	"os"
+	"testing"
+)
+
+// gensimの計算結果との差の許容値
+const tfidfTolerance = 1e-9
+
+// testdata/tfidf_gensim.jsonはpython3/tfidf_fixture.pyで書き出したもの（POST /tfidfのレスポンスと同じ形式）
+type gensimResults struct {
+	Results []struct {
+		Id    int                `json:"id"`
+		TfIdf map[string]float64 `json:"tf_idf"`
+	} `json:"results"`
+}
+
+func TestSetTfIdfMatchesGensim(t *testing.T) {
+	d, err := pipeline.ReadEvents("testdata/tfidf_events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile("testdata/tfidf_gensim.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want gensimResults
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatal(err)
+	}
+	SetTfIdf(&d, DefaultTfIdfOption())
+	got := make(map[int]map[string]float64)
+	for _, e := range d.Events {
+		got[e.Id] = e.TfIdf
+	}
+	if len(want.Results) != len(d.Events) {
+		t.Fatalf("the fixture has %d results for %d events", len(want.Results), len(d.Events))
+	}
+	for _, r := range want.Results {
+		vec, found := got[r.Id]
+		if !found {
+			t.Errorf("event %d: no tf_idf", r.Id)
+			continue
+		}
+		if len(vec) != len(r.TfIdf) {
+			t.Errorf("event %d: got %d terms %v, want %d terms %v", r.Id, len(vec), vec, len(r.TfIdf), r.TfIdf)
+			continue
+		}
+		for k, w := range r.TfIdf {
+			if v, found := vec[k]; !found || math.Abs(v-w) > tfidfTolerance {
+				t.Errorf("event %d: tf_idf[%s] = %v, want %v", r.Id, k, v, w)
+			}
+		}
+	}
+}
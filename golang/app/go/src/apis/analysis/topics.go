@@ -0,0 +1,66 @@
+package analysis
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// SortByDateDescはイベントを新しい順に並び替える
+func SortByDateDesc(d *pipeline.EventsDataJSON) {
+	sort.SliceStable(d.Events, func(i, j int) bool {
+		dateI, _ := time.Parse("2006-01-02", d.Events[i].Date)
+		dateJ, _ := time.Parse("2006-01-02", d.Events[j].Date)
+		return dateI.After(dateJ)
+	})
+}
+
+// SortByDateAscはイベントを古い順に並び替える
+func SortByDateAsc(d *pipeline.EventsDataJSON) {
+	sort.SliceStable(d.Events, func(i, j int) bool {
+		dateI, _ := time.Parse("2006-01-02", d.Events[i].Date)
+		dateJ, _ := time.Parse("2006-01-02", d.Events[j].Date)
+		return dateI.Before(dateJ)
+	})
+}
+
+// 類似度によるトピックの分類
+// vectorsはVectorizerで作ったイベントごとのベクトル、a（0〜1で指定）をコサイン類似度の閾値とする
+// トピックの重心は、トピックに含まれるイベントのベクトルの平均とする
+func Classification(d pipeline.EventsDataJSON, vectors map[int]map[string]float64, a float64) []pipeline.Topic {
+	return ClassificationDecay(d, vectors, a, 0)
+}
+
+// ClassificationDecayはClassificationと同じく分類するが、decay（0〜1）が0より大きい場合は、
+// トピックの重心を平均ではなく、イベントを足すたびにdecayの割合だけ近づける（新しく足したイベントほど重く扱う）
+func ClassificationDecay(d pipeline.EventsDataJSON, vectors map[int]map[string]float64, a, decay float64) []pipeline.Topic {
+	topics, err := SinglePass{Threshold: a, Decay: decay}.Cluster(d, vectors)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return []pipeline.Topic{}
+	}
+	return topics
+}
+
+// 二つのベクトルのコサイン類似度を計算
+func CulcCosSim(n, m map[string]float64) float64 {
+	length := func(n map[string]float64) float64 {
+		var l float64
+		for _, vN := range n {
+			l += vN * vN
+		}
+		l = math.Sqrt(l)
+		return l
+	}
+	var d float64
+	for kN, vN := range n {
+		if vM, found := m[kN]; found {
+			d += vN * vM
+		}
+	}
+	l := length(n) * length(m)
+	return d / l
+}
@@ -0,0 +1,224 @@
+package analysis
+
+import (
+	"fmt"
+	"hash/fnv"
+	"main/apis/pipeline"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Vectorizerはイベントの本文などから、トピックの分類に用いるベクトルを作る。
+// 戻り値のキーはイベントのID、ベクトルのキーは特徴量の名前（単語のIDなど）。
+type Vectorizer interface {
+	Name() string
+	Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error)
+}
+
+// VectorizerNamesはNewVectorizerで指定できる名前
+var VectorizerNames = []string{"tfidf", "bm25", "entities", "ngram", "lsi"}
+
+// NewVectorizerは名前に対応するVectorizerを初期値で戻す
+func NewVectorizer(name string) (Vectorizer, error) {
+	switch name {
+	case "tfidf":
+		return PrecomputedTfIdf{}, nil
+	case "bm25":
+		return DefaultBM25(), nil
+	case "entities":
+		return EntityBag{}, nil
+	case "ngram":
+		return DefaultHashedNgram(), nil
+	case "lsi":
+		return DefaultLsi(), nil
+	}
+	return nil, fmt.Errorf("unknown vectorizer: %s (%s)", name, strings.Join(VectorizerNames, ", "))
+}
+
+// PrecomputedTfIdfはtoPyで計算済みのTF-IDFをそのまま用いる
+type PrecomputedTfIdf struct{}
+
+func (PrecomputedTfIdf) Name() string { return "tfidf" }
+
+func (PrecomputedTfIdf) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	for _, e := range d.Events {
+		if e.TfIdf == nil {
+			vectors[e.Id] = map[string]float64{}
+			continue
+		}
+		vectors[e.Id] = e.TfIdf
+	}
+	return vectors, nil
+}
+
+// BM25はTF-IDFと同じ辞書を用い、BM25で単語を重み付けする
+type BM25 struct {
+	Option TfIdfOption
+	K1     float64
+	B      float64
+}
+
+func DefaultBM25() BM25 {
+	return BM25{Option: DefaultTfIdfOption(), K1: 1.2, B: 0.75}
+}
+
+func (BM25) Name() string { return "bm25" }
+
+func (v BM25) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	docs := make([][]string, len(d.Events))
+	for i, e := range d.Events {
+		docs[i] = Tokenize(e.Text)
+	}
+	dict, corpus := BuildCorpus(docs, v.Option)
+	n := float64(dict.NumDocs)
+	idfs := make([]float64, len(dict.Dfs))
+	for id, df := range dict.Dfs {
+		idfs[id] = math.Log((n-float64(df)+0.5)/(float64(df)+0.5) + 1)
+	}
+	lengths := make([]float64, len(corpus))
+	var avgLen float64
+	for i, bow := range corpus {
+		for _, b := range bow {
+			lengths[i] += float64(b.Count)
+		}
+		avgLen += lengths[i]
+	}
+	if len(corpus) > 0 {
+		avgLen /= float64(len(corpus))
+	}
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	for i, e := range d.Events {
+		vec := make(map[string]float64)
+		norm := 1.0
+		if avgLen > 0 {
+			norm = 1 - v.B + v.B*lengths[i]/avgLen
+		}
+		for _, b := range corpus[i] {
+			tf := float64(b.Count)
+			vec[strconv.Itoa(b.Id)] = idfs[b.Id] * tf * (v.K1 + 1) / (tf + v.K1*norm)
+		}
+		vectors[e.Id] = normalize(vec)
+	}
+	return vectors, nil
+}
+
+// EntityBagはTagMeで抽出したエンティティだけを用いる。
+// エンティティは記事ID（不明な場合は記事名）で識別し、出所の記録がない古いデータでは語句で識別する。
+// 各エンティティは、出現するイベントの数から求めたIDFで重み付けする。
+type EntityBag struct{}
+
+func (EntityBag) Name() string { return "entities" }
+
+func (EntityBag) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	bags := make([]map[string]float64, len(d.Events))
+	dfs := make(map[string]int)
+	for i, e := range d.Events {
+		bags[i] = make(map[string]float64)
+		for _, ent := range entityKeys(e) {
+			if bags[i][ent] == 0 {
+				dfs[ent]++
+			}
+			bags[i][ent]++
+		}
+	}
+	n := float64(len(d.Events))
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	for i, e := range d.Events {
+		for ent, c := range bags[i] {
+			// 全てのイベントに出現するエンティティでも0にならないようにする
+			bags[i][ent] = c * (math.Log2(n/float64(dfs[ent])) + 1)
+		}
+		vectors[e.Id] = normalize(bags[i])
+	}
+	return vectors, nil
+}
+
+// entityKeysはイベントのエンティティを識別する文字列を戻す
+func entityKeys(e pipeline.EventData) []string {
+	var keys []string
+	if len(e.EntitySources) == 0 {
+		for _, ent := range e.Entities {
+			if ent = strings.ToLower(strings.TrimSpace(ent)); ent != "" {
+				keys = append(keys, ent)
+			}
+		}
+		return keys
+	}
+	for _, src := range e.EntitySources {
+		if src.Provenance == pipeline.ProvenanceHyperlink {
+			continue
+		}
+		if src.PageId != 0 {
+			keys = append(keys, "page:"+strconv.Itoa(src.PageId))
+		} else {
+			keys = append(keys, "title:"+strings.ToLower(src.Title))
+		}
+	}
+	return keys
+}
+
+// HashedNgramは1〜N語の連なりを、ハッシュ値でDim個の次元に振り分ける。
+// 辞書を作らないため、語彙の大きさに関わらずベクトルの次元数が決まる。
+type HashedNgram struct {
+	N   int
+	Dim int
+}
+
+func DefaultHashedNgram() HashedNgram {
+	return HashedNgram{N: 2, Dim: 1 << 18}
+}
+
+func (HashedNgram) Name() string { return "ngram" }
+
+func (v HashedNgram) Vectorize(d pipeline.EventsDataJSON) (map[int]map[string]float64, error) {
+	if v.N < 1 || v.Dim < 1 {
+		return nil, fmt.Errorf("ngram: invalid N=%d Dim=%d", v.N, v.Dim)
+	}
+	vectors := make(map[int]map[string]float64, len(d.Events))
+	for _, e := range d.Events {
+		tokens := Tokenize(e.Text)
+		counts := make(map[uint32]float64)
+		for n := 1; n <= v.N; n++ {
+			for i := 0; i+n <= len(tokens); i++ {
+				h := fnv.New32a()
+				h.Write([]byte(strings.Join(tokens[i:i+n], " ")))
+				counts[h.Sum32()%uint32(v.Dim)]++
+			}
+		}
+		vec := make(map[string]float64, len(counts))
+		for k, c := range counts {
+			vec[strconv.FormatUint(uint64(k), 10)] = 1 + math.Log2(c)
+		}
+		vectors[e.Id] = normalize(vec)
+	}
+	return vectors, nil
+}
+
+// normalizeはベクトルの長さを1にする（長さが0の場合はそのまま戻す）
+func normalize(vec map[string]float64) map[string]float64 {
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for k, v := range vec {
+		vec[k] = v / norm
+	}
+	return vec
+}
+
+// sortedKeysはベクトルのキーを辞書順に並べて戻す
+func sortedKeys(vec map[string]float64) []string {
+	keys := make([]string, 0, len(vec))
+	for k := range vec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,206 @@
+// dateparseはニュース記事のタイムスタンプなど、形式の定まらない日時の文字列を解析する。
+package dateparse
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Resultは解析した日時と、一致した形式を保持する
+type Result struct {
+	Time time.Time
+	// 一致した形式の名前（RFC3339、RFC1123Z、relativeなど）
+	Format string
+	// 時刻を含んでいた場合はtrue（日付のみの場合は0時0分0秒になる）
+	HasClock bool
+	// タイムゾーンを含んでいた場合はtrue（含まない場合や相対的な表現の場合はUTCとして扱う）
+	HasZone bool
+	// 「05/03/2020」のように月/日とも日/月とも読める場合はtrue（月/日として解析する）
+	Ambiguous bool
+}
+
+type layout struct {
+	name     string
+	layout   string
+	hasClock bool
+	hasZone  bool
+}
+
+// 試す形式の一覧、上から順に試して最初に一致したものを使う
+var layouts = []layout{
+	// 秒の小数部（RFC3339Nano）もRFC3339で解析できる
+	{"RFC3339", time.RFC3339, true, true},
+	{"ISO8601", "2006-01-02T15:04:05", true, false},
+	{"ISO8601Minute", "2006-01-02T15:04", true, false},
+	{"ISO8601Zone", "2006-01-02T15:04:05-0700", true, true},
+	{"SQLDateTimeZone", "2006-01-02 15:04:05 -0700", true, true},
+	{"SQLDateTimeAbbr", "2006-01-02 15:04:05 MST", true, true},
+	{"SQLDateTime", "2006-01-02 15:04:05", true, false},
+	{"SQLDateTimeMinute", "2006-01-02 15:04", true, false},
+	{"RFC1123", time.RFC1123, true, true},
+	{"RFC1123Z", time.RFC1123Z, true, true},
+	{"RFC1123SingleDay", "Mon, 2 Jan 2006 15:04:05 MST", true, true},
+	{"RFC1123ZSingleDay", "Mon, 2 Jan 2006 15:04:05 -0700", true, true},
+	{"RFC1123NoSecond", "Mon, 02 Jan 2006 15:04 MST", true, true},
+	{"RFC1123NoWeekday", "02 Jan 2006 15:04:05 MST", true, true},
+	{"RFC1123ZNoWeekday", "02 Jan 2006 15:04:05 -0700", true, true},
+	{"RFC1123SingleDayNoWeekday", "2 Jan 2006 15:04:05 MST", true, true},
+	{"RFC1123ZSingleDayNoWeekday", "2 Jan 2006 15:04:05 -0700", true, true},
+	{"RFC850", time.RFC850, true, true},
+	{"ANSIC", time.ANSIC, true, false},
+	{"UnixDate", time.UnixDate, true, true},
+	{"RubyDate", time.RubyDate, true, true},
+	{"ISODate", "2006-01-02", false, false},
+	{"SlashDate", "2006/01/02", false, false},
+	{"BasicDate", "20060102", false, false},
+	{"EnglishLongDateTime", "January 2, 2006 3:04 PM", true, false},
+	{"EnglishLongDate", "January 2, 2006", false, false},
+	{"EnglishShortDate", "Jan 2, 2006", false, false},
+	{"EnglishWeekdayLongDate", "Monday, January 2, 2006", false, false},
+	{"BritishLongDate", "2 January 2006", false, false},
+	{"BritishShortDate", "2 Jan 2006", false, false},
+	{"BritishWeekdayLongDate", "Monday 2 January 2006", false, false},
+	{"USSlashDate", "01/02/2006", false, false},
+	{"EuropeanSlashDate", "02/01/2006", false, false},
+	{"EuropeanDotDate", "02.01.2006", false, false},
+	{"JapaneseDateTime", "2006年1月2日 15時04分", true, false},
+	{"JapaneseDate", "2006年1月2日", false, false},
+}
+
+// タイムゾーンの略称と、UTCからのずれ（秒）
+// time.Parseは知らない略称を受け取るとずれを0として扱うため、よく使われるものは補正する
+var zoneOffsets = map[string]int{
+	"UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5 * 3600, "EDT": -4 * 3600,
+	"CST": -6 * 3600, "CDT": -5 * 3600,
+	"MST": -7 * 3600, "MDT": -6 * 3600,
+	"PST": -8 * 3600, "PDT": -7 * 3600,
+	"BST": 1 * 3600, "CET": 1 * 3600, "CEST": 2 * 3600,
+	"EET": 2 * 3600, "EEST": 3 * 3600,
+	"IST": 5*3600 + 1800, "JST": 9 * 3600, "KST": 9 * 3600,
+	"AEST": 10 * 3600, "AEDT": 11 * 3600,
+}
+
+var (
+	relativePattern = regexp.MustCompile(`^(an?|\d+)\s+(second|minute|hour|day|week|month|year)s?\s+ago$`)
+	epochPattern    = regexp.MustCompile(`^\d{10}$`)
+	spacePattern    = regexp.MustCompile(`\s+`)
+	ordinalPattern  = regexp.MustCompile(`(\d+)(st|nd|rd|th)\b`)
+	abbrDotPattern  = regexp.MustCompile(`\b([A-Z][a-z]{2,3})\.`)
+)
+
+// ErrUnknownFormatはどの形式にも一致しなかったことを示す
+var ErrUnknownFormat = errors.New("unknown date format")
+
+// Parseは文字列を日時に変換する。
+// 「2 hours ago」や「yesterday」などの相対的な表現は、refを基準にして解析する。
+func Parse(s string, ref time.Time) (Result, error) {
+	s = normalize(s)
+	if s == "" {
+		return Result{}, ErrUnknownFormat
+	}
+	if r, ok := parseRelative(strings.ToLower(s), ref); ok {
+		return r, nil
+	}
+	if epochPattern.MatchString(s) {
+		sec, _ := strconv.ParseInt(s, 10, 64)
+		return Result{Time: time.Unix(sec, 0).UTC(), Format: "UnixEpoch", HasClock: true, HasZone: true}, nil
+	}
+	for _, l := range layouts {
+		t, err := time.Parse(l.layout, s)
+		if err != nil {
+			continue
+		}
+		r := Result{Time: fixZone(t), Format: l.name, HasClock: l.hasClock, HasZone: l.hasZone}
+		if l.name == "USSlashDate" {
+			r.Ambiguous = isAmbiguousSlashDate(s, t)
+		}
+		return r, nil
+	}
+	return Result{}, ErrUnknownFormat
+}
+
+// isAmbiguousSlashDateは月/日として解析したsが、日/月としても別の日付に読めるかどうかを戻す
+func isAmbiguousSlashDate(s string, t time.Time) bool {
+	for _, l := range layouts {
+		if l.name != "EuropeanSlashDate" {
+			continue
+		}
+		eu, err := time.Parse(l.layout, s)
+		return err == nil && !eu.Equal(t)
+	}
+	return false
+}
+
+// normalizeは余分な空白や序数の接尾辞（1st、2ndなど）、略称の「.」（Jan.など）、「at」などを取り除く
+func normalize(s string) string {
+	s = strings.TrimSpace(spacePattern.ReplaceAllString(s, " "))
+	s = ordinalPattern.ReplaceAllString(s, "$1")
+	s = abbrDotPattern.ReplaceAllString(s, "$1")
+	s = strings.Replace(s, " at ", " ", 1)
+	s = strings.Replace(s, "Sept ", "Sep ", 1)
+	s = strings.Replace(s, "a.m.", "AM", 1)
+	s = strings.Replace(s, "p.m.", "PM", 1)
+	return s
+}
+
+// parseRelativeは「now」「today」「yesterday」「3 days ago」などの相対的な表現を解析する。
+// 文字列はタイムゾーンを含まないため、HasZoneはfalseにする（refのタイムゾーンは記事のものではない）。
+func parseRelative(s string, ref time.Time) (Result, bool) {
+	day := time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, ref.Location())
+	switch s {
+	case "now", "just now":
+		return Result{Time: ref, Format: "relative", HasClock: true}, true
+	case "today":
+		return Result{Time: day, Format: "relative"}, true
+	case "yesterday":
+		return Result{Time: day.AddDate(0, 0, -1), Format: "relative"}, true
+	}
+	m := relativePattern.FindStringSubmatch(s)
+	if m == nil {
+		return Result{}, false
+	}
+	n := 1
+	if m[1] != "a" && m[1] != "an" {
+		n, _ = strconv.Atoi(m[1])
+	}
+	var t time.Time
+	switch m[2] {
+	case "second":
+		t = ref.Add(-time.Duration(n) * time.Second)
+	case "minute":
+		t = ref.Add(-time.Duration(n) * time.Minute)
+	case "hour":
+		t = ref.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		t = ref.AddDate(0, 0, -n)
+	case "week":
+		t = ref.AddDate(0, 0, -7*n)
+	case "month":
+		t = ref.AddDate(0, -n, 0)
+	case "year":
+		t = ref.AddDate(-n, 0, 0)
+	}
+	return Result{Time: t, Format: "relative", HasClock: true}, true
+}
+
+// fixZoneはtime.Parseがずれを0として扱ったタイムゾーンの略称を、既知のずれに置き換える
+func fixZone(t time.Time) time.Time {
+	name, offset := t.Zone()
+	known, found := zoneOffsets[name]
+	if !found || offset == known {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, known))
+}
+
+// Zoneはタイムゾーンのずれを「+09:00」の形式で戻す。タイムゾーンを含まなかった場合は空文字列を戻す。
+func (r Result) Zone() string {
+	if !r.HasZone {
+		return ""
+	}
+	return r.Time.Format("-07:00")
+}
@@ -0,0 +1,154 @@
+package dateparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLayouts(t *testing.T) {
+	jst := time.FixedZone("", 9*3600)
+	est := time.FixedZone("", -5*3600)
+	tests := []struct {
+		in       string
+		format   string
+		want     time.Time
+		hasClock bool
+		hasZone  bool
+	}{
+		{"2020-01-02T15:04:05+09:00", "RFC3339", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"2020-01-02T15:04:05.5Z", "RFC3339", time.Date(2020, 1, 2, 15, 4, 5, 5e8, time.UTC), true, true},
+		{"2020-01-02T15:04:05", "ISO8601", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, false},
+		{"2020-01-02T15:04", "ISO8601Minute", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC), true, false},
+		{"2020-01-02T15:04:05+0900", "ISO8601Zone", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"2020-01-02 15:04:05 -0500", "SQLDateTimeZone", time.Date(2020, 1, 2, 15, 4, 5, 0, est), true, true},
+		{"2020-01-02 15:04:05 JST", "SQLDateTimeAbbr", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"2020-01-02 15:04:05", "SQLDateTime", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, false},
+		{"2020-01-02 15:04", "SQLDateTimeMinute", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC), true, false},
+		{"Thu, 02 Jan 2020 15:04:05 EST", "RFC1123", time.Date(2020, 1, 2, 15, 4, 5, 0, est), true, true},
+		{"Thu, 02 Jan 2020 15:04:05 -0500", "RFC1123Z", time.Date(2020, 1, 2, 15, 4, 5, 0, est), true, true},
+		{"Thu, 2 Jan 2020 15:04:05 GMT", "RFC1123SingleDay", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, true},
+		{"Thu, 2 Jan 2020 15:04:05 +0900", "RFC1123ZSingleDay", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"Thu, 02 Jan 2020 15:04 GMT", "RFC1123NoSecond", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC), true, true},
+		{"02 Jan 2020 15:04:05 GMT", "RFC1123NoWeekday", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, true},
+		{"02 Jan 2020 15:04:05 +0900", "RFC1123ZNoWeekday", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"2 Jan 2020 15:04:05 GMT", "RFC1123SingleDayNoWeekday", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, true},
+		{"2 Jan 2020 15:04:05 -0500", "RFC1123ZSingleDayNoWeekday", time.Date(2020, 1, 2, 15, 4, 5, 0, est), true, true},
+		{"Thursday, 02-Jan-20 15:04:05 EST", "RFC850", time.Date(2020, 1, 2, 15, 4, 5, 0, est), true, true},
+		{"Thu Jan  2 15:04:05 2020", "ANSIC", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, false},
+		{"Thu Jan  2 15:04:05 JST 2020", "UnixDate", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"Thu Jan 02 15:04:05 +0900 2020", "RubyDate", time.Date(2020, 1, 2, 15, 4, 5, 0, jst), true, true},
+		{"2020-01-02", "ISODate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"2020/01/02", "SlashDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"20200102", "BasicDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"January 2, 2020 at 3:04 p.m.", "EnglishLongDateTime", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC), true, false},
+		{"January 2nd, 2020", "EnglishLongDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"Jan. 2, 2020", "EnglishShortDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"Thursday, January 2, 2020", "EnglishWeekdayLongDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"2 January 2020", "BritishLongDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"2 Jan 2020", "BritishShortDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"Thursday 2 January 2020", "BritishWeekdayLongDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"12/25/2020", "USSlashDate", time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), false, false},
+		{"25/12/2020", "EuropeanSlashDate", time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), false, false},
+		{"25.12.2020", "EuropeanDotDate", time.Date(2020, 12, 25, 0, 0, 0, 0, time.UTC), false, false},
+		{"2020年1月2日 15時04分", "JapaneseDateTime", time.Date(2020, 1, 2, 15, 4, 0, 0, time.UTC), true, false},
+		{"2020年1月2日", "JapaneseDate", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false, false},
+		{"1577977445", "UnixEpoch", time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), true, true},
+	}
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := Parse(tt.in, time.Now())
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if r.Format != tt.format {
+				t.Errorf("Format = %s, want %s", r.Format, tt.format)
+			}
+			if !r.Time.Equal(tt.want) {
+				t.Errorf("Time = %v, want %v", r.Time, tt.want)
+			}
+			if r.HasClock != tt.hasClock || r.HasZone != tt.hasZone {
+				t.Errorf("HasClock, HasZone = %v, %v, want %v, %v", r.HasClock, r.HasZone, tt.hasClock, tt.hasZone)
+			}
+			if r.Ambiguous {
+				t.Errorf("Ambiguous = true, want false")
+			}
+		})
+		covered[tt.format] = true
+	}
+	for _, l := range layouts {
+		if !covered[l.name] {
+			t.Errorf("no case for the layout %s", l.name)
+		}
+	}
+}
+
+func TestParseAmbiguousSlashDate(t *testing.T) {
+	tests := []struct {
+		in        string
+		want      time.Time
+		ambiguous bool
+	}{
+		{"05/03/2020", time.Date(2020, 5, 3, 0, 0, 0, 0, time.UTC), true},
+		{"03/03/2020", time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC), false},
+		{"05/13/2020", time.Date(2020, 5, 13, 0, 0, 0, 0, time.UTC), false},
+		{"13/05/2020", time.Date(2020, 5, 13, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := Parse(tt.in, time.Now())
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if !r.Time.Equal(tt.want) || r.Ambiguous != tt.ambiguous {
+				t.Errorf("got %v (ambiguous: %v), want %v (ambiguous: %v)", r.Time, r.Ambiguous, tt.want, tt.ambiguous)
+			}
+		})
+	}
+}
+
+func TestParseRelative(t *testing.T) {
+	ref := time.Date(2020, 1, 10, 15, 4, 5, 0, time.FixedZone("", 9*3600))
+	day := time.Date(2020, 1, 10, 0, 0, 0, 0, ref.Location())
+	tests := []struct {
+		in       string
+		want     time.Time
+		hasClock bool
+	}{
+		{"now", ref, true},
+		{"Today", day, false},
+		{"yesterday", day.AddDate(0, 0, -1), false},
+		{"30 seconds ago", ref.Add(-30 * time.Second), true},
+		{"a minute ago", ref.Add(-time.Minute), true},
+		{"2 hours ago", ref.Add(-2 * time.Hour), true},
+		{"3 days ago", ref.AddDate(0, 0, -3), true},
+		{"an hour ago", ref.Add(-time.Hour), true},
+		{"1 week ago", ref.AddDate(0, 0, -7), true},
+		{"2 months ago", ref.AddDate(0, -2, 0), true},
+		{"1 year ago", ref.AddDate(-1, 0, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := Parse(tt.in, ref)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.in, err)
+			}
+			if r.Format != "relative" || !r.Time.Equal(tt.want) || r.HasClock != tt.hasClock {
+				t.Errorf("got %v %v (clock: %v), want relative %v (clock: %v)", r.Format, r.Time, r.HasClock, tt.want, tt.hasClock)
+			}
+			if r.HasZone || r.Zone() != "" {
+				t.Errorf("HasZone = %v, Zone = %q, want false, empty", r.HasZone, r.Zone())
+			}
+		})
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, in := range []string{"", "   ", "not a date", "2020-13-45", "32/13/2020"} {
+		t.Run(in, func(t *testing.T) {
+			if r, err := Parse(in, time.Now()); err != ErrUnknownFormat {
+				t.Errorf("Parse(%q) = %v, %v, want ErrUnknownFormat", in, r.Format, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package linker
+
+import (
+	"database/sql"
+	"fmt"
+	"main/apis/sqldb"
+	"main/apis/util"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Linkは文書中のリンク（アンカーテキストとリンク先）
+type Link struct {
+	Text string
+	Href string
+}
+
+// Builderは文書中のリンクと本文から辞書を作る。
+// 全ての文書のリンクをAddLinksで追加してから、同じ文書の本文をCountTextで数える。
+type Builder struct {
+	dict    *Dictionary
+	pageOf  map[string]int
+	inLinks map[int][]int
+}
+
+// NewBuilderはアンカーテキストをmaxWords語までとするBuilderを戻す
+func NewBuilder(maxWords int) *Builder {
+	return &Builder{
+		dict:    &Dictionary{Anchors: make(map[string]*Anchor), MaxWords: maxWords},
+		pageOf:  make(map[string]int),
+		inLinks: make(map[int][]int),
+	}
+}
+
+// pageはパスに対応する記事のIDを戻す（なければ追加する）
+func (b *Builder) page(path string) int {
+	if id, found := b.pageOf[path]; found {
+		return id
+	}
+	id := len(b.dict.Pages)
+	b.pageOf[path] = id
+	b.dict.Pages = append(b.dict.Pages, Page{Path: path, Title: util.WikiPathToTitle(path)})
+	return id
+}
+
+func (b *Builder) anchor(text string) *Anchor {
+	a, found := b.dict.Anchors[text]
+	if !found {
+		a = &Anchor{Targets: make(map[int]int)}
+		b.dict.Anchors[text] = a
+	}
+	return a
+}
+
+// AddLinksは一つの文書のリンクを追加する。
+// sourceはwiki内記事のパス（イベントなど、記事でない場合は空文字）で、記事間のリンクとして関連度の計算に用いる。
+func (b *Builder) AddLinks(source string, links []Link) {
+	src := -1
+	if path := normalizePath(source); path != "" {
+		src = b.page(path)
+		b.dict.NumArticles++
+	}
+	linked := make(map[string]bool)
+	for _, l := range links {
+		path := normalizePath(l.Href)
+		text := normalizeAnchor(l.Text)
+		if path == "" || text == "" || len(strings.Fields(text)) > b.dict.MaxWords {
+			continue
+		}
+		target := b.page(path)
+		a := b.anchor(text)
+		a.Targets[target]++
+		// リンクの数は文書ごとに一度だけ数える（Freqと揃える）
+		if !linked[text] {
+			linked[text] = true
+			a.Links++
+		}
+		if src != -1 && src != target {
+			b.inLinks[target] = append(b.inLinks[target], src)
+		}
+	}
+}
+
+// SetPageIdは記事のWikipediaの記事IDを設定する
+func (b *Builder) SetPageId(path string, pageId int) {
+	path = normalizePath(path)
+	if path == "" || pageId == 0 {
+		return
+	}
+	b.dict.Pages[b.page(path)].PageId = pageId
+}
+
+// AddTitleは記事名（末尾の括弧を除く）を、その記事を指すアンカーテキストとして追加する
+func (b *Builder) AddTitle(path string) {
+	path = normalizePath(path)
+	if path == "" {
+		return
+	}
+	id := b.page(path)
+	text := normalizeAnchor(util.TrimWikiTitleQualifier(b.dict.Pages[id].Title))
+	if text == "" || len(strings.Fields(text)) > b.dict.MaxWords {
+		return
+	}
+	a := b.anchor(text)
+	a.Targets[id]++
+	a.Links++
+}
+
+// CountTextは一つの文書の本文に、各アンカーテキストが出現するかどうかを数える
+func (b *Builder) CountText(text string) {
+	tokens := tokenize(text)
+	seen := make(map[string]bool)
+	for i := range tokens {
+		key := ""
+		for n := 1; n <= b.dict.MaxWords && i+n <= len(tokens); n++ {
+			if n == 1 {
+				key = tokens[i].word
+			} else {
+				key += " " + tokens[i+n-1].word
+			}
+			if a, found := b.dict.Anchors[key]; found && !seen[key] {
+				seen[key] = true
+				a.Freq++
+			}
+		}
+	}
+}
+
+// Dictionaryは作った辞書を戻す
+func (b *Builder) Dictionary() *Dictionary {
+	for id, in := range b.inLinks {
+		b.dict.Pages[id].InLinks = sortedUnique(in)
+	}
+	for _, a := range b.dict.Anchors {
+		// 記事名は本文に出現しないまま追加しているため、割合が1を超えないようにする
+		if a.Freq < a.Links {
+			a.Freq = a.Links
+		}
+	}
+	return b.dict
+}
+
+// ArticleLinksはwiki内記事のHTMLから、本文中のリンクと本文の文字列を抽出する
+func ArticleLinks(html string) ([]Link, string, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, "", err
+	}
+	body := doc.Find("div.mw-parser-output")
+	if body.Length() == 0 {
+		body = doc.Find("body")
+	}
+	// 脚注や装飾はリンクや本文として扱わない
+	body.Find("style, script, sup.reference, .mw-editsection, .navbox, .reflist").Remove()
+	var links []Link
+	body.Find("a[href]").Each(func(i int, slct *goquery.Selection) {
+		href, _ := slct.Attr("href")
+		links = append(links, Link{Text: slct.Text(), Href: href})
+	})
+	return links, body.Text(), nil
+}
+
+// BuildFromDBはDBに保存したwiki内記事のリンクと、イベントが参照しているwiki内記事から辞書を作る
+func BuildFromDB(db *sql.DB, maxWords int) (*Dictionary, error) {
+	b := NewBuilder(maxWords)
+	idAndUrl, err := sqldb.SlelctAllIdAndUrlWikiArticle(db)
+	if err != nil {
+		return nil, err
+	}
+	urlOf := make(map[int]string, len(idAndUrl))
+	for path, id := range idAndUrl {
+		urlOf[id] = path
+	}
+	events, err := sqldb.SelectEvents(db, "0001-01-01", "9999-12-31")
+	if err != nil {
+		return nil, err
+	}
+	// 1回目：リンクを集める
+	err = sqldb.ForEachWikiArticle(db, func(art sqldb.WikiArt) error {
+		links, _, err := ArticleLinks(art.Text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", art.WikiSourceUrl, err)
+		}
+		b.AddLinks(art.WikiSourceUrl, links)
+		b.AddTitle(art.WikiSourceUrl)
+		pageId := art.PageId
+		if pageId == 0 {
+			pageId = util.WikiPageId(art.Text)
+		}
+		b.SetPageId(art.WikiSourceUrl, pageId)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// イベントはリンクの文字列を保存していないため、記事名が本文に出現する場合にリンクとみなす
+	for _, e := range events {
+		text := " " + normalizeAnchor(e.Text) + " "
+		var links []Link
+		for _, id := range e.EntitiesId {
+			path, found := urlOf[id]
+			if !found {
+				continue
+			}
+			title := util.TrimWikiTitleQualifier(util.WikiPathToTitle(path))
+			if t := normalizeAnchor(title); t != "" && strings.Contains(text, " "+t+" ") {
+				links = append(links, Link{Text: title, Href: path})
+			}
+		}
+		b.AddLinks("", links)
+	}
+	// 2回目：アンカーテキストが出現する文書を数える
+	err = sqldb.ForEachWikiArticle(db, func(art sqldb.WikiArt) error {
+		_, text, err := ArticleLinks(art.Text)
+		if err != nil {
+			return fmt.Errorf("%s: %v", art.WikiSourceUrl, err)
+		}
+		b.CountText(text)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		b.CountText(e.Text)
+	}
+	return b.Dictionary(), nil
+}
@@ -0,0 +1,117 @@
+package linker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		href, want string
+	}{
+		{"/wiki/Joe_Biden", "/wiki/Joe_Biden"},
+		{"/wiki/Paris#History", "/wiki/Paris"},
+		{"/wiki/Paris,_Texas", "/wiki/Paris,_Texas"},
+		{"/wiki/Sa%C3%BAl_(film)", "/wiki/Saúl_(film)"},
+		{"/wiki/New York", "/wiki/New_York"},
+		{"/wiki/File:Eiffel.jpg", ""},
+		{"/wiki/Category:Cities", ""},
+		{"/wiki/", ""},
+		{"https://example.com/wiki/Paris", ""},
+		{"#cite_note-1", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.href); got != tt.want {
+			t.Errorf("normalizePath(%q) = %q, want %q", tt.href, got, tt.want)
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(2)
+	b.AddLinks("/wiki/Eiffel_Tower", []Link{
+		{Text: "Paris", Href: "/wiki/Paris"},
+		{Text: "Paris", Href: "/wiki/Paris#History"},
+		{Text: "the capital", Href: "/wiki/Paris"},
+		{Text: "photo", Href: "/wiki/File:Eiffel.jpg"},
+		{Text: "too many words here", Href: "/wiki/France"},
+		{Text: "Hilton", Href: "https://example.com"},
+	})
+	b.AddLinks("/wiki/Hotel", []Link{{Text: "Paris", Href: "/wiki/Paris_Hilton"}})
+	// イベントからのリンクは、記事間のリンクとして数えない
+	b.AddLinks("", []Link{{Text: "Paris", Href: "/wiki/Paris"}})
+	b.AddTitle("/wiki/Paris_Hilton")
+	b.SetPageId("/wiki/Paris", 22989)
+	for _, text := range []string{"Paris is the capital. Paris again.", "paris", "PARIS!", "Paris Hilton", "Nothing here"} {
+		b.CountText(text)
+	}
+	d := b.Dictionary()
+
+	var paths []string
+	for _, p := range d.Pages {
+		paths = append(paths, p.Path)
+	}
+	if want := []string{"/wiki/Eiffel_Tower", "/wiki/Paris", "/wiki/Hotel", "/wiki/Paris_Hilton"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("pages = %v, want %v", paths, want)
+	}
+	if d.NumArticles != 2 {
+		t.Errorf("NumArticles = %d, want 2", d.NumArticles)
+	}
+	if d.Pages[1].PageId != 22989 || d.Pages[3].Title != "Paris Hilton" {
+		t.Errorf("pages = %+v", d.Pages)
+	}
+	if !reflect.DeepEqual(d.Pages[1].InLinks, []int{0}) || !reflect.DeepEqual(d.Pages[3].InLinks, []int{2}) || d.Pages[0].InLinks != nil {
+		t.Errorf("in-links = %v, %v, %v", d.Pages[0].InLinks, d.Pages[1].InLinks, d.Pages[3].InLinks)
+	}
+	tests := []struct {
+		anchor      string
+		links, freq int
+		targets     map[int]int
+	}{
+		// リンクは文書ごとに一度だけ数え、本文は「Paris Hilton」も含めて4件
+		{"paris", 3, 4, map[int]int{1: 3, 3: 1}},
+		{"the capital", 1, 1, map[int]int{1: 1}},
+		// 記事名から加えたもの
+		{"paris hilton", 1, 1, map[int]int{3: 1}},
+		// 本文に出現しなくても、リンクになる割合は1を超えない
+		{"hotel", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		a, found := d.Anchors[tt.anchor]
+		if tt.targets == nil {
+			if found {
+				t.Errorf("anchor %q: %+v, want none", tt.anchor, a)
+			}
+			continue
+		}
+		if !found {
+			t.Errorf("anchor %q: not found", tt.anchor)
+			continue
+		}
+		if a.Links != tt.links || a.Freq != tt.freq || !reflect.DeepEqual(a.Targets, tt.targets) {
+			t.Errorf("anchor %q = %+v, want links %d, freq %d, targets %v", tt.anchor, a, tt.links, tt.freq, tt.targets)
+		}
+	}
+	for _, text := range []string{"photo", "hilton", "too many words here"} {
+		if _, found := d.Anchors[normalizeAnchor(text)]; found {
+			t.Errorf("anchor %q: want none", text)
+		}
+	}
+}
+
+func TestArticleLinks(t *testing.T) {
+	html := `<html><body><div class="mw-parser-output"><p>The <a href="/wiki/Paris">Paris</a> agreement` +
+		`<sup class="reference"><a href="#cite_note-1">[1]</a></sup>.</p>` +
+		`<div class="navbox"><a href="/wiki/France">France</a></div></div></body></html>`
+	links, text, err := ArticleLinks(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Link{{Text: "Paris", Href: "/wiki/Paris"}}; !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %v, want %v", links, want)
+	}
+	if strings.TrimSpace(text) != "The Paris agreement." {
+		t.Errorf("text = %q", text)
+	}
+}
@@ -0,0 +1,190 @@
+package linker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DictionarySchemaVersionは辞書ファイルの現在のスキーマのバージョン
+const DictionarySchemaVersion = 1
+
+// Dictionaryはアンカーテキスト（リンクの文字列）と、それが指す記事の辞書
+type Dictionary struct {
+	SchemaVersion int `json:"schema_version"`
+	// 記事（添字が記事のID）
+	Pages []Page `json:"pages"`
+	// 正規化したアンカーテキストごとの情報
+	Anchors map[string]*Anchor `json:"anchors"`
+	// 辞書を作る時にリンクを調べた記事の数（関連度の計算に用いる）
+	NumArticles int `json:"num_articles"`
+	// アンカーテキストの最大の単語数
+	MaxWords int `json:"max_words"`
+}
+
+// Pageはwiki内の一つの記事
+type Page struct {
+	// wiki内記事のパス（例：/wiki/Joe_Biden、wiki_eventのentitieと同じ形式）
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	// Wikipediaの記事ID（DBに記事がない場合は0）
+	PageId int `json:"page_id,omitempty"`
+	// この記事へリンクしている記事のID（昇順）
+	InLinks []int `json:"in_links,omitempty"`
+}
+
+// Anchorは一つのアンカーテキストの統計
+type Anchor struct {
+	// リンクとして出現した文書の数
+	Links int `json:"links"`
+	// リンクかどうかに関わらず出現した文書の数
+	Freq int `json:"freq"`
+	// リンク先の記事のIDと、そのリンクの数
+	Targets map[int]int `json:"targets"`
+}
+
+// LinkProbabilityはアンカーテキストが出現した時に、リンクになっている割合
+func (a *Anchor) LinkProbability() float64 {
+	if a.Freq <= 0 {
+		return 0
+	}
+	return float64(a.Links) / float64(a.Freq)
+}
+
+// Commonnessはアンカーテキストがpageを指す割合
+func (a *Anchor) Commonness(page int) float64 {
+	total := 0
+	for _, c := range a.Targets {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(a.Targets[page]) / float64(total)
+}
+
+// Loadは辞書ファイルを読み込む
+func Load(path string) (*Dictionary, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var d Dictionary
+	err = json.Unmarshal(b, &d)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if d.SchemaVersion != DictionarySchemaVersion {
+		return nil, fmt.Errorf("%s: unsupported schema_version %d (want %d)", path, d.SchemaVersion, DictionarySchemaVersion)
+	}
+	return &d, nil
+}
+
+// Saveは辞書をファイルに書き込む
+func (d *Dictionary) Save(path string) error {
+	d.SchemaVersion = DictionarySchemaVersion
+	output, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, output, 0644)
+}
+
+// 単語は文字と数字の並びとする（アンカーテキストと本文で同じ規則を用いる）
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// tokenは本文中の単語と、そのバイト単位の位置
+type token struct {
+	word       string
+	start, end int
+}
+
+func tokenize(text string) []token {
+	locs := wordPattern.FindAllStringIndex(text, -1)
+	tokens := make([]token, len(locs))
+	for i, loc := range locs {
+		tokens[i] = token{word: strings.ToLower(text[loc[0]:loc[1]]), start: loc[0], end: loc[1]}
+	}
+	return tokens
+}
+
+// normalizeAnchorはアンカーテキストを小文字の単語を空白で繋いだ形にする
+func normalizeAnchor(text string) string {
+	return strings.ToLower(strings.Join(wordPattern.FindAllString(text, -1), " "))
+}
+
+// normalizePathはリンク先を比較できる形にする。記事以外（ファイルやカテゴリなど）は空文字を戻す
+func normalizePath(href string) string {
+	if !strings.HasPrefix(href, "/wiki/") {
+		return ""
+	}
+	if i := strings.Index(href, "#"); i >= 0 {
+		href = href[:i]
+	}
+	name := strings.TrimPrefix(href, "/wiki/")
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	// 「File:」「Category:」などの名前空間は記事ではない
+	if name == "" || strings.Contains(name, ":") {
+		return ""
+	}
+	// 「%28」と「(」のような表記の揺れをなくすため、エスケープを戻した形で比較する
+	return "/wiki/" + strings.ReplaceAll(name, " ", "_")
+}
+
+// relatednessはMilne-Wittenの関連度（二つの記事へリンクしている記事の重なり）を戻す
+func (d *Dictionary) relatedness(a, b int) float64 {
+	if a == b {
+		return 1
+	}
+	inA, inB := d.Pages[a].InLinks, d.Pages[b].InLinks
+	if len(inA) == 0 || len(inB) == 0 || d.NumArticles < 2 {
+		return 0
+	}
+	common := 0
+	for i, j := 0, 0; i < len(inA) && j < len(inB); {
+		switch {
+		case inA[i] == inB[j]:
+			common++
+			i++
+			j++
+		case inA[i] < inB[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	large, small := float64(len(inA)), float64(len(inB))
+	if small > large {
+		large, small = small, large
+	}
+	w := float64(d.NumArticles)
+	if w <= small {
+		return 1
+	}
+	r := 1 - (math.Log(large)-math.Log(float64(common)))/(math.Log(w)-math.Log(small))
+	if r < 0 {
+		return 0
+	}
+	return r
+}
+
+func sortedUnique(ids []int) []int {
+	sort.Ints(ids)
+	out := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			out = append(out, id)
+		}
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package linker
+
+import (
+	"fmt"
+	"main/apis/tagme"
+	"os"
+	"sort"
+	"time"
+)
+
+// LinkerはTagMeと同じ手順（スポッティング → 候補の投票による曖昧性解消 → rhoの計算）で、
+// 辞書だけを用いて本文のエンティティを抽出する。tagme.Annotatorとして、TagMe APIの代わりに用いる。
+type Linker struct {
+	Dict *Dictionary
+	// リンクになる割合がこれより低いアンカーテキストは語句として扱わない
+	MinLinkProbability float64
+	// 語句がその記事を指す割合がこれより低い記事は候補にしない
+	MinCommonness float64
+	// 語句ごとの候補の数の上限
+	MaxCandidates int
+	// 投票の最高点からこの割合までの候補のうち、最も指す割合が高い記事を選ぶ
+	Epsilon float64
+}
+
+// NewはTagMeの初期値に近い設定のLinkerを戻す
+func New(d *Dictionary) *Linker {
+	return &Linker{
+		Dict:               d,
+		MinLinkProbability: 0.01,
+		MinCommonness:      0.02,
+		MaxCandidates:      10,
+		Epsilon:            0.3,
+	}
+}
+
+// NewAnnotatorは名前に対応するエンティティの抽出方法を戻す（tagme: TagMe API、offline: dictPathの辞書を用いるLinker）
+func NewAnnotator(name, dictPath string) (tagme.Annotator, error) {
+	switch name {
+	case "tagme":
+		return tagme.WebAPI{}, nil
+	case "offline":
+		dict, err := Load(dictPath)
+		if err != nil {
+			return nil, err
+		}
+		return New(dict), nil
+	}
+	return nil, fmt.Errorf("unknown linker: %s", name)
+}
+
+// AnnotatorKeyはエンティティの抽出方法を表す文字列を戻す（キャッシュや再実行の判定に用いる）。
+// 辞書を作り直した場合に別の抽出方法として扱うように、辞書の更新日時と大きさを含める。
+func AnnotatorKey(name, dictPath string) string {
+	if name != "offline" {
+		return name
+	}
+	info, err := os.Stat(dictPath)
+	if err != nil {
+		return fmt.Sprintf("%s dict=%s", name, dictPath)
+	}
+	return fmt.Sprintf("%s dict=%s modified=%s size=%d", name, dictPath, info.ModTime().UTC().Format(time.RFC3339Nano), info.Size())
+}
+
+// spotは本文中の語句と、その候補の記事
+type spot struct {
+	text       string
+	start, end int
+	anchor     *Anchor
+	candidates []candidate
+}
+
+type candidate struct {
+	page       int
+	commonness float64
+}
+
+// AnnotateはTagMe APIと同じ形式で、本文のエンティティを戻す。
+// StartとEndは本文のバイト単位の位置。IDはWikipediaの記事ID（DBに記事がなく不明な場合は0）。
+func (l *Linker) Annotate(text string) (tagme.TagMeData, error) {
+	started := time.Now()
+	spots := l.spot(text)
+	chosen := l.disambiguate(spots)
+	data := tagme.TagMeData{
+		Test:        "",
+		Annotations: make([]tagme.Annotation, 0, len(spots)),
+		API:         "offline",
+		Lang:        "en",
+	}
+	for i, s := range spots {
+		if chosen[i] < 0 {
+			continue
+		}
+		// rhoはリンクになる割合と、他の語句に選んだ記事との関連度の平均から求める
+		coherence, n := 0.0, 0
+		for j := range spots {
+			if j != i && chosen[j] >= 0 {
+				coherence += l.Dict.relatedness(chosen[i], chosen[j])
+				n++
+			}
+		}
+		if n > 0 {
+			coherence /= float64(n)
+		}
+		lp := s.anchor.LinkProbability()
+		data.Annotations = append(data.Annotations, tagme.Annotation{
+			Spot:            s.text,
+			Start:           s.start,
+			End:             s.end,
+			LinkProbability: lp,
+			Rho:             (lp + coherence) / 2,
+			ID:              l.Dict.Pages[chosen[i]].PageId,
+			Title:           l.Dict.Pages[chosen[i]].Title,
+		})
+	}
+	data.Time = int(time.Since(started).Milliseconds())
+	data.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	return data, nil
+}
+
+// spotは本文の先頭から、辞書にある最も長い語句を重ならないように探す
+func (l *Linker) spot(text string) []spot {
+	tokens := tokenize(text)
+	var spots []spot
+	for i := 0; i < len(tokens); {
+		found := false
+		for n := l.Dict.MaxWords; n >= 1; n-- {
+			if i+n > len(tokens) {
+				continue
+			}
+			key := tokens[i].word
+			for k := i + 1; k < i+n; k++ {
+				key += " " + tokens[k].word
+			}
+			a, ok := l.Dict.Anchors[key]
+			if !ok || a.LinkProbability() < l.MinLinkProbability {
+				continue
+			}
+			cands := l.candidates(a)
+			if len(cands) == 0 {
+				continue
+			}
+			start, end := tokens[i].start, tokens[i+n-1].end
+			spots = append(spots, spot{text: text[start:end], start: start, end: end, anchor: a, candidates: cands})
+			i += n
+			found = true
+			break
+		}
+		if !found {
+			i++
+		}
+	}
+	return spots
+}
+
+// candidatesは語句が指す記事のうち、指す割合が高いものを戻す
+func (l *Linker) candidates(a *Anchor) []candidate {
+	var cands []candidate
+	for page := range a.Targets {
+		if c := a.Commonness(page); c >= l.MinCommonness {
+			cands = append(cands, candidate{page: page, commonness: c})
+		}
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].commonness != cands[j].commonness {
+			return cands[i].commonness > cands[j].commonness
+		}
+		return cands[i].page < cands[j].page
+	})
+	if l.MaxCandidates > 0 && len(cands) > l.MaxCandidates {
+		cands = cands[:l.MaxCandidates]
+	}
+	return cands
+}
+
+// disambiguateは語句ごとに、他の語句の候補からの投票で記事を選ぶ（選べない場合は-1）
+func (l *Linker) disambiguate(spots []spot) []int {
+	chosen := make([]int, len(spots))
+	for i, s := range spots {
+		chosen[i] = -1
+		votes := make([]float64, len(s.candidates))
+		best := 0.0
+		for c, cand := range s.candidates {
+			for j, other := range spots {
+				if j == i {
+					continue
+				}
+				var v float64
+				for _, o := range other.candidates {
+					v += l.Dict.relatedness(cand.page, o.page) * o.commonness
+				}
+				votes[c] += v / float64(len(other.candidates))
+			}
+			if votes[c] > best {
+				best = votes[c]
+			}
+		}
+		// 候補は指す割合の高い順なので、最高点に近いもののうち最初の候補を選ぶ
+		for c, cand := range s.candidates {
+			if votes[c] >= best*(1-l.Epsilon) {
+				chosen[i] = cand.page
+				break
+			}
+		}
+	}
+	return chosen
+}
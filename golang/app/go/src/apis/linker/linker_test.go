@@ -0,0 +1,152 @@
+package linker
+
+import (
+	"math"
+	"testing"
+)
+
+// testDictは「paris」がパリとパリス・ヒルトンのどちらも指す辞書。
+// パリとフランスはリンク元の記事（10, 11）を、パリス・ヒルトンとホテルは（20）を共有する。
+func testDict() *Dictionary {
+	return &Dictionary{
+		SchemaVersion: DictionarySchemaVersion,
+		Pages: []Page{
+			{Path: "/wiki/Paris", Title: "Paris", PageId: 100, InLinks: []int{10, 11, 12}},
+			{Path: "/wiki/Paris_Hilton", Title: "Paris Hilton", PageId: 101, InLinks: []int{20, 21}},
+			{Path: "/wiki/France", Title: "France", PageId: 102, InLinks: []int{10, 11, 13}},
+			{Path: "/wiki/Hotel", Title: "Hotel", PageId: 103, InLinks: []int{20, 22}},
+			{Path: "/wiki/Paris,_Texas", Title: "Paris, Texas", PageId: 104},
+		},
+		Anchors: map[string]*Anchor{
+			// Paris, Texasを指す割合は0.012で、候補にしない
+			"paris":        {Links: 50, Freq: 100, Targets: map[int]int{0: 300, 1: 100, 4: 5}},
+			"paris hilton": {Links: 9, Freq: 10, Targets: map[int]int{1: 1}},
+			"france":       {Links: 80, Freq: 100, Targets: map[int]int{2: 1}},
+			"hotel":        {Links: 10, Freq: 100, Targets: map[int]int{3: 1}},
+			// リンクになる割合が低く、語句として扱わない
+			"the": {Links: 1, Freq: 1000, Targets: map[int]int{3: 1}},
+		},
+		NumArticles: 100,
+		MaxWords:    2,
+	}
+}
+
+// Milne-Wittenの関連度（W = 100）
+var (
+	// パリとフランス：3件ずつのうち2件が共通
+	relParisFrance = 1 - (math.Log(3)-math.Log(2))/(math.Log(100)-math.Log(3))
+	// パリス・ヒルトンとホテル：2件ずつのうち1件が共通
+	relHiltonHotel = 1 - math.Log(2)/(math.Log(100)-math.Log(2))
+)
+
+func TestRelatedness(t *testing.T) {
+	d := testDict()
+	tests := []struct {
+		name string
+		a, b int
+		want float64
+	}{
+		{"same page", 0, 0, 1},
+		{"shared in-links", 0, 2, relParisFrance},
+		{"symmetric", 2, 0, relParisFrance},
+		{"one shared in-link", 1, 3, relHiltonHotel},
+		{"no shared in-links", 0, 3, 0},
+		{"no in-links", 0, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.relatedness(tt.a, tt.b); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("relatedness(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+	// 全ての記事からリンクされている場合は1
+	d.NumArticles = 3
+	if got := d.relatedness(0, 2); got != 1 {
+		t.Errorf("relatedness with W <= in-links = %v, want 1", got)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	l := New(testDict())
+	cands := l.candidates(l.Dict.Anchors["paris"])
+	if len(cands) != 2 || cands[0].page != 0 || cands[1].page != 1 {
+		t.Fatalf("candidates = %+v, want Paris then Paris Hilton", cands)
+	}
+	if math.Abs(cands[0].commonness-300.0/405) > 1e-12 {
+		t.Errorf("commonness = %v, want %v", cands[0].commonness, 300.0/405)
+	}
+	l.MaxCandidates = 1
+	if cands := l.candidates(l.Dict.Anchors["paris"]); len(cands) != 1 || cands[0].page != 0 {
+		t.Errorf("candidates with MaxCandidates 1 = %+v, want Paris", cands)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	type want struct {
+		spot       string
+		start, end int
+		id         int
+		title      string
+		lp, rho    float64
+	}
+	tests := []struct {
+		name string
+		text string
+		want []want
+	}{
+		// フランスからの投票で、最も多く指しているパリを選ぶ
+		{"paris with france", "Paris, France", []want{
+			{"Paris", 0, 5, 100, "Paris", 0.5, (0.5 + relParisFrance) / 2},
+			{"France", 7, 13, 102, "France", 0.8, (0.8 + relParisFrance) / 2},
+		}},
+		// ホテルからの投票で、指す割合の低いパリス・ヒルトンを選ぶ（「the」は語句にしない）
+		{"paris with hotel", "Paris checked into the hotel", []want{
+			{"Paris", 0, 5, 101, "Paris Hilton", 0.5, (0.5 + relHiltonHotel) / 2},
+			{"hotel", 23, 28, 103, "Hotel", 0.1, (0.1 + relHiltonHotel) / 2},
+		}},
+		// 最も長い語句を選ぶ
+		{"longest anchor", "Paris Hilton", []want{
+			{"Paris Hilton", 0, 12, 101, "Paris Hilton", 0.9, 0.45},
+		}},
+		// 他に語句がない場合は、最も多く指している記事を選ぶ
+		{"paris alone", "paris", []want{
+			{"paris", 0, 5, 100, "Paris", 0.5, 0.25},
+		}},
+		{"no anchors", "The end", nil},
+	}
+	l := New(testDict())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := l.Annotate(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data.Annotations) != len(tt.want) {
+				t.Fatalf("got %d annotations %+v, want %d", len(data.Annotations), data.Annotations, len(tt.want))
+			}
+			for i, w := range tt.want {
+				a := data.Annotations[i]
+				if a.Spot != w.spot || a.Start != w.start || a.End != w.end || a.ID != w.id || a.Title != w.title {
+					t.Errorf("annotations[%d] = %q [%d:%d] %d %q, want %q [%d:%d] %d %q", i, a.Spot, a.Start, a.End, a.ID, a.Title, w.spot, w.start, w.end, w.id, w.title)
+				}
+				if math.Abs(a.LinkProbability-w.lp) > 1e-12 || math.Abs(a.Rho-w.rho) > 1e-12 {
+					t.Errorf("annotations[%d] (%s): lp, rho = %v, %v, want %v, %v", i, a.Spot, a.LinkProbability, a.Rho, w.lp, w.rho)
+				}
+			}
+		})
+	}
+}
+
+func TestMinLinkProbability(t *testing.T) {
+	l := New(testDict())
+	// リンクになる割合が0.1のホテルを語句にしない
+	l.MinLinkProbability = 0.2
+	data, err := l.Annotate("Paris checked into the hotel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Annotations) != 1 || data.Annotations[0].ID != 100 || data.Annotations[0].Rho != 0.25 {
+		t.Errorf("annotations = %+v, want Paris only", data.Annotations)
+	}
+}
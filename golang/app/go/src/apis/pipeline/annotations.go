@@ -0,0 +1,80 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+)
+
+// AnnotationsSchemaVersionはAnnotationsJSONの現在のスキーマのバージョン
+//
+//	1: events[].id, events[].annotations
+const AnnotationsSchemaVersion = 1
+
+// AnnotationsJSONはtagmeで抽出した全ての結果（閾値で取り除く前のもの）
+type AnnotationsJSON struct {
+	SchemaVersion int                `json:"schema_version"`
+	Events        []EventAnnotations `json:"events"`
+}
+
+// EventAnnotationsは一つのイベントの抽出結果
+type EventAnnotations struct {
+	Id          int          `json:"id"`
+	Annotations []Annotation `json:"annotations"`
+}
+
+// Annotationは本文中の一つの語句（Spot）と、それが指すWikipediaの記事（TagMe APIの結果と同じ形式）
+type Annotation struct {
+	Spot string `json:"spot"`
+	// 語句の本文中の位置
+	Start           int     `json:"start"`
+	LinkProbability float64 `json:"link_probability"`
+	Rho             float64 `json:"rho"`
+	End             int     `json:"end"`
+	// Wikipediaの記事ID
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+// Validateは抽出結果が現在のスキーマに従っているかどうかを確認する
+func (d AnnotationsJSON) Validate() error {
+	if err := checkVersion("annotations", d.SchemaVersion, AnnotationsSchemaVersion); err != nil {
+		return err
+	}
+	ids := make(map[int]bool)
+	for i, e := range d.Events {
+		if ids[e.Id] {
+			return fmt.Errorf("events[%d]: duplicate id %d", i, e.Id)
+		}
+		ids[e.Id] = true
+		for j, a := range e.Annotations {
+			if math.IsNaN(a.LinkProbability) || math.IsNaN(a.Rho) {
+				return fmt.Errorf("events[%d] (id %d): annotations[%d] is not finite", i, e.Id, j)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadAnnotationsはファイルから抽出結果を読み込み、スキーマに従っているかどうかを確認する
+func ReadAnnotations(path string) (AnnotationsJSON, error) {
+	var d AnnotationsJSON
+	err := readJson(path, &d)
+	if err != nil {
+		return AnnotationsJSON{}, err
+	}
+	err = d.Validate()
+	if err != nil {
+		return AnnotationsJSON{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteAnnotationsは抽出結果を現在のスキーマのバージョンでファイルに書き込む
+func WriteAnnotations(path string, d AnnotationsJSON) error {
+	d.SchemaVersion = AnnotationsSchemaVersion
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// EventsSchemaVersionはEventsDataJSONの現在のスキーマのバージョン
+//
+//	1: id, date, text, entities, tf_idf, entropy
+//	2: entity_sources
+//	3: entity_sources[].page_id
+//	4: category, tags
+const EventsSchemaVersion = 4
+
+// EventsDataJSONは各工程（tagme → toPy → topics）で受け渡すイベントデータ
+type EventsDataJSON struct {
+	SchemaVersion int         `json:"schema_version"`
+	Events        []EventData `json:"events"`
+}
+
+// EventDataは一つのイベントと、各工程で付け加えられる値を保持する
+type EventData struct {
+	Id       int                `json:"id"`
+	Date     string             `json:"date"`
+	Text     string             `json:"text"`
+	Entities []string           `json:"entities"`
+	TfIdf    map[string]float64 `json:"tf_idf"`
+	Entropy  float64            `json:"entropy"`
+	// エンティティの出所（バージョン2から）
+	EntitySources []EntitySource `json:"entity_sources,omitempty"`
+	// Current_eventsでのカテゴリと、イベントが置かれていた見出し（外側から順、バージョン4から）
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// エンティティの出所
+const (
+	// TagMe（またはオフラインのリンカー）で抽出した
+	ProvenanceTagMe = "tagme"
+	// Wikipediaの編集者がイベントの本文にリンクを張っていた
+	ProvenanceHyperlink = "hyperlink"
+	// 両方
+	ProvenanceBoth = "both"
+)
+
+// EntitySourceは一つのエンティティと、その出所
+type EntitySource struct {
+	// Wikipediaの記事ID（不明な場合は0）
+	PageId int `json:"page_id,omitempty"`
+	// 記事名（例：Joe Biden）
+	Title string `json:"title"`
+	// 本文中の語句（Entitiesに含まれる文字列、本文に出現しない場合は空文字）
+	Spot       string `json:"spot"`
+	Provenance string `json:"provenance"`
+}
+
+// Validateはイベントデータが現在のスキーマに従っているかどうかを確認する
+func (d EventsDataJSON) Validate() error {
+	if err := checkVersion("events", d.SchemaVersion, EventsSchemaVersion); err != nil {
+		return err
+	}
+	ids := make(map[int]bool)
+	for i, e := range d.Events {
+		if ids[e.Id] {
+			return fmt.Errorf("events[%d]: duplicate id %d", i, e.Id)
+		}
+		ids[e.Id] = true
+		if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+			return fmt.Errorf("events[%d] (id %d): invalid date %q", i, e.Id, e.Date)
+		}
+		for k, v := range e.TfIdf {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("events[%d] (id %d): tf_idf[%s] is not finite", i, e.Id, k)
+			}
+		}
+		if math.IsNaN(e.Entropy) || math.IsInf(e.Entropy, 0) {
+			return fmt.Errorf("events[%d] (id %d): entropy is not finite", i, e.Id)
+		}
+		for j, src := range e.EntitySources {
+			switch src.Provenance {
+			case ProvenanceTagMe, ProvenanceHyperlink, ProvenanceBoth:
+			default:
+				return fmt.Errorf("events[%d] (id %d): entity_sources[%d]: unknown provenance %q", i, e.Id, j, src.Provenance)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadEventsはファイルからイベントデータを読み込み、スキーマに従っているかどうかを確認する
+func ReadEvents(path string) (EventsDataJSON, error) {
+	var d EventsDataJSON
+	err := readJson(path, &d)
+	if err != nil {
+		return EventsDataJSON{}, err
+	}
+	// schema_versionがないファイルは、バージョンを付ける前（バージョン1）に書き出されたものとして読み込む
+	if d.SchemaVersion == 0 {
+		d.SchemaVersion = 1
+	}
+	// バージョン1から3は、entity_sourcesやpage_id、category、tagsがないだけなので、そのまま読み込める
+	if 1 <= d.SchemaVersion && d.SchemaVersion < EventsSchemaVersion {
+		d.SchemaVersion = EventsSchemaVersion
+	}
+	err = d.Validate()
+	if err != nil {
+		return EventsDataJSON{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteEventsはイベントデータを現在のスキーマのバージョンでファイルに書き込む
+func WriteEvents(path string, d EventsDataJSON) error {
+	d.SchemaVersion = EventsSchemaVersion
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
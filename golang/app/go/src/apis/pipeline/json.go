@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// checkVersionはファイルのスキーマのバージョンが読み込めるものかどうかを確認する
+func checkVersion(name string, got, want int) error {
+	if got != want {
+		return fmt.Errorf("%s: unsupported schema_version %d (want %d)", name, got, want)
+	}
+	return nil
+}
+
+// readJsonはJSONファイルを読み込む。
+// 知らない項目があった場合はエラーを戻し、ある工程で追加した値が別の工程で黙って失われないようにする。
+func readJson(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+func writeJson(path string, v any) error {
+	output, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, output, 0644)
+}
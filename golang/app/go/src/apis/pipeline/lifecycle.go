@@ -0,0 +1,103 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// LifecycleSchemaVersionはLifecycleの現在のスキーマのバージョン
+//
+//	1: events[].type, topic, date, event_id, novelty, similarity, into
+//	2: topic, intoを、生まれた順の番号からトピックの最初のイベントのIDにした
+const LifecycleSchemaVersion = 2
+
+// トピックの変化の種類
+const (
+	// 新しいトピックが生まれた（最初の記事）
+	TopicBorn = "born"
+	// トピックにイベントが加わった
+	TopicUpdated = "updated"
+	// 一定の期間イベントが加わらず、トピックが終わった
+	TopicDormant = "dormant"
+	// トピックが別のトピックにまとめられた
+	TopicMerged = "merged"
+)
+
+// Lifecycleはトピックが生まれてから終わるまでの変化を、起きた順に記録したもの
+type Lifecycle struct {
+	SchemaVersion int          `json:"schema_version"`
+	Events        []TopicEvent `json:"events"`
+}
+
+// TopicEventはトピックの一つの変化
+type TopicEvent struct {
+	Type string `json:"type"`
+	// トピックの最初のイベントのID（まとめられなかったトピックは、topics.jsonでこのイベントを含むトピック）
+	Topic int `json:"topic"`
+	// 変化が起きた日付（dormantでは最後にイベントが加わった日から期間が過ぎた日）
+	Date string `json:"date"`
+	// 変化のもとになったイベントのID（born, updated）
+	EventId int `json:"event_id,omitempty"`
+	// 既存のどのトピックとも似ていない度合い（1-最も高いコサイン類似度、born）
+	Novelty float64 `json:"novelty,omitempty"`
+	// イベントやトピックとのコサイン類似度（updated, merged）
+	Similarity float64 `json:"similarity,omitempty"`
+	// まとめた先のトピックの最初のイベントのID（merged）
+	Into int `json:"into,omitempty"`
+}
+
+// Validateは記録が現在のスキーマに従っているかどうかを確認する
+func (d Lifecycle) Validate() error {
+	if err := checkVersion("lifecycle", d.SchemaVersion, LifecycleSchemaVersion); err != nil {
+		return err
+	}
+	for i, e := range d.Events {
+		switch e.Type {
+		case TopicBorn, TopicUpdated, TopicDormant:
+		case TopicMerged:
+			if e.Into < 1 {
+				return fmt.Errorf("events[%d]: merged event has no into", i)
+			}
+		default:
+			return fmt.Errorf("events[%d]: unknown type %q", i, e.Type)
+		}
+		if e.Topic < 1 {
+			return fmt.Errorf("events[%d]: topic must be a positive event id", i)
+		}
+		if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+			return fmt.Errorf("events[%d]: %v", i, err)
+		}
+		if math.IsNaN(e.Novelty) || math.IsNaN(e.Similarity) {
+			return fmt.Errorf("events[%d]: novelty or similarity is not finite", i)
+		}
+	}
+	return nil
+}
+
+// ReadLifecycleはファイルから記録を読み込み、スキーマに従っているかどうかを確認する
+func ReadLifecycle(path string) (Lifecycle, error) {
+	var d Lifecycle
+	err := readJson(path, &d)
+	if err != nil {
+		return Lifecycle{}, err
+	}
+	err = d.Validate()
+	if err != nil {
+		return Lifecycle{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteLifecycleは記録を現在のスキーマのバージョンでファイルに書き込む
+func WriteLifecycle(path string, d Lifecycle) error {
+	d.SchemaVersion = LifecycleSchemaVersion
+	if d.Events == nil {
+		d.Events = []TopicEvent{}
+	}
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+)
+
+// RefineSchemaVersionはRefineLogの現在のスキーマのバージョン
+//
+//	1: decisions[].action, accepted, topics, result, sizes, similarity, cohesion, reason
+const RefineSchemaVersion = 1
+
+// 分類後の処理の種類
+const (
+	RefineMerge = "merge"
+	RefineSplit = "split"
+)
+
+// RefineLogは分類した後に、トピックをまとめたり分けたりした判断を、判断した順に記録したもの
+type RefineLog struct {
+	SchemaVersion int              `json:"schema_version"`
+	Decisions     []RefineDecision `json:"decisions"`
+}
+
+// RefineDecisionは一つの判断。見送った判断も理由と共に記録する。
+// トピックは、含まれるイベントのうち最も小さいIDで表す。
+type RefineDecision struct {
+	Action   string `json:"action"`
+	Accepted bool   `json:"accepted"`
+	// 判断の対象のトピック
+	Topics []int `json:"topics"`
+	// 判断の結果のトピック（見送った場合は空）
+	Result []int `json:"result,omitempty"`
+	// 結果のトピック（見送った場合は対象のトピック）のイベントの数
+	Sizes []int `json:"sizes"`
+	// トピックの重心のコサイン類似度（merge）
+	Similarity float64 `json:"similarity,omitempty"`
+	// イベントのベクトルと重心のコサイン類似度の平均（split）
+	Cohesion float64 `json:"cohesion,omitempty"`
+	Reason   string  `json:"reason"`
+}
+
+// Validateは記録が現在のスキーマに従っているかどうかを確認する
+func (d RefineLog) Validate() error {
+	if err := checkVersion("refine", d.SchemaVersion, RefineSchemaVersion); err != nil {
+		return err
+	}
+	for i, v := range d.Decisions {
+		if v.Action != RefineMerge && v.Action != RefineSplit {
+			return fmt.Errorf("decisions[%d]: unknown action %q", i, v.Action)
+		}
+		if len(v.Topics) == 0 {
+			return fmt.Errorf("decisions[%d]: no topics", i)
+		}
+		if v.Accepted && len(v.Result) == 0 {
+			return fmt.Errorf("decisions[%d]: accepted decision has no result", i)
+		}
+		if math.IsNaN(v.Similarity) || math.IsNaN(v.Cohesion) {
+			return fmt.Errorf("decisions[%d]: similarity or cohesion is not finite", i)
+		}
+	}
+	return nil
+}
+
+// ReadRefineLogはファイルから記録を読み込み、スキーマに従っているかどうかを確認する
+func ReadRefineLog(path string) (RefineLog, error) {
+	var d RefineLog
+	err := readJson(path, &d)
+	if err != nil {
+		return RefineLog{}, err
+	}
+	err = d.Validate()
+	if err != nil {
+		return RefineLog{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteRefineLogは記録を現在のスキーマのバージョンでファイルに書き込む
+func WriteRefineLog(path string, d RefineLog) error {
+	d.SchemaVersion = RefineSchemaVersion
+	if d.Decisions == nil {
+		d.Decisions = []RefineDecision{}
+	}
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+)
+
+// RejectionsSchemaVersionはRejectionsの現在のスキーマのバージョン
+//
+//	1: mode, epsilon, rejections[].event_id, date, entropy, topic, similarity, assigned_topic, assigned_similarity,
+//	   conflict_date, conflict_entropy, slope, reason
+//	2: topic, assigned_topicを、作った順の番号からトピックの最も小さいイベントのIDにした
+const RejectionsSchemaVersion = 2
+
+// Rejectionsは、情報エントロピーの制約によって、最も類似したトピックに加えなかったイベントを、分類した順に記録したもの
+type Rejections struct {
+	SchemaVersion int `json:"schema_version"`
+	// 制約の種類（strict, tolerance, trend）と、許容する幅
+	Mode       string      `json:"mode"`
+	Epsilon    float64     `json:"epsilon"`
+	Rejections []Rejection `json:"rejections"`
+}
+
+// Rejectionは一つのイベントを最も類似したトピックに加えなかった理由。
+// トピックは、分類を終えた時点（まとめたり分けたりする前）で含まれるイベントのうち最も小さいIDで表す（RefineDecisionと同じ）。
+// -refineを指定した場合は、refine.jsonの判断をたどると、topics.jsonのどのトピックになったかが分かる。
+type Rejection struct {
+	EventId int     `json:"event_id"`
+	Date    string  `json:"date"`
+	Entropy float64 `json:"entropy"`
+	// 最も類似したトピックと、そのコサイン類似度
+	Topic      int     `json:"topic"`
+	Similarity float64 `json:"similarity"`
+	// 代わりに加えたトピックと、そのコサイン類似度（新しいトピックにした場合は、そのトピックと0）
+	AssignedTopic      int     `json:"assigned_topic"`
+	AssignedSimilarity float64 `json:"assigned_similarity"`
+	// 制約に違反した日と、その日の情報エントロピーの平均（strict, tolerance）
+	ConflictDate    string  `json:"conflict_date,omitempty"`
+	ConflictEntropy float64 `json:"conflict_entropy,omitempty"`
+	// イベントを加えた場合の、日ごとの情報エントロピーの平均の回帰直線の傾き（trend、1日あたり）
+	Slope  float64 `json:"slope,omitempty"`
+	Reason string  `json:"reason"`
+}
+
+// Validateは記録が現在のスキーマに従っているかどうかを確認する
+func (d Rejections) Validate() error {
+	if err := checkVersion("rejections", d.SchemaVersion, RejectionsSchemaVersion); err != nil {
+		return err
+	}
+	for i, v := range d.Rejections {
+		if v.Topic < 1 || v.AssignedTopic < 1 {
+			return fmt.Errorf("rejections[%d] (event %d): topic must be a positive event id", i, v.EventId)
+		}
+		if v.Topic == v.AssignedTopic {
+			return fmt.Errorf("rejections[%d] (event %d): assigned to the rejected topic %d", i, v.EventId, v.Topic)
+		}
+		if math.IsNaN(v.Entropy) || math.IsNaN(v.Similarity) || math.IsNaN(v.Slope) {
+			return fmt.Errorf("rejections[%d] (event %d): value is not finite", i, v.EventId)
+		}
+	}
+	return nil
+}
+
+// ReadRejectionsはファイルから記録を読み込み、スキーマに従っているかどうかを確認する
+func ReadRejections(path string) (Rejections, error) {
+	var d Rejections
+	err := readJson(path, &d)
+	if err != nil {
+		return Rejections{}, err
+	}
+	err = d.Validate()
+	if err != nil {
+		return Rejections{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteRejectionsは記録を現在のスキーマのバージョンでファイルに書き込む
+func WriteRejections(path string, d Rejections) error {
+	d.SchemaVersion = RejectionsSchemaVersion
+	if d.Rejections == nil {
+		d.Rejections = []Rejection{}
+	}
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
@@ -0,0 +1,226 @@
+package pipeline
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 各工程の実行結果を記録するファイル（実行ディレクトリに置かれる）
+const manifestName = "manifest.json"
+
+// Stageはパイプラインの一つの工程
+type Stage struct {
+	Name string
+	// 読み込むファイルと書き出すファイル（実行ディレクトリからの相対パス）
+	// 工程の依存関係は、ある工程のInputsを別の工程のOutputsが含むかどうかで決まる
+	Inputs  []string
+	Outputs []string
+	// 結果に影響するパラメータ、変わった場合は実行し直す
+	Params string
+	// dirは実行ディレクトリ
+	Run func(dir string) error
+}
+
+// Runnerは工程の依存関係に従って、実行ディレクトリで各工程を実行する。
+// 入力ファイルとパラメータが前回の実行から変わっていない工程は実行しない。
+type Runner struct {
+	Dir    string
+	Stages []Stage
+	// Fromで指定した工程とそれに依存する工程は、変更の有無に関わらず実行する
+	From string
+	Log  io.Writer
+}
+
+// stageRecordは工程を実行した時の入力のハッシュ値を保持する
+type stageRecord struct {
+	InputHash string    `json:"input_hash"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Runは全ての工程を実行する
+func (r *Runner) Run() error {
+	if r.Log == nil {
+		r.Log = io.Discard
+	}
+	order, err := sortStages(r.Stages)
+	if err != nil {
+		return err
+	}
+	forced, err := r.forcedStages(order)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(r.Dir, 0755)
+	if err != nil {
+		return err
+	}
+	manifest, err := r.loadManifest()
+	if err != nil {
+		return err
+	}
+	for _, s := range order {
+		hash, err := r.inputHash(s)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if rec, found := manifest[s.Name]; found && !forced[s.Name] && rec.InputHash == hash && r.outputsExist(s) {
+			fmt.Fprintf(r.Log, "[%s] up to date\n", s.Name)
+			continue
+		}
+		// Fromより前の工程は、結果のファイルがあれば実行しない
+		if r.From != "" && !forced[s.Name] && r.outputsExist(s) {
+			fmt.Fprintf(r.Log, "[%s] skipped (before %s)\n", s.Name, r.From)
+			continue
+		}
+		fmt.Fprintf(r.Log, "[%s] started\n", s.Name)
+		started := time.Now()
+		err = s.Run(r.Dir)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.Name, err)
+		}
+		if !r.outputsExist(s) {
+			return fmt.Errorf("%s: some outputs were not written: %v", s.Name, s.Outputs)
+		}
+		manifest[s.Name] = stageRecord{InputHash: hash, Finished: time.Now()}
+		err = r.saveManifest(manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(r.Log, "[%s] finished (%s)\n", s.Name, time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// sortStagesは依存する工程が先に来るように、工程を並び替える
+func sortStages(stages []Stage) ([]Stage, error) {
+	producer := make(map[string]string)
+	for _, s := range stages {
+		for _, out := range s.Outputs {
+			if p, found := producer[out]; found {
+				return nil, fmt.Errorf("%s is written by both %s and %s", out, p, s.Name)
+			}
+			producer[out] = s.Name
+		}
+	}
+	byName := make(map[string]Stage)
+	for _, s := range stages {
+		byName[s.Name] = s
+	}
+	// 0: 未訪問、1: 訪問中、2: 訪問済み
+	state := make(map[string]int)
+	var order []Stage
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("stages have a cycle at %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, in := range byName[name].Inputs {
+			if p, found := producer[in]; found {
+				if err := visit(p); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		order = append(order, byName[name])
+		return nil
+	}
+	for _, s := range stages {
+		if err := visit(s.Name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// forcedStagesはFromで指定した工程と、それに依存する全ての工程を戻す
+func (r *Runner) forcedStages(order []Stage) (map[string]bool, error) {
+	forced := make(map[string]bool)
+	if r.From == "" {
+		return forced, nil
+	}
+	found := false
+	for _, s := range order {
+		if s.Name == r.From {
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown stage: %s", r.From)
+	}
+	forced[r.From] = true
+	// orderは依存する工程が先に来るので、一度なぞるだけで全ての子孫が見つかる
+	forcedOutputs := make(map[string]bool)
+	for _, s := range order {
+		for _, in := range s.Inputs {
+			if forcedOutputs[in] {
+				forced[s.Name] = true
+			}
+		}
+		if forced[s.Name] {
+			for _, out := range s.Outputs {
+				forcedOutputs[out] = true
+			}
+		}
+	}
+	return forced, nil
+}
+
+// inputHashは工程の入力ファイルの内容とパラメータのハッシュ値を戻す
+func (r *Runner) inputHash(s Stage) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "params:%s\n", s.Params)
+	for _, in := range s.Inputs {
+		f, err := os.Open(filepath.Join(r.Dir, in))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "input:%s\n", in)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (r *Runner) outputsExist(s Stage) bool {
+	for _, out := range s.Outputs {
+		if _, err := os.Stat(filepath.Join(r.Dir, out)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Runner) loadManifest() (map[string]stageRecord, error) {
+	manifest := make(map[string]stageRecord)
+	b, err := os.ReadFile(filepath.Join(r.Dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (r *Runner) saveManifest(manifest map[string]stageRecord) error {
+	return writeJson(filepath.Join(r.Dir, manifestName), manifest)
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stubStagesは、source.txtからa → b → cと続く工程と、source.txtだけを読むdの工程を、依存関係と逆の順に戻す。
+// 各工程は入力ファイルの内容とパラメータをつなげて書き出し、実行した工程の名前をranに加える。
+func stubStages(params map[string]string, ran *[]string) []Stage {
+	stage := func(name string, inputs ...string) Stage {
+		return Stage{
+			Name:    name,
+			Inputs:  inputs,
+			Outputs: []string{name + ".txt"},
+			Params:  params[name],
+			Run: func(dir string) error {
+				*ran = append(*ran, name)
+				var b strings.Builder
+				for _, in := range inputs {
+					content, err := os.ReadFile(filepath.Join(dir, in))
+					if err != nil {
+						return err
+					}
+					b.Write(content)
+				}
+				b.WriteString(params[name] + "\n")
+				return os.WriteFile(filepath.Join(dir, name+".txt"), []byte(b.String()), 0644)
+			},
+		}
+	}
+	return []Stage{
+		stage("c", "b.txt"),
+		stage("d", "source.txt"),
+		stage("b", "a.txt"),
+		stage("a", "source.txt"),
+	}
+}
+
+// runStagesはstubStagesを実行し、実行した工程の名前を戻す
+func runStages(t *testing.T, dir, from string, params map[string]string) []string {
+	t.Helper()
+	var ran []string
+	r := Runner{Dir: dir, Stages: stubStages(params, &ran), From: from}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return ran
+}
+
+func writeSource(t *testing.T, dir, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "source.txt"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunnerOrder(t *testing.T) {
+	dir := t.TempDir()
+	writeSource(t, dir, "v1")
+	// 依存する工程を先に実行し、依存関係のない工程は元の順番のままにする
+	if got, want := runStages(t, dir, "", nil), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunnerInvalidStages(t *testing.T) {
+	noop := func(string) error { return nil }
+	tests := []struct {
+		name   string
+		stages []Stage
+		from   string
+	}{
+		{"cycle", []Stage{
+			{Name: "a", Inputs: []string{"b.txt"}, Outputs: []string{"a.txt"}, Run: noop},
+			{Name: "b", Inputs: []string{"a.txt"}, Outputs: []string{"b.txt"}, Run: noop},
+		}, ""},
+		{"same output", []Stage{
+			{Name: "a", Outputs: []string{"x.txt"}, Run: noop},
+			{Name: "b", Outputs: []string{"x.txt"}, Run: noop},
+		}, ""},
+		{"unknown from", []Stage{{Name: "a", Outputs: []string{"a.txt"}, Run: noop}}, "b"},
+		{"missing output", []Stage{{Name: "a", Outputs: []string{"a.txt"}, Run: noop}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{Dir: t.TempDir(), Stages: tt.stages, From: tt.from}
+			if err := r.Run(); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestRunnerSkipsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	writeSource(t, dir, "v1")
+	params := map[string]string{"a": "x=1"}
+	runStages(t, dir, "", params)
+	if got := runStages(t, dir, "", params); len(got) != 0 {
+		t.Errorf("ran %v, want nothing", got)
+	}
+}
+
+func TestRunnerRerunsChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string, params map[string]string)
+		want   []string
+	}{
+		{"input", func(t *testing.T, dir string, params map[string]string) {
+			writeSource(t, dir, "v2")
+		}, []string{"a", "b", "c", "d"}},
+		{"params", func(t *testing.T, dir string, params map[string]string) {
+			params["b"] = "x=2"
+		}, []string{"b", "c"}},
+		// 入力が同じでも、結果のファイルがなければ実行し直す
+		{"output removed", func(t *testing.T, dir string, params map[string]string) {
+			if err := os.Remove(filepath.Join(dir, "d.txt")); err != nil {
+				t.Fatal(err)
+			}
+		}, []string{"d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeSource(t, dir, "v1")
+			params := map[string]string{"b": "x=1"}
+			runStages(t, dir, "", params)
+			tt.change(t, dir, params)
+			if got := runStages(t, dir, "", params); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ran %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunnerFrom(t *testing.T) {
+	dir := t.TempDir()
+	writeSource(t, dir, "v1")
+	runStages(t, dir, "", nil)
+	// 変わっていなくても、指定した工程とそれに依存する工程を実行し直す
+	if got, want := runStages(t, dir, "b", nil), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+	// 指定した工程より前の工程は、入力が変わっていても結果のファイルがあれば実行しない
+	writeSource(t, dir, "v2")
+	if got, want := runStages(t, dir, "c", nil), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v, want %v", got, want)
+	}
+	if got, want := runStages(t, dir, "", nil), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %v after -from, want %v", got, want)
+	}
+}
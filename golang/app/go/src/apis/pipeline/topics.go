@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TopicsSchemaVersionはTopicsの現在のスキーマのバージョン
+//
+//	1: result[].doc_ids, result[].center_gravity
+//	2: result[].count
+const TopicsSchemaVersion = 2
+
+// Topicsはトピックの分類結果
+type Topics struct {
+	SchemaVersion int     `json:"schema_version"`
+	Result        []Topic `json:"result"`
+}
+
+type Topic struct {
+	DocIds        map[int]Document   `json:"doc_ids"`
+	CenterGravity map[string]float64 `json:"center_gravity"`
+	// 重心に足したベクトルの数
+	Count int `json:"count"`
+}
+
+type Document struct {
+	Date    time.Time `json:"date"`
+	Entropy float64   `json:"entropy"`
+}
+
+// NewTopicは一つのイベントからトピックを作る。
+// 重心はベクトルを写したものにするため、重心を更新してもイベントのベクトルは変わらない。
+func NewTopic(id int, doc Document, n map[string]float64) Topic {
+	t := Topic{DocIds: map[int]Document{id: doc}, CenterGravity: make(map[string]float64, len(n)), Count: 1}
+	for k, v := range n {
+		t.CenterGravity[k] = v
+	}
+	return t
+}
+
+// CulcCenterOfGravityは重心にベクトルを足し、これまでに足した全てのベクトルの平均にする。
+// 平均なので、足す順番によらず同じ重心になる。
+func (t *Topic) CulcCenterOfGravity(n map[string]float64) {
+	t.Count++
+	t.moveCenter(n, 1/float64(t.Count))
+}
+
+// CulcCenterOfGravityDecayは重心を、足したベクトルへdecay（0〜1）の割合だけ近づける（指数移動平均）。
+// 新しいイベントほど重く扱われるため、足す順番によって重心が変わる。
+func (t *Topic) CulcCenterOfGravityDecay(n map[string]float64, decay float64) {
+	t.Count++
+	t.moveCenter(n, decay)
+}
+
+// Copyはイベントと重心を写したトピックを戻す（写したトピックを変えても元のトピックは変わらない）
+func (t Topic) Copy() Topic {
+	c := Topic{DocIds: make(map[int]Document, len(t.DocIds)), CenterGravity: make(map[string]float64, len(t.CenterGravity)), Count: t.Count}
+	for id, doc := range t.DocIds {
+		c.DocIds[id] = doc
+	}
+	for k, v := range t.CenterGravity {
+		c.CenterGravity[k] = v
+	}
+	return c
+}
+
+// Mergeはトピックoのイベントをトピックに加える。
+// 重心は、それぞれの重心を足したベクトルの数で重み付けした平均にする。
+func (t *Topic) Merge(o Topic) {
+	for id, doc := range o.DocIds {
+		t.DocIds[id] = doc
+	}
+	total := t.Count + o.Count
+	if total == 0 {
+		return
+	}
+	rate := float64(o.Count) / float64(total)
+	t.Count = total
+	t.moveCenter(o.CenterGravity, rate)
+}
+
+// moveCenterは重心cを、c+(n-c)*rateにする（nにない要素は0として扱う）
+func (t *Topic) moveCenter(n map[string]float64, rate float64) {
+	if t.CenterGravity == nil {
+		t.CenterGravity = make(map[string]float64, len(n))
+	}
+	for k, v := range t.CenterGravity {
+		if _, found := n[k]; !found {
+			t.CenterGravity[k] = v - v*rate
+		}
+	}
+	for k, v := range n {
+		c := t.CenterGravity[k]
+		t.CenterGravity[k] = c + (v-c)*rate
+	}
+}
+
+// Validateは分類結果が現在のスキーマに従っているかどうかを確認する
+func (d Topics) Validate() error {
+	if err := checkVersion("topics", d.SchemaVersion, TopicsSchemaVersion); err != nil {
+		return err
+	}
+	for i, t := range d.Result {
+		if len(t.DocIds) == 0 {
+			return fmt.Errorf("result[%d]: topic has no documents", i)
+		}
+		if t.Count < 1 {
+			return fmt.Errorf("result[%d]: count must be positive", i)
+		}
+		for k, v := range t.CenterGravity {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Errorf("result[%d]: center_gravity[%s] is not finite", i, k)
+			}
+		}
+	}
+	return nil
+}
+
+// ReadTopicsはファイルから分類結果を読み込み、スキーマに従っているかどうかを確認する
+func ReadTopics(path string) (Topics, error) {
+	var d Topics
+	err := readJson(path, &d)
+	if err != nil {
+		return Topics{}, err
+	}
+	// schema_versionがないファイルは、バージョンを付ける前（バージョン1）に書き出されたものとして読み込む
+	if d.SchemaVersion == 0 {
+		d.SchemaVersion = 1
+	}
+	// バージョン1にはcountがないため、イベントの数を重心に足したベクトルの数とする
+	if d.SchemaVersion == 1 {
+		for i := range d.Result {
+			d.Result[i].Count = len(d.Result[i].DocIds)
+		}
+		d.SchemaVersion = TopicsSchemaVersion
+	}
+	err = d.Validate()
+	if err != nil {
+		return Topics{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return d, nil
+}
+
+// WriteTopicsは分類結果を現在のスキーマのバージョンでファイルに書き込む
+func WriteTopics(path string, d Topics) error {
+	d.SchemaVersion = TopicsSchemaVersion
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	return writeJson(path, d)
+}
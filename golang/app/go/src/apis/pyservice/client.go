@@ -0,0 +1,183 @@
+package pyservice
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ClientはPythonのAPIでTF-IDFを計算するクライアント
+type Client struct {
+	// APIのURL（例：http://python3:8050）
+	BaseUrl string
+	// 一度に送るイベントの数、これより多い場合はセッションで分けて送る
+	ChunkSize int
+	// ヘルスチェックのタイムアウト
+	HealthTimeout time.Duration
+	// 計算を含む、一つのリクエストのタイムアウト
+	Timeout time.Duration
+}
+
+// NewClientは初期値のクライアントを戻す
+func NewClient(baseUrl string) *Client {
+	return &Client{
+		BaseUrl:       strings.TrimRight(baseUrl, "/"),
+		ChunkSize:     2000,
+		HealthTimeout: 5 * time.Second,
+		Timeout:       10 * time.Minute,
+	}
+}
+
+// APIErrorはAPIが2xx以外のステータスを戻した場合のエラー
+type APIError struct {
+	StatusCode int
+	Msg        string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("python api: %d: %s", e.StatusCode, e.Msg)
+}
+
+// HealthはAPIが動いていて、現在のスキーマのバージョンを扱えるかどうかを確認する
+func (c *Client) Health() (HealthResponse, error) {
+	var h HealthResponse
+	err := c.do(http.MethodGet, healthPath, "", nil, c.HealthTimeout, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&h)
+	})
+	if err != nil {
+		return HealthResponse{}, err
+	}
+	if h.Status != "ok" {
+		return h, fmt.Errorf("python api is not ready: %s", h.Status)
+	}
+	if h.SchemaVersion != pipeline.EventsSchemaVersion {
+		return h, fmt.Errorf("python api supports schema_version %d (want %d)", h.SchemaVersion, pipeline.EventsSchemaVersion)
+	}
+	return h, nil
+}
+
+// TfIdfは全てのイベントのTF-IDFを計算して、TfIdfを設定したイベントデータを戻す。
+// イベントの数がChunkSizeより多い場合は、セッションで分けて送る。
+func (c *Client) TfIdf(d pipeline.EventsDataJSON) (pipeline.EventsDataJSON, error) {
+	_, err := c.Health()
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	d.SchemaVersion = pipeline.EventsSchemaVersion
+	if c.ChunkSize <= 0 || len(d.Events) <= c.ChunkSize {
+		return c.tfidfAtOnce(d)
+	}
+	return c.tfidfInChunks(d)
+}
+
+func (c *Client) tfidfAtOnce(d pipeline.EventsDataJSON) (pipeline.EventsDataJSON, error) {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	var res TfIdfResponse
+	err = c.do(http.MethodPost, tfidfPath, "application/json", body, c.Timeout, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&res)
+	})
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	if res.SchemaVersion != pipeline.EventsSchemaVersion {
+		return pipeline.EventsDataJSON{}, fmt.Errorf("python api returned schema_version %d (want %d)", res.SchemaVersion, pipeline.EventsSchemaVersion)
+	}
+	return applyResults(d, res.Results)
+}
+
+func (c *Client) tfidfInChunks(d pipeline.EventsDataJSON) (pipeline.EventsDataJSON, error) {
+	var session SessionResponse
+	err := c.do(http.MethodPost, sessionsPath, "", nil, c.HealthTimeout, func(body io.Reader) error {
+		return json.NewDecoder(body).Decode(&session)
+	})
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	path := sessionsPath + "/" + session.SessionId
+	// 計算が終わるとセッションは消えるが、途中で失敗した場合に備えて消しておく
+	defer c.do(http.MethodDelete, path, "", nil, c.HealthTimeout, nil)
+
+	for start := 0; start < len(d.Events); start += c.ChunkSize {
+		end := start + c.ChunkSize
+		if end > len(d.Events) {
+			end = len(d.Events)
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, e := range d.Events[start:end] {
+			if err := enc.Encode(e); err != nil {
+				return pipeline.EventsDataJSON{}, err
+			}
+		}
+		var res SessionResponse
+		err = c.do(http.MethodPost, path+"/events", ndjsonType, buf.Bytes(), c.Timeout, func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&res)
+		})
+		if err != nil {
+			return pipeline.EventsDataJSON{}, fmt.Errorf("events[%d:%d]: %v", start, end, err)
+		}
+		if res.Received != end {
+			return pipeline.EventsDataJSON{}, fmt.Errorf("python api received %d events (sent %d)", res.Received, end)
+		}
+	}
+
+	var results []TfIdfResult
+	err = c.do(http.MethodPost, path+"/tfidf", "", nil, c.Timeout, func(body io.Reader) error {
+		sc := bufio.NewScanner(body)
+		sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var r TfIdfResult
+			if err := json.Unmarshal(line, &r); err != nil {
+				return err
+			}
+			results = append(results, r)
+		}
+		return sc.Err()
+	})
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	return applyResults(d, results)
+}
+
+// doはリクエストを送り、2xxのステータスであればreadで本文を読み込む
+func (c *Client) do(method, path, contentType string, body []byte, timeout time.Duration, read func(io.Reader) error) error {
+	req, err := http.NewRequest(method, c.BaseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	hc := http.Client{Timeout: timeout}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		var e ErrorResponse
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		if json.Unmarshal(b, &e) != nil || e.Error == "" {
+			e.Error = strings.TrimSpace(string(b))
+		}
+		return &APIError{StatusCode: res.StatusCode, Msg: e.Error}
+	}
+	if read == nil {
+		return nil
+	}
+	return read(res.Body)
+}
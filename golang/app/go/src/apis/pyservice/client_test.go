@@ -0,0 +1,174 @@
+package pyservice
+
+import (
+	"errors"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tfidfEventsはanalysisのgensimとの比較に用いるイベント
+func tfidfEvents(t *testing.T) pipeline.EventsDataJSON {
+	t.Helper()
+	d, err := pipeline.ReadEvents("../analysis/testdata/tfidf_events.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// assertTfIdfはgotのTF-IDFが、analysis.SetTfIdfで計算したものと同じかどうかを確かめる
+func assertTfIdf(t *testing.T, d, got pipeline.EventsDataJSON) {
+	t.Helper()
+	want := pipeline.EventsDataJSON{Events: append([]pipeline.EventData(nil), d.Events...)}
+	analysis.SetTfIdf(&want, analysis.DefaultTfIdfOption())
+	if len(got.Events) != len(want.Events) {
+		t.Fatalf("got %d events, want %d", len(got.Events), len(want.Events))
+	}
+	for i, w := range want.Events {
+		g := got.Events[i]
+		if g.Id != w.Id || len(g.TfIdf) != len(w.TfIdf) {
+			t.Errorf("events[%d]: got event %d %v, want event %d %v", i, g.Id, g.TfIdf, w.Id, w.TfIdf)
+			continue
+		}
+		for k, v := range w.TfIdf {
+			if math.Abs(g.TfIdf[k]-v) > 1e-12 {
+				t.Errorf("event %d: tf_idf[%s] = %v, want %v", w.Id, k, g.TfIdf[k], v)
+			}
+		}
+	}
+}
+
+func TestClientHealth(t *testing.T) {
+	server := httptest.NewServer(NewFakeServer())
+	defer server.Close()
+	h, err := NewClient(server.URL + "/").Health()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Status != "ok" || h.SchemaVersion != pipeline.EventsSchemaVersion {
+		t.Errorf("Health = %+v", h)
+	}
+}
+
+func TestClientTfIdf(t *testing.T) {
+	tests := []struct {
+		name  string
+		chunk int
+		// セッションにイベントを送るリクエストの数
+		posts int32
+	}{
+		{"at once", 2000, 0},
+		{"no chunk size", 0, 0},
+		{"in chunks", 4, 3},
+		{"chunk of the same size", 9, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFakeServer()
+			var posts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/events") {
+					atomic.AddInt32(&posts, 1)
+				}
+				fake.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			c := NewClient(server.URL)
+			c.ChunkSize = tt.chunk
+			d := tfidfEvents(t)
+			got, err := c.TfIdf(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertTfIdf(t, d, got)
+			if posts != tt.posts {
+				t.Errorf("sent events in %d requests, want %d", posts, tt.posts)
+			}
+			// 計算を終えたセッションは残さない
+			if len(fake.sessions) != 0 {
+				t.Errorf("%d sessions are left", len(fake.sessions))
+			}
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	healthy := func(w http.ResponseWriter, r *http.Request) bool {
+		if r.URL.Path != healthPath {
+			return false
+		}
+		writeJson(w, http.StatusOK, HealthResponse{Status: "ok", SchemaVersion: pipeline.EventsSchemaVersion})
+		return true
+	}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// APIErrorの場合のステータスとメッセージ（0の場合はAPIErrorでない）
+		status int
+		msg    string
+	}{
+		{"json error", func(w http.ResponseWriter, r *http.Request) {
+			if !healthy(w, r) {
+				writeError(w, http.StatusInternalServerError, errors.New("out of memory"))
+			}
+		}, http.StatusInternalServerError, "out of memory"},
+		{"plain text error", func(w http.ResponseWriter, r *http.Request) {
+			if !healthy(w, r) {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			}
+		}, http.StatusBadGateway, "bad gateway"},
+		{"health is not found", http.NotFound, http.StatusNotFound, "404 page not found"},
+		{"not ready", func(w http.ResponseWriter, r *http.Request) {
+			writeJson(w, http.StatusOK, HealthResponse{Status: "loading", SchemaVersion: pipeline.EventsSchemaVersion})
+		}, 0, ""},
+		{"unsupported schema version", func(w http.ResponseWriter, r *http.Request) {
+			writeJson(w, http.StatusOK, HealthResponse{Status: "ok", SchemaVersion: pipeline.EventsSchemaVersion + 1})
+		}, 0, ""},
+		{"missing results", func(w http.ResponseWriter, r *http.Request) {
+			if !healthy(w, r) {
+				writeJson(w, http.StatusOK, TfIdfResponse{SchemaVersion: pipeline.EventsSchemaVersion, Results: []TfIdfResult{{Id: 101}}})
+			}
+		}, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			_, err := NewClient(server.URL).TfIdf(tfidfEvents(t))
+			if err == nil {
+				t.Fatal("no error")
+			}
+			var apiErr *APIError
+			isAPIError := errors.As(err, &apiErr)
+			if tt.status == 0 {
+				if isAPIError {
+					t.Errorf("got an APIError %v, want another error", err)
+				}
+				return
+			}
+			if !isAPIError || apiErr.StatusCode != tt.status || apiErr.Msg != tt.msg {
+				t.Errorf("got %v, want %v", err, fmt.Sprintf("python api: %d: %s", tt.status, tt.msg))
+			}
+		})
+	}
+}
+
+func TestFakeServerUnknownSession(t *testing.T) {
+	server := httptest.NewServer(NewFakeServer())
+	defer server.Close()
+	res, err := http.Post(server.URL+sessionsPath+"/404/tfidf", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", res.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+package pyservice
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"main/apis/analysis"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// FakeEmbedServerは埋め込みのAPI（analysis.EmbedPath）と同じやり取りをするhttp.Handler。
+// 本物のモデルの代わりに、analysis.Tokenizeで語幹にした単語をハッシュ値でDim次元のランダムな方向に割り当てて足し合わせ、長さを1にする。
+// 同じ本文には常に同じ埋め込みを戻すため、モデルやネットワークなしで埋め込みを用いる処理を確かめられる。
+type FakeEmbedServer struct {
+	Dim  int
+	Seed int64
+}
+
+// NewFakeEmbedServerは64次元の埋め込みを戻すFakeEmbedServerを戻す
+func NewFakeEmbedServer() *FakeEmbedServer {
+	return &FakeEmbedServer{Dim: 64, Seed: 1}
+}
+
+func (s *FakeEmbedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimRight(r.URL.Path, "/") != analysis.EmbedPath || r.Method != http.MethodPost {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s is not found", r.Method, r.URL.Path))
+		return
+	}
+	var req analysis.EmbedRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Ids) != len(req.Texts) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("got %d ids for %d texts", len(req.Ids), len(req.Texts)))
+		return
+	}
+	res := analysis.EmbedResponse{Embeddings: make([][]float64, len(req.Texts))}
+	for i, text := range req.Texts {
+		res.Embeddings[i] = s.Embed(text)
+	}
+	writeJson(w, http.StatusOK, res)
+}
+
+// Embedは本文の埋め込みを戻す（単語がない場合は0のベクトル）
+func (s *FakeEmbedServer) Embed(text string) []float64 {
+	vec := make([]float64, s.Dim)
+	b := make([]byte, 8)
+	for _, word := range analysis.Tokenize(text) {
+		h := fnv.New64a()
+		binary.LittleEndian.PutUint64(b, uint64(s.Seed))
+		h.Write(b)
+		h.Write([]byte(word))
+		// ハッシュ値を種にして、単語の方向の各成分を±1で決める
+		x := h.Sum64()
+		for i := range vec {
+			x ^= x << 13
+			x ^= x >> 7
+			x ^= x << 17
+			if x&1 == 1 {
+				vec[i]++
+			} else {
+				vec[i]--
+			}
+		}
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		return vec
+	}
+	norm = math.Sqrt(norm)
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
@@ -0,0 +1,64 @@
+package pyservice
+
+import (
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+var embedEvents = pipeline.EventsDataJSON{SchemaVersion: pipeline.EventsSchemaVersion, Events: []pipeline.EventData{
+	{Id: 1, Date: "2022-03-02", Text: "Russian forces shell Kharkiv.", Entropy: 1},
+	{Id: 2, Date: "2022-03-01", Text: "Kharkiv is shelled by Russian forces.", Entropy: 1},
+	{Id: 3, Date: "2022-03-01", Text: "A magnitude 7.3 earthquake strikes off the coast of Fukushima.", Entropy: 1},
+	{Id: 4, Date: "2022-02-28", Text: "", Entropy: 1},
+}}
+
+// fakeEmbeddingsは、手元に立てたFakeEmbedServerから埋め込みを求める
+func fakeEmbeddings(t *testing.T) (map[int][]float64, *FakeEmbedServer) {
+	t.Helper()
+	fake := NewFakeEmbedServer()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	embedder, err := analysis.NewEmbedder(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := embedder.(analysis.HTTPEmbedder)
+	// 分けて送っても同じ結果になる
+	h.BatchSize = 3
+	embeddings, err := h.Embed(embedEvents)
+	if err != nil {
+		t.Fatalf("http embedder: %v", err)
+	}
+	return embeddings, fake
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	embeddings, fake := fakeEmbeddings(t)
+	for _, e := range embedEvents.Events {
+		if len(embeddings[e.Id]) != fake.Dim {
+			t.Errorf("event %d has %d dimensions, want %d", e.Id, len(embeddings[e.Id]), fake.Dim)
+		}
+	}
+	if s := cosine(embeddings[1], embeddings[2]); s < 0.99 {
+		t.Errorf("fake embeddings of the same words: cosine %v, want 1", s)
+	}
+	if s := cosine(embeddings[1], embeddings[3]); s > 0.5 {
+		t.Errorf("fake embeddings of different words: cosine %v, want less than 0.5", s)
+	}
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, la, lb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		la += a[i] * a[i]
+		lb += b[i] * b[i]
+	}
+	if la == 0 || lb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(la*lb)
+}
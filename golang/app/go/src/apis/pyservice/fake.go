@@ -0,0 +1,141 @@
+package pyservice
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeServerはPythonのAPIと同じやり取りをするhttp.Handler。
+// TF-IDFはGoで（analysis.SetTfIdfで）計算する。Pythonのコンテナなしでクライアントをテストする場合に用いる。
+type FakeServer struct {
+	Option analysis.TfIdfOption
+
+	mu       sync.Mutex
+	nextId   int
+	sessions map[string][]pipeline.EventData
+}
+
+// NewFakeServerはPython側と同じ計算をするFakeServerを戻す
+func NewFakeServer() *FakeServer {
+	return &FakeServer{
+		Option:   analysis.DefaultTfIdfOption(),
+		sessions: make(map[string][]pipeline.EventData),
+	}
+}
+
+func (s *FakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimRight(r.URL.Path, "/")
+	switch {
+	case path == healthPath && r.Method == http.MethodGet:
+		writeJson(w, http.StatusOK, HealthResponse{Status: "ok", SchemaVersion: pipeline.EventsSchemaVersion})
+	case path == tfidfPath && r.Method == http.MethodPost:
+		s.tfidf(w, r)
+	case path == sessionsPath && r.Method == http.MethodPost:
+		s.mu.Lock()
+		s.nextId++
+		id := strconv.Itoa(s.nextId)
+		s.sessions[id] = nil
+		s.mu.Unlock()
+		writeJson(w, http.StatusOK, SessionResponse{SessionId: id})
+	case strings.HasPrefix(path, sessionsPath+"/"):
+		s.session(w, r, strings.Split(strings.TrimPrefix(path, sessionsPath+"/"), "/"))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s is not found", r.Method, r.URL.Path))
+	}
+}
+
+func (s *FakeServer) tfidf(w http.ResponseWriter, r *http.Request) {
+	var d pipeline.EventsDataJSON
+	err := json.NewDecoder(r.Body).Decode(&d)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if d.SchemaVersion != pipeline.EventsSchemaVersion {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported schema_version %d", d.SchemaVersion))
+		return
+	}
+	writeJson(w, http.StatusOK, TfIdfResponse{SchemaVersion: pipeline.EventsSchemaVersion, Results: s.compute(d.Events)})
+}
+
+func (s *FakeServer) session(w http.ResponseWriter, r *http.Request, parts []string) {
+	id := parts[0]
+	s.mu.Lock()
+	events, found := s.sessions[id]
+	s.mu.Unlock()
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s is not found", id))
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "events" && r.Method == http.MethodPost:
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		var received []pipeline.EventData
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			if line == "" {
+				continue
+			}
+			var e pipeline.EventData
+			if err := json.Unmarshal([]byte(line), &e); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			received = append(received, e)
+		}
+		if err := sc.Err(); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		s.mu.Lock()
+		s.sessions[id] = append(s.sessions[id], received...)
+		n := len(s.sessions[id])
+		s.mu.Unlock()
+		writeJson(w, http.StatusOK, SessionResponse{SessionId: id, Received: n})
+	case len(parts) == 2 && parts[1] == "tfidf" && r.Method == http.MethodPost:
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", ndjsonType)
+		enc := json.NewEncoder(w)
+		for _, res := range s.compute(events) {
+			enc.Encode(res)
+		}
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s is not found", r.Method, r.URL.Path))
+	}
+}
+
+func (s *FakeServer) compute(events []pipeline.EventData) []TfIdfResult {
+	d := pipeline.EventsDataJSON{Events: make([]pipeline.EventData, len(events))}
+	copy(d.Events, events)
+	analysis.SetTfIdf(&d, s.Option)
+	results := make([]TfIdfResult, len(d.Events))
+	for i, e := range d.Events {
+		results[i] = TfIdfResult{Id: e.Id, TfIdf: e.TfIdf}
+	}
+	return results
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, ErrorResponse{Error: err.Error()})
+}
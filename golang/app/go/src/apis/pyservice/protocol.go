@@ -0,0 +1,84 @@
+package pyservice
+
+import (
+	"fmt"
+	"main/apis/pipeline"
+)
+
+// PythonのAPI（python3/main.py）とのやり取りの定義
+//
+//	GET    /health                     → HealthResponse
+//	POST   /tfidf                      EventsDataJSON → TfIdfResponse
+//	POST   /sessions                   → SessionResponse
+//	POST   /sessions/{id}/events       NDJSON（1行に1イベント） → SessionResponse
+//	POST   /sessions/{id}/tfidf        → NDJSON（1行に1つのTfIdfResult）
+//	DELETE /sessions/{id}
+//
+// 失敗した場合は、4xxか5xxのステータスとErrorResponseを戻す。
+// /tfidfは一度に全てのイベントを送り、セッションはイベントを分けて送る場合に用いる。
+// TF-IDFは全ての文書から計算するため、セッションでは全てのイベントを送り終えてから計算する。
+
+const (
+	healthPath   = "/health"
+	tfidfPath    = "/tfidf"
+	sessionsPath = "/sessions"
+	ndjsonType   = "application/x-ndjson"
+)
+
+// HealthResponseはAPIの状態と、扱えるイベントデータのスキーマのバージョン
+type HealthResponse struct {
+	Status        string `json:"status"`
+	SchemaVersion int    `json:"schema_version"`
+}
+
+// TfIdfResultは一つのイベントのTF-IDF
+type TfIdfResult struct {
+	Id    int                `json:"id"`
+	TfIdf map[string]float64 `json:"tf_idf"`
+}
+
+// TfIdfResponseは/tfidfの結果
+type TfIdfResponse struct {
+	SchemaVersion int           `json:"schema_version"`
+	Results       []TfIdfResult `json:"results"`
+}
+
+// SessionResponseはセッションのIDと、これまでに受け取ったイベントの数
+type SessionResponse struct {
+	SessionId string `json:"session_id"`
+	Received  int    `json:"received"`
+}
+
+// ErrorResponseは失敗した理由
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// applyResultsは受け取ったTF-IDFをイベントデータに設定する。
+// 送ったイベントの全てについて、過不足なく結果が戻っているかどうかを確認する。
+func applyResults(d pipeline.EventsDataJSON, results []TfIdfResult) (pipeline.EventsDataJSON, error) {
+	byId := make(map[int]map[string]float64, len(results))
+	for _, r := range results {
+		if _, found := byId[r.Id]; found {
+			return pipeline.EventsDataJSON{}, fmt.Errorf("duplicate result for event %d", r.Id)
+		}
+		byId[r.Id] = r.TfIdf
+	}
+	if len(byId) != len(d.Events) {
+		return pipeline.EventsDataJSON{}, fmt.Errorf("got %d results for %d events", len(byId), len(d.Events))
+	}
+	out := d
+	out.Events = make([]pipeline.EventData, len(d.Events))
+	for i, e := range d.Events {
+		tfidf, found := byId[e.Id]
+		if !found {
+			return pipeline.EventsDataJSON{}, fmt.Errorf("no result for event %d", e.Id)
+		}
+		if tfidf == nil {
+			tfidf = map[string]float64{}
+		}
+		e.TfIdf = tfidf
+		out.Events[i] = e
+	}
+	return out, nil
+}
@@ -27,20 +27,29 @@ CREATE TABLE wiki_article (
 	wiki_art_id INT AUTO_INCREMENT PRIMARY KEY,
 	wiki_source_url LONGTEXT,
 	text LONGTEXT,
-	wiki_category LONGTEXT
+	wiki_category LONGTEXT,
+	page_id INT,
+	INDEX (page_id)
 );
 
 ・wiki外の記事を管理（MySQL）
 CREATE TABLE news_diffbot (
 	news_art_id INT AUTO_INCREMENT PRIMARY KEY,
-	timestamp DATE,
+	timestamp DATETIME,
+	timestamp_zone VARCHAR(8),
+	timestamp_format VARCHAR(64),
 	site_name LONGTEXT,
 	publisher_region LONGTEXT,
 	category LONGTEXT,
 	title LONGTEXT,
 	text LONGTEXT,
 	human_language LONGTEXT,
-	news_source_url LONGTEXT
+	news_source_url LONGTEXT,
+	canonical_url LONGTEXT,
+	canonical_url_hash CHAR(64),
+	archive_url LONGTEXT,
+	archive_timestamp DATETIME,
+	INDEX (canonical_url_hash)
 );
 */
 
@@ -61,11 +70,12 @@ type WikiArt struct {
 	WikiSourceUrl string
 	Text          string
 	WikiCategory  string
+	PageId        int // Wikipediaの記事ID（不明な場合は0）
 }
 
 type NewsArt struct {
 	Id              int
-	Timestamp       string
+	Timestamp       string // UTCに変換した日時（TimestampLayoutの形式）
 	SiteName        string
 	PublisherRegion string
 	Category        string
@@ -73,8 +83,20 @@ type NewsArt struct {
 	HumanLanguage   string
 	Text            string
 	NewsSourceUrl   string
+	// 正規化したURL（util.CanonicalizeUrl）。重複の判定には、このハッシュ値（util.CanonicalUrlHash）を用いる
+	CanonicalUrl string
+	// 元のタイムゾーンのずれ（「+09:00」の形式、不明な場合は空文字列）
+	TimestampZone string
+	// タイムスタンプが一致した形式の名前（dateparse.Result.Format）
+	TimestampFormat string
+	// Wayback Machineのスナップショットから取得した場合のみ値が入る
+	ArchiveUrl       string
+	ArchiveTimestamp string
 }
 
+// news記事のタイムスタンプの形式
+const TimestampLayout = "2006-01-02 15:04:05"
+
 // 接続先DBの設定
 const dsn = "docker:docker@tcp(db:3306)/data?charset=utf8mb4"
 
@@ -164,3 +186,13 @@ func GetEmptyDataOfNewsArts() ([]NewsArt, error) {
 	}
 	return news, nil
 }
+
+// nullStringは空文字列をNULLとして登録するための値を戻す
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullIntは0をNULLとして登録するための値を戻す
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
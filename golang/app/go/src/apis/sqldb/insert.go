@@ -31,13 +31,13 @@ func InsertWikiEvent(db *sql.DB, d Event) error {
 
 // wiki記事を登録する
 func InsertWikiArticle(db *sql.DB, d WikiArt) error {
-	stmt, err := db.Prepare("INSERT INTO wiki_article(wiki_source_url, text, wiki_category) VALUES(?,?,?)")
+	stmt, err := db.Prepare("INSERT INTO wiki_article(wiki_source_url, text, wiki_category, page_id) VALUES(?,?,?,?)")
 	if err != nil {
 		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[insertWikiArticle()]", err)
 		return errors.New(str)
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(d.WikiSourceUrl, d.Text, d.WikiCategory)
+	_, err = stmt.Exec(d.WikiSourceUrl, d.Text, d.WikiCategory, nullInt(d.PageId))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return err
@@ -47,21 +47,28 @@ func InsertWikiArticle(db *sql.DB, d WikiArt) error {
 
 // news記事を登録する
 func InsertNewsArticle(db *sql.DB, d NewsArt) error {
-	stmt, err := db.Prepare("INSERT INTO news_diffbot(timestamp, site_name, publisher_region, category, title, text, human_language, news_source_url) VALUES(?,?,?,?,?,?,?,?)")
+	stmt, err := db.Prepare("INSERT INTO news_diffbot(timestamp, timestamp_zone, timestamp_format, site_name, publisher_region, category, title, text, human_language, news_source_url, canonical_url, canonical_url_hash, archive_url, archive_timestamp) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
 	if err != nil {
 		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[insertNewsArticle()]", err)
 		return errors.New(str)
 	}
 	defer stmt.Close()
+	canonical := util.CanonicalizeUrlOrRaw(d.NewsSourceUrl)
 	_, err = stmt.Exec(
 		d.Timestamp,
+		d.TimestampZone,
+		d.TimestampFormat,
 		d.SiteName,
 		d.PublisherRegion,
 		d.Category,
 		d.Title,
 		d.Text,
 		d.HumanLanguage,
-		d.NewsSourceUrl)
+		d.NewsSourceUrl,
+		canonical,
+		util.CanonicalUrlHash(canonical),
+		d.ArchiveUrl,
+		nullString(d.ArchiveTimestamp))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return err
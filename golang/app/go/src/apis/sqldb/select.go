@@ -56,18 +56,20 @@ func SlelctAllIdAndUrlWikiArticle(db *sql.DB) (map[string]int, error) {
 }
 
 // SelectNewsArticleはDBからnews記事を検索し、抽出する。
+// URLは正規化したもののハッシュ値で比較するため、AMPページやトラッキング用のクエリが付いたURLでも同じ記事が見つかる。
 // 見つからなかった場合、Idが-1になる。
 func SelectNewsArticle(db *sql.DB, newsSourceUrl string) (NewsArt, error) {
-	stmt, err := db.Prepare("SELECT news_art_id, news_source_url FROM news_diffbot WHERE news_source_url = ?")
+	stmt, err := db.Prepare("SELECT news_art_id, news_source_url, canonical_url FROM news_diffbot WHERE canonical_url_hash = ? LIMIT 1")
 	if err != nil {
 		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[SelectNewsArticle()]: ", err)
 		return NewsArt{}, errors.New(str)
 	}
 	defer stmt.Close()
 	news := NewsArt{Id: -1}
-	err = stmt.QueryRow(newsSourceUrl).Scan(
+	err = stmt.QueryRow(util.CanonicalUrlHash(util.CanonicalizeUrlOrRaw(newsSourceUrl))).Scan(
 		&news.Id,
 		&news.NewsSourceUrl,
+		&news.CanonicalUrl,
 	)
 	// 行がなかった場合は、エラーを戻さずにIdが-1の要素を戻す
 	if err != sql.ErrNoRows && err != nil {
@@ -76,7 +78,8 @@ func SelectNewsArticle(db *sql.DB, newsSourceUrl string) (NewsArt, error) {
 	return news, nil
 }
 
-// SelectAllIdAndUrlNewsArticleはDBに存在するnews記事の「IDとURL」の組みを全て抽出する
+// SelectAllIdAndUrlNewsArticleはDBに存在するnews記事の「IDと正規化したURL」の組みを全て抽出する
+// 同じ記事が複数登録されている場合は、最も小さいIDを戻す
 func SelectAllIdAndUrlNewsArticle(db *sql.DB) (map[string]int, error) {
 	stmt, err := db.Prepare("SELECT news_art_id, news_source_url FROM news_diffbot")
 	if err != nil {
@@ -95,7 +98,10 @@ func SelectAllIdAndUrlNewsArticle(db *sql.DB) (map[string]int, error) {
 		if err := rows.Scan(&id, &path); err != nil {
 			return nil, err
 		}
-		idAndUrl[path] = id
+		canonical := util.CanonicalizeUrlOrRaw(path)
+		if v, found := idAndUrl[canonical]; !found || id < v {
+			idAndUrl[canonical] = id
+		}
 	}
 	return idAndUrl, nil
 }
@@ -175,3 +181,124 @@ func SelectNewsArtsEmptyData(db *sql.DB) ([]NewsArt, error) {
 	}
 	return news, nil
 }
+
+// SelectNewsEventDatesはnews記事のIDと、その記事を参照しているイベントの日付の組みを全て抽出する。
+// 複数のイベントから参照されている場合は、最も古い日付を戻す。
+func SelectNewsEventDates(db *sql.DB) (map[int]string, error) {
+	stmt, err := db.Prepare("SELECT date, news_source_url FROM wiki_event")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[SelectNewsEventDates()]", err)
+		return nil, errors.New(str)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	idAndDate := make(map[int]string)
+	for rows.Next() {
+		var date, newsUrlIdLine string
+		if err := rows.Scan(&date, &newsUrlIdLine); err != nil {
+			return nil, err
+		}
+		newsSourceUrlId, err := util.SplitIntByTab(newsUrlIdLine)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range newsSourceUrlId {
+			// 日付は「2006-01-02」の形式なので、文字列のまま比較できる
+			if v, found := idAndDate[id]; !found || date < v {
+				idAndDate[id] = date
+			}
+		}
+	}
+	return idAndDate, nil
+}
+
+// SelectEventsOfNewsArtsはnews記事のIDと、その記事を参照しているイベントの組みを全て抽出する。
+// イベントは日付、カテゴリ、本文のみを持つ。
+func SelectEventsOfNewsArts(db *sql.DB) (map[int][]Event, error) {
+	stmt, err := db.Prepare("SELECT event_id, date, category, text, news_source_url FROM wiki_event")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[SelectEventsOfNewsArts()]", err)
+		return nil, errors.New(str)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	idAndEvents := make(map[int][]Event)
+	for rows.Next() {
+		var e Event
+		var newsUrlIdLine string
+		if err := rows.Scan(&e.Id, &e.Date, &e.Category, &e.Text, &newsUrlIdLine); err != nil {
+			return nil, err
+		}
+		newsSourceUrlId, err := util.SplitIntByTab(newsUrlIdLine)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range newsSourceUrlId {
+			idAndEvents[id] = append(idAndEvents[id], e)
+		}
+	}
+	return idAndEvents, nil
+}
+
+// ForEachWikiArticleはDBに存在する全てのwiki記事を一つずつ読み込み、fに渡す。
+// 記事の本文（HTML）は大きいため、全てをメモリに載せずに処理する。fがエラーを戻した場合は中断する。
+func ForEachWikiArticle(db *sql.DB, f func(WikiArt) error) error {
+	stmt, err := db.Prepare("SELECT wiki_art_id, wiki_source_url, text, wiki_category, page_id FROM wiki_article")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[ForEachWikiArticle()]", err)
+		return errors.New(str)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var art WikiArt
+		var text, category sql.NullString
+		var pageId sql.NullInt64
+		if err := rows.Scan(&art.Id, &art.WikiSourceUrl, &text, &category, &pageId); err != nil {
+			return err
+		}
+		art.Text = text.String
+		art.WikiCategory = category.String
+		art.PageId = int(pageId.Int64)
+		if err := f(art); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SelectAllWikiPageIdsはwiki記事のIDと、Wikipediaの記事IDの組みを全て抽出する（記事IDが不明なものは含まない）
+func SelectAllWikiPageIds(db *sql.DB) (map[int]int, error) {
+	stmt, err := db.Prepare("SELECT wiki_art_id, page_id FROM wiki_article WHERE page_id IS NOT NULL")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[SelectAllWikiPageIds()]", err)
+		return nil, errors.New(str)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pageIds := make(map[int]int)
+	for rows.Next() {
+		var id, pageId int
+		if err := rows.Scan(&id, &pageId); err != nil {
+			return nil, err
+		}
+		pageIds[id] = pageId
+	}
+	return pageIds, rows.Err()
+}
@@ -4,10 +4,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"main/apis/util"
 )
 
 func UpdateDiffbotData(db *sql.DB, d NewsArt) error {
-	stmt, err := db.Prepare("UPDATE news_diffbot SET timestamp = ?, site_name = ?, publisher_region = ?, category = ?, title = ?, text = ?, human_language = ? WHERE news_art_id = ?")
+	stmt, err := db.Prepare("UPDATE news_diffbot SET timestamp = ?, timestamp_zone = ?, timestamp_format = ?, site_name = ?, publisher_region = ?, category = ?, title = ?, text = ?, human_language = ?, archive_url = ?, archive_timestamp = ? WHERE news_art_id = ?")
 	if err != nil {
 		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[UpdateDiffbotData()]", err)
 		return errors.New(str)
@@ -15,15 +16,87 @@ func UpdateDiffbotData(db *sql.DB, d NewsArt) error {
 	defer stmt.Close()
 	_, err = stmt.Exec(
 		d.Timestamp,
+		d.TimestampZone,
+		d.TimestampFormat,
 		d.SiteName,
 		d.PublisherRegion,
 		d.Category,
 		d.Title,
 		d.Text,
 		d.HumanLanguage,
+		d.ArchiveUrl,
+		nullString(d.ArchiveTimestamp),
 		d.Id)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// FillEmptyCanonicalUrlsは正規化したURLのハッシュ値が登録されていないnews記事に、正規化したURLとそのハッシュ値を登録する
+func FillEmptyCanonicalUrls(db *sql.DB) error {
+	rows, err := db.Query("SELECT news_art_id, news_source_url FROM news_diffbot WHERE canonical_url_hash IS NULL")
+	if err != nil {
+		return err
+	}
+	idAndUrl := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var path string
+		if err := rows.Scan(&id, &path); err != nil {
+			rows.Close()
+			return err
+		}
+		idAndUrl[id] = path
+	}
+	rows.Close()
+	stmt, err := db.Prepare("UPDATE news_diffbot SET canonical_url = ?, canonical_url_hash = ? WHERE news_art_id = ?")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[FillEmptyCanonicalUrls()]", err)
+		return errors.New(str)
+	}
+	defer stmt.Close()
+	for id, path := range idAndUrl {
+		canonical := util.CanonicalizeUrlOrRaw(path)
+		_, err = stmt.Exec(canonical, util.CanonicalUrlHash(canonical), id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FillEmptyWikiPageIdsはWikipediaの記事IDが登録されていないwiki記事に、本文のHTMLから抽出した記事IDを登録する
+func FillEmptyWikiPageIds(db *sql.DB) error {
+	rows, err := db.Query("SELECT wiki_art_id, text FROM wiki_article WHERE page_id IS NULL")
+	if err != nil {
+		return err
+	}
+	// 本文は大きいため、記事IDだけを保持する
+	pageIds := make(map[int]int)
+	for rows.Next() {
+		var id int
+		var text sql.NullString
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		if pageId := util.WikiPageId(text.String); pageId != 0 {
+			pageIds[id] = pageId
+		}
+	}
+	rows.Close()
+	stmt, err := db.Prepare("UPDATE wiki_article SET page_id = ? WHERE wiki_art_id = ?")
+	if err != nil {
+		str := fmt.Sprintf("%s: %v\n", "failed to generate statement[FillEmptyWikiPageIds()]", err)
+		return errors.New(str)
+	}
+	defer stmt.Close()
+	for id, pageId := range pageIds {
+		_, err = stmt.Exec(pageId, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
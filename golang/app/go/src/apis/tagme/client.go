@@ -0,0 +1,230 @@
+package tagme
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/apis/pipeline"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientはAnnotatorを複数のワーカーで並行に呼び出す。
+// 結果は本文のハッシュ値ごとにディスクへキャッシュし、失敗した場合は間隔を空けて再試行する。
+// Checkpointを指定すると途中の結果を記録し、Resumeで続きから処理する。
+type Client struct {
+	Annotator Annotator
+	// キャッシュを分ける名前（抽出方法や辞書が変わった場合に、別の結果として扱う）
+	Namespace string
+	Workers   int
+	// キャッシュを置くフォルダ（空文字の場合はキャッシュしない）
+	CacheDir string
+	// 再試行の回数と、最初の待ち時間（再試行のたびに2倍にする）
+	Retries int
+	Backoff time.Duration
+	// 途中の結果を記録するファイル（空文字の場合は記録しない）
+	Checkpoint string
+	// trueの場合、Checkpointの記録から続きを処理する（失敗したイベントはやり直す）
+	Resume bool
+}
+
+// NewClientは初期値のClientを戻す
+func NewClient(a Annotator, namespace string) *Client {
+	return &Client{
+		Annotator: a,
+		Namespace: namespace,
+		Workers:   4,
+		Retries:   3,
+		Backoff:   time.Second,
+	}
+}
+
+// Annotateはキャッシュと再試行を用いて、一つの本文のエンティティを抽出する
+func (c *Client) Annotate(text string) (TagMeData, error) {
+	path := c.cachePath(text)
+	if path != "" {
+		if b, err := os.ReadFile(path); err == nil {
+			var data TagMeData
+			if err := json.Unmarshal(b, &data); err == nil {
+				return data, nil
+			}
+		}
+	}
+	var data TagMeData
+	var err error
+	wait := c.Backoff
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		data, err = c.Annotator.Annotate(text)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return TagMeData{}, err
+	}
+	if path != "" {
+		if err := writeFileAtomic(path, data); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	return data, nil
+}
+
+// cachePathは本文のキャッシュのファイルを戻す
+func (c *Client) cachePath(text string) string {
+	if c.CacheDir == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(c.Namespace + "\x00" + text))
+	key := hex.EncodeToString(h[:])
+	return filepath.Join(c.CacheDir, key[:2], key+".json")
+}
+
+// clientCheckpointは処理済みのイベントの結果と、失敗したイベントを記録する
+type clientCheckpoint struct {
+	Namespace string               `json:"namespace"`
+	Done      map[int][]Annotation `json:"done"`
+	Failed    map[int]string       `json:"failed"`
+}
+
+// AnnotateEventsは全てのイベントの本文からエンティティを抽出し、イベントのIDごとの結果を戻す。
+// 一つのイベントで失敗しても処理は続け、最後に失敗したイベントの数をエラーとして戻す（成功した結果も戻す）。
+func (c *Client) AnnotateEvents(events []pipeline.EventData) (map[int][]Annotation, error) {
+	cp := clientCheckpoint{Namespace: c.Namespace, Done: make(map[int][]Annotation), Failed: make(map[int]string)}
+	if c.Checkpoint != "" && c.Resume {
+		loaded, err := loadClientCheckpoint(c.Checkpoint)
+		if err != nil {
+			return nil, err
+		}
+		if loaded.Namespace != "" && loaded.Namespace != c.Namespace {
+			return nil, fmt.Errorf("%s: checkpoint was written by %q (now %q)", c.Checkpoint, loaded.Namespace, c.Namespace)
+		}
+		for id, annotations := range loaded.Done {
+			cp.Done[id] = annotations
+		}
+	}
+	var pending []pipeline.EventData
+	for _, e := range events {
+		if _, found := cp.Done[e.Id]; !found {
+			pending = append(pending, e)
+		}
+	}
+	fmt.Printf("started to get Entieties (%d events, %d already done)\n", len(pending), len(events)-len(pending))
+
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var mu sync.Mutex
+	finished := 0
+	nowProg := -1
+	lastSaved := time.Now()
+	jobs := make(chan pipeline.EventData)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				data, err := c.Annotate(e.Text)
+				mu.Lock()
+				if err != nil {
+					cp.Failed[e.Id] = err.Error()
+				} else {
+					cp.Done[e.Id] = data.Annotations
+					delete(cp.Failed, e.Id)
+				}
+				finished++
+				if tmpProg := finished * 100 / len(pending); tmpProg != nowProg {
+					nowProg = tmpProg
+					fmt.Printf("\rfinished: %2d%% (failed: %d)", nowProg, len(cp.Failed))
+				}
+				// 数秒ごとに途中の結果を記録する
+				if c.Checkpoint != "" && time.Since(lastSaved) > 5*time.Second {
+					if err := writeFileAtomic(c.Checkpoint, cp); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+					}
+					lastSaved = time.Now()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, e := range pending {
+		jobs <- e
+	}
+	close(jobs)
+	wg.Wait()
+	fmt.Println()
+	if c.Checkpoint != "" {
+		if err := writeFileAtomic(c.Checkpoint, cp); err != nil {
+			return nil, err
+		}
+	}
+	results := make(map[int][]Annotation, len(events))
+	for _, e := range events {
+		if annotations, found := cp.Done[e.Id]; found {
+			results[e.Id] = annotations
+		}
+	}
+	if len(cp.Failed) > 0 {
+		ids := make([]int, 0, len(cp.Failed))
+		for id := range cp.Failed {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		return results, fmt.Errorf("failed to annotate %d events (first: %d: %s)", len(ids), ids[0], cp.Failed[ids[0]])
+	}
+	return results, nil
+}
+
+func loadClientCheckpoint(path string) (clientCheckpoint, error) {
+	var cp clientCheckpoint
+	b, err := os.ReadFile(path)
+	// 記録がない場合は最初から処理する
+	if errors.Is(err, os.ErrNotExist) {
+		return clientCheckpoint{}, nil
+	}
+	if err != nil {
+		return clientCheckpoint{}, err
+	}
+	err = json.Unmarshal(b, &cp)
+	if err != nil {
+		return clientCheckpoint{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return cp, nil
+}
+
+// writeFileAtomicは書き込み途中で中断しても壊れないように、一時ファイルに書き込んでから置き換える
+func writeFileAtomic(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
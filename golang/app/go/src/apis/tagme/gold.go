@@ -0,0 +1,207 @@
+package tagme
+
+import (
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"main/apis/util"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// hyperlinkSourcesはイベントが参照しているwiki内記事を、出所がhyperlinkのエンティティにする。
+// 記事名（末尾の括弧を除く）が本文に出現する場合は、その語句をSpotとする。
+// pageIdsはwiki記事のIDとWikipediaの記事IDの組み。
+func hyperlinkSources(text string, entitiesId []int, urlOf map[int]string, pageIds map[int]int) []pipeline.EntitySource {
+	var sources []pipeline.EntitySource
+	seen := make(map[string]bool)
+	for _, id := range entitiesId {
+		path, found := urlOf[id]
+		if !found {
+			continue
+		}
+		title := util.WikiPathToTitle(path)
+		if seen[titleKey(title)] {
+			continue
+		}
+		seen[titleKey(title)] = true
+		src := pipeline.EntitySource{PageId: pageIds[id], Title: title, Provenance: pipeline.ProvenanceHyperlink}
+		name := util.TrimWikiTitleQualifier(title)
+		if start, end := indexFold(text, name); start >= 0 {
+			src.Spot = util.CutRemoveWords(text[start:end])
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// indexFoldは大文字と小文字を区別せずにtextからsubstrを探し、最初に出現する位置（バイト単位の始まりと終わり）を戻す。
+// 見つからない場合は-1を戻す。小文字にするとバイト数が変わる文字（İなど）があるため、小文字にした文字列の位置は用いない。
+func indexFold(text, substr string) (int, int) {
+	if substr == "" {
+		return -1, -1
+	}
+	n := utf8.RuneCountInString(substr)
+	// offsets[k]はk番目の文字の始まりの位置
+	var offsets []int
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+	for k := 0; k+n < len(offsets); k++ {
+		if strings.EqualFold(text[offsets[k]:offsets[k+n]], substr) {
+			return offsets[k], offsets[k+n]
+		}
+	}
+	return -1, -1
+}
+
+// titleKeyは記事名を比較できる形にする
+func titleKey(title string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(title), "_", " "))
+}
+
+// entityIndexはエンティティを記事IDで、記事IDが不明な場合は記事名で探す
+type entityIndex struct {
+	byId    map[int]int
+	byTitle map[string]int
+}
+
+func newEntityIndex() entityIndex {
+	return entityIndex{byId: make(map[int]int), byTitle: make(map[string]int)}
+}
+
+func (x entityIndex) add(pageId int, title string, i int) {
+	if pageId != 0 {
+		x.byId[pageId] = i
+	}
+	if _, found := x.byTitle[titleKey(title)]; !found {
+		x.byTitle[titleKey(title)] = i
+	}
+}
+
+func (x entityIndex) find(pageId int, title string) (int, bool) {
+	if pageId != 0 {
+		if i, found := x.byId[pageId]; found {
+			return i, true
+		}
+	}
+	i, found := x.byTitle[titleKey(title)]
+	return i, found
+}
+
+// mergeEntitiesはTagMeで抽出したエンティティとリンクのエンティティをまとめ、
+// エントロピーの計算に用いる語句と、各エンティティの出所を戻す。
+// 語句はTagMeの語句（これまでと同じ）に、リンクにしかないエンティティの語句を加えたもの。
+func mergeEntities(annotations []Annotation, hyperlinks []pipeline.EntitySource) ([]string, []pipeline.EntitySource) {
+	sources := make([]pipeline.EntitySource, 0, len(hyperlinks)+len(annotations))
+	index := newEntityIndex()
+	for _, src := range hyperlinks {
+		src.Provenance = pipeline.ProvenanceHyperlink
+		index.add(src.PageId, src.Title, len(sources))
+		sources = append(sources, src)
+	}
+	entities := make([]string, 0, len(annotations))
+	for _, a := range annotations {
+		spot := util.CutRemoveWords(a.Spot)
+		entities = append(entities, spot)
+		if i, found := index.find(a.ID, a.Title); found {
+			// 同じ記事を指す語句が複数ある場合は、最初の語句だけを記録する
+			if sources[i].Provenance == pipeline.ProvenanceHyperlink {
+				sources[i].Provenance = pipeline.ProvenanceBoth
+				if sources[i].PageId == 0 {
+					sources[i].PageId = a.ID
+				}
+				if sources[i].Spot == "" {
+					sources[i].Spot = spot
+				}
+			}
+			continue
+		}
+		index.add(a.ID, a.Title, len(sources))
+		sources = append(sources, pipeline.EntitySource{PageId: a.ID, Title: a.Title, Spot: spot, Provenance: pipeline.ProvenanceTagMe})
+	}
+	for _, src := range sources {
+		if src.Provenance == pipeline.ProvenanceHyperlink && src.Spot != "" {
+			entities = append(entities, src.Spot)
+		}
+	}
+	return entities, sources
+}
+
+// LinkScoreはリンクを正解とした、TagMeの抽出結果の評価
+type LinkScore struct {
+	Year string
+	// リンクを持つイベントの数
+	Events int
+	// 両方にあるエンティティ、TagMeにしかないもの、リンクにしかないものの数
+	TruePositive  int
+	FalsePositive int
+	FalseNegative int
+}
+
+func (s LinkScore) Precision() float64 {
+	if s.TruePositive+s.FalsePositive == 0 {
+		return 0
+	}
+	return float64(s.TruePositive) / float64(s.TruePositive+s.FalsePositive)
+}
+
+func (s LinkScore) Recall() float64 {
+	if s.TruePositive+s.FalseNegative == 0 {
+		return 0
+	}
+	return float64(s.TruePositive) / float64(s.TruePositive+s.FalseNegative)
+}
+
+// EvaluateAgainstHyperlinksは、編集者が張ったリンクを正解として、TagMeの適合率と再現率を年ごとに計算する。
+// リンクを一つも持たないイベントは、正解がわからないため数えない。
+func EvaluateAgainstHyperlinks(d pipeline.EventsDataJSON) []LinkScore {
+	byYear := make(map[string]*LinkScore)
+	for _, e := range d.Events {
+		hasLink := false
+		for _, src := range e.EntitySources {
+			if src.Provenance != pipeline.ProvenanceTagMe {
+				hasLink = true
+			}
+		}
+		if !hasLink {
+			continue
+		}
+		year := e.Date
+		if len(year) >= 4 {
+			year = year[:4]
+		}
+		s, found := byYear[year]
+		if !found {
+			s = &LinkScore{Year: year}
+			byYear[year] = s
+		}
+		s.Events++
+		for _, src := range e.EntitySources {
+			switch src.Provenance {
+			case pipeline.ProvenanceBoth:
+				s.TruePositive++
+			case pipeline.ProvenanceTagMe:
+				s.FalsePositive++
+			case pipeline.ProvenanceHyperlink:
+				s.FalseNegative++
+			}
+		}
+	}
+	scores := make([]LinkScore, 0, len(byYear))
+	for _, s := range byYear {
+		scores = append(scores, *s)
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Year < scores[j].Year })
+	return scores
+}
+
+// WriteLinkReportは年ごとの適合率と再現率を書き出す
+func WriteLinkReport(w io.Writer, scores []LinkScore) {
+	fmt.Fprintf(w, "%-6s %8s %8s %8s %8s %10s %8s\n", "year", "events", "tp", "fp", "fn", "precision", "recall")
+	for _, s := range scores {
+		fmt.Fprintf(w, "%-6s %8d %8d %8d %8d %10.3f %8.3f\n", s.Year, s.Events, s.TruePositive, s.FalsePositive, s.FalseNegative, s.Precision(), s.Recall())
+	}
+}
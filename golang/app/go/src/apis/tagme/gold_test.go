@@ -0,0 +1,52 @@
+package tagme
+
+import (
+	"main/apis/pipeline"
+	"reflect"
+	"testing"
+)
+
+func TestIndexFold(t *testing.T) {
+	tests := []struct {
+		name, text, substr string
+		start, end         int
+	}{
+		{"ascii", "Talks in Paris end", "paris", 9, 14},
+		{"not found", "Talks in Paris end", "london", -1, -1},
+		{"empty", "Talks", "", -1, -1},
+		// 「İ」は小文字にすると2バイトから3バイトになり、後ろの位置がずれる
+		{"after İ", "İstanbul'da Erdoğan konuştu", "erdoğan", 13, 21},
+		{"non-ascii case", "ÉLYSÉE PALACE", "élysée", 0, 8},
+		{"at the end", "talks with Erdoğan", "ERDOĞAN", 11, 19},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := indexFold(tt.text, tt.substr)
+			if start != tt.start || end != tt.end {
+				t.Errorf("indexFold(%q, %q) = %d, %d, want %d, %d", tt.text, tt.substr, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestHyperlinkSources(t *testing.T) {
+	text := "İstanbul'da Erdoğan met turkey's ministers"
+	urlOf := map[int]string{
+		1: "/wiki/Erdo%C4%9Fan",
+		2: "/wiki/Turkey_(country)",
+		3: "/wiki/Ankara",
+		4: "/wiki/Erdoğan",
+	}
+	pageIds := map[int]int{1: 1001, 2: 1002}
+	got := hyperlinkSources(text, []int{1, 2, 3, 4, 5}, urlOf, pageIds)
+	want := []pipeline.EntitySource{
+		{PageId: 1001, Title: "Erdoğan", Spot: "Erdoğan", Provenance: pipeline.ProvenanceHyperlink},
+		// 末尾の括弧を除いた記事名を、本文の表記のままSpotにする
+		{PageId: 1002, Title: "Turkey (country)", Spot: "turkey", Provenance: pipeline.ProvenanceHyperlink},
+		// 本文に出現しない
+		{Title: "Ankara", Provenance: pipeline.ProvenanceHyperlink},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
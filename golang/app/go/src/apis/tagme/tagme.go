@@ -0,0 +1,241 @@
+package tagme
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"main/apis/pipeline"
+	"main/apis/sqldb"
+	"main/apis/util"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+type TagMeData struct {
+	Test        string       `json:"test"`
+	Annotations []Annotation `json:"annotations"`
+	Time        int          `json:"time"`
+	API         string       `json:"api"`
+	Lang        string       `json:"lang"`
+	Timestamp   string       `json:"timestamp"`
+}
+
+// Annotationは本文中の一つの語句（Spot）と、それが指すWikipediaの記事
+type Annotation = pipeline.Annotation
+
+// Optionsは抽出結果のうち、エンティティとして用いるものの閾値
+type Options struct {
+	MinLinkProbability float64
+	MinRho             float64
+}
+
+// DefaultOptionsはこれまでと同じ閾値（リンクになる割合が0.1以上）を戻す
+func DefaultOptions() Options {
+	return Options{MinLinkProbability: 0.1, MinRho: 0}
+}
+
+// Acceptは抽出結果がエンティティとして用いる閾値を満たすかどうかを戻す
+func (o Options) Accept(a Annotation) bool {
+	return a.LinkProbability >= o.MinLinkProbability && a.Rho >= o.MinRho
+}
+
+// Annotatorは本文からエンティティを抽出する（TagMe APIかオフラインのリンカー）
+type Annotator interface {
+	Annotate(text string) (TagMeData, error)
+}
+
+// WebAPIはTagMeのWeb APIを用いるAnnotator
+type WebAPI struct{}
+
+func (WebAPI) Annotate(text string) (TagMeData, error) {
+	return QueryTagMe(text)
+}
+
+// GetEventDataAllTextはDBから[start, end]のイベントを抽出し、末尾の括弧を取り除いた本文を持つイベントデータにする。
+// イベントの本文にWikipediaの編集者が張ったリンク（wiki内記事）は、出所がhyperlinkのエンティティとして持たせる。
+func GetEventDataAllText(start, end string) (pipeline.EventsDataJSON, error) {
+	db, err := sqldb.ConnectDB()
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	defer db.Close()
+	eventData, err := sqldb.SelectEvents(db, start, end)
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	idAndUrl, err := sqldb.SlelctAllIdAndUrlWikiArticle(db)
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	urlOf := make(map[int]string, len(idAndUrl))
+	for path, id := range idAndUrl {
+		urlOf[id] = path
+	}
+	// リンクのエンティティは記事IDで識別するため、未登録の記事IDを本文のHTMLから埋めておく
+	err = sqldb.FillEmptyWikiPageIds(db)
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	pageIds, err := sqldb.SelectAllWikiPageIds(db)
+	if err != nil {
+		return pipeline.EventsDataJSON{}, err
+	}
+	var d pipeline.EventsDataJSON
+	for _, v := range eventData {
+		var e pipeline.EventData
+		e.Id = v.Id
+		e.Date = v.Date
+		e.Text = util.TruncTailBracketsText(v.Text)
+		e.Category = v.Category
+		e.Tags = cleanTags(v.Tags)
+		e.EntitySources = hyperlinkSources(e.Text, v.EntitiesId, urlOf, pageIds)
+		d.Events = append(d.Events, e)
+	}
+	return d, nil
+}
+
+// cleanTagsは見出しの前後の空白を取り除き、空の見出しを除く
+func cleanTags(tags []string) []string {
+	var cleaned []string
+	for _, t := range tags {
+		if t = strings.TrimSpace(t); t != "" {
+			cleaned = append(cleaned, t)
+		}
+	}
+	return cleaned
+}
+
+// SetEntitiesFromTagMeは全てのイベントのエンティティをTagMeで抽出する
+func SetEntitiesFromTagMe(d *pipeline.EventsDataJSON) error {
+	_, err := SetEntities(d, WebAPI{}, DefaultOptions())
+	return err
+}
+
+// BatchAnnotatorはまとめてイベントのエンティティを抽出する（Client）
+type BatchAnnotator interface {
+	AnnotateEvents(events []pipeline.EventData) (map[int][]Annotation, error)
+}
+
+// SetEntitiesは全てのイベントのエンティティをaで抽出する。
+// optの閾値を満たすものをエンティティとし、イベントが持つリンクのエンティティとまとめて、それぞれの出所を記録する。
+// 閾値で取り除く前の全ての抽出結果を戻す（語句の位置はイベントの本文の位置）。
+// aがBatchAnnotatorの場合はまとめて抽出し、そうでない場合は一件ずつ抽出する。
+func SetEntities(d *pipeline.EventsDataJSON, a Annotator, opt Options) (pipeline.AnnotationsJSON, error) {
+	var results map[int][]Annotation
+	var err error
+	if b, ok := a.(BatchAnnotator); ok {
+		results, err = b.AnnotateEvents(d.Events)
+	} else {
+		results, err = annotateEvents(d.Events, a)
+	}
+	if err != nil {
+		return pipeline.AnnotationsJSON{}, err
+	}
+	var all pipeline.AnnotationsJSON
+	for i, e := range d.Events {
+		annotations := results[e.Id]
+		all.Events = append(all.Events, pipeline.EventAnnotations{Id: e.Id, Annotations: annotations})
+		accepted := make([]Annotation, 0, len(annotations))
+		for _, v := range annotations {
+			if opt.Accept(v) {
+				accepted = append(accepted, v)
+			}
+		}
+		d.Events[i].Entities, d.Events[i].EntitySources = mergeEntities(accepted, e.EntitySources)
+	}
+	return all, nil
+}
+
+// annotateEventsは一件ずつイベントのエンティティを抽出する
+func annotateEvents(events []pipeline.EventData, a Annotator) (map[int][]Annotation, error) {
+	results := make(map[int][]Annotation, len(events))
+	nowProg := 0
+	fmt.Println("started to get Entieties")
+	for i, e := range events {
+		data, err := a.Annotate(e.Text)
+		if err != nil {
+			return nil, err
+		}
+		results[e.Id] = data.Annotations
+		tmpProg := int((float64(i) / float64(len(events))) * 100)
+		if nowProg != tmpProg {
+			nowProg = tmpProg
+			fmt.Printf("\rfinished: %2d%%", nowProg)
+		}
+	}
+	fmt.Println("\rfinished: 100%")
+
+	return results, nil
+}
+
+// GetEntitiesは与えられた文字列のエンティティを抽出します。
+// 関連度が0.1を下回ったものは除外されます。
+func GetEntities(text string) ([]string, error) {
+	return GetEntitiesWith(WebAPI{}, text)
+}
+
+// GetEntitiesWithはGetEntitiesと同じく、aを用いてエンティティを抽出します。
+func GetEntitiesWith(a Annotator, text string) ([]string, error) {
+	annotations, err := annotationsWith(a, text)
+	if err != nil {
+		return nil, err
+	}
+	entities := make([]string, 0)
+	for _, v := range annotations {
+		entities = append(entities, v.Spot)
+	}
+	return entities, nil
+}
+
+// annotationsWithはaで抽出した結果のうち、DefaultOptionsの閾値を満たすものを戻します。
+func annotationsWith(a Annotator, text string) ([]Annotation, error) {
+	text = util.TruncTailBracketsText(text)
+	data, err := a.Annotate(text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, err
+	}
+	annotations := make([]Annotation, 0)
+	opt := DefaultOptions()
+	for _, v := range data.Annotations {
+		if opt.Accept(v) {
+			annotations = append(annotations, v)
+		}
+	}
+	return annotations, nil
+}
+
+// QueryTagMeはTagMeのAPIを使用した結果を得ます。
+func QueryTagMe(text string) (TagMeData, error) {
+	values := url.Values{}
+	values.Set("text", text)
+	values.Set("gcube-token", util.TagMeAPIKey)
+	req, err := http.NewRequest(
+		"POST",
+		"https://tagme.d4science.org/tagme/tag",
+		strings.NewReader(values.Encode()),
+	)
+	if err != nil {
+		return TagMeData{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := &http.Client{}
+	res, err := client.Do(req)
+	if err != nil {
+		return TagMeData{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		body, _ := io.ReadAll(res.Body)
+		return TagMeData{}, fmt.Errorf("status code error: %d %s", res.StatusCode, string(body))
+	}
+	body, _ := io.ReadAll(res.Body)
+	var d TagMeData
+	err = json.Unmarshal(body, &d)
+	if err != nil {
+		return TagMeData{}, err
+	}
+	return d, nil
+}
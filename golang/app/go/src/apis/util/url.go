@@ -0,0 +1,101 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// 取り除くトラッキング用のクエリパラメータ（utm_から始まるものは別に判定する）
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"ocid":    true,
+	"cmpid":   true,
+	"smid":    true,
+	"_ga":     true,
+	"igshid":  true,
+}
+
+// AMPページであることを示すクエリパラメータ（outputType=ampは別に判定する）
+var ampParams = map[string]bool{
+	"amp":      true,
+	"amp_js_v": true,
+	"usqp":     true,
+}
+
+// CanonicalizeUrlは同じ記事を指すURLが同一の文字列になるように正規化して戻す。
+// スキームはhttpsに、ホストは小文字にして「www.」と「amp.」を取り除く。
+// AMPページのパス（先頭の/amp/、末尾の/amp、.amp）やクエリ（?amp=1など）、トラッキング用のクエリ、フラグメントも取り除く。
+// 途中の/amp/は、ampという名前のセクションなどの場合があるため残す。
+func CanonicalizeUrl(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = "https"
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "amp."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	// AMPページのパスを取り除く
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	switch {
+	case strings.HasSuffix(path, "/amp"):
+		path = strings.TrimSuffix(path, "/amp")
+	case strings.HasSuffix(path, ".amp"):
+		path = strings.TrimSuffix(path, ".amp")
+	case strings.HasSuffix(path, ".amp.html"):
+		path = strings.TrimSuffix(path, ".amp.html") + ".html"
+	}
+	if strings.HasPrefix(path, "/amp/") {
+		path = strings.TrimPrefix(path, "/amp")
+	}
+	if path == "" {
+		path = "/"
+	}
+	u.RawPath = ""
+	u.Path, err = url.PathUnescape(path)
+	if err != nil {
+		return "", err
+	}
+	// トラッキングとAMPのクエリを取り除く（残りはキーの順に並び替わる）
+	query := u.Query()
+	for k := range query {
+		lower := strings.ToLower(k)
+		isAmp := ampParams[lower] || (lower == "outputtype" && strings.EqualFold(query.Get(k), "amp"))
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] || isAmp {
+			query.Del(k)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// CanonicalizeUrlOrRawはURLを正規化して戻す。正規化できなかった場合は与えられたURLをそのまま戻す。
+func CanonicalizeUrlOrRaw(raw string) string {
+	c, err := CanonicalizeUrl(raw)
+	if err != nil {
+		return raw
+	}
+	return c
+}
+
+// CanonicalUrlHashは正規化したURLのSHA-256を16進数の文字列（64文字）で戻す。
+// URLは長さに上限がないため、DBでは重複の判定にこの値を用いる。
+func CanonicalUrlHash(canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
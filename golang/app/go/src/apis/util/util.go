@@ -2,6 +2,8 @@ package util
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -104,3 +106,37 @@ func CutRemoveWords(str string) string {
 	}
 	return got
 }
+
+// WikiPathToTitleはwiki内記事のパスを記事名にする（例：/wiki/Joe_Biden → Joe Biden）
+func WikiPathToTitle(path string) string {
+	title := strings.TrimPrefix(path, "/wiki/")
+	if i := strings.Index(title, "#"); i >= 0 {
+		title = title[:i]
+	}
+	if unescaped, err := url.PathUnescape(title); err == nil {
+		title = unescaped
+	}
+	return strings.ReplaceAll(title, "_", " ")
+}
+
+var wikiTitleQualifier = regexp.MustCompile(`\s*\([^)]*\)$`)
+
+// TrimWikiTitleQualifierは記事名の末尾の括弧を取り除く（例：Mercury (planet) → Mercury）
+func TrimWikiTitleQualifier(title string) string {
+	return wikiTitleQualifier.ReplaceAllString(title, "")
+}
+
+var wikiPageIdPattern = regexp.MustCompile(`"wgArticleId":\s*(\d+)`)
+
+// WikiPageIdはwiki内記事のHTMLから、Wikipediaの記事ID（wgArticleId）を抽出する。見つからなければ0を戻す
+func WikiPageId(html string) int {
+	m := wikiPageIdPattern.FindStringSubmatch(html)
+	if m == nil {
+		return 0
+	}
+	id, err := strconv.Atoi(m[1])
+	if err != nil {
+		return 0
+	}
+	return id
+}
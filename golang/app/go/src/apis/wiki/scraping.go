@@ -226,6 +226,7 @@ func GetWikiArticle(path string) (sqldb.WikiArt, error) {
 		WikiSourceUrl: path,
 		Text:          allText,
 		WikiCategory:  util.JoinStringByTab(category),
+		PageId:        util.WikiPageId(allText),
 	}
 	// データベースに登録
 	err = sqldb.InsertWikiArticle(db, art)
@@ -273,9 +274,9 @@ func getNewsArticle(url string) (sqldb.NewsArt, error) {
 	get, err := sqldb.SelectNewsArticle(db, url)
 	// DB関連のエラー
 	if err != nil {
-		return emptyVal, fmt.Errorf("error %s [getNewsArticle()]: %s ", url[7:], err)
+		return emptyVal, fmt.Errorf("error %s [getNewsArticle()]: %s ", url, err)
 	}
-	// DBにすでに登録されている
+	// DBにすでに登録されている（別の日にAMPページなどのURLで引用された同じ記事を含む）
 	if get.Id != -1 {
 		return get, nil
 	}
@@ -285,7 +286,7 @@ func getNewsArticle(url string) (sqldb.NewsArt, error) {
 	/*
 		// 最後にデータを登録する
 		art := emptyVal
-		log.Println("started to get a news art, " + url[7:])
+		log.Println("started to get a news art, " + url)
 		news, err := Diffbot(url)
 		if err != nil {
 			sqldb.InsertNewsArticle(db, art)
@@ -293,17 +294,19 @@ func getNewsArticle(url string) (sqldb.NewsArt, error) {
 		}
 		// Objectsの0番目は存在する。また、現状の仕様[2023/10/28]では1以上の添え字でデータが渡されることはない。
 		date := news.Objects[0].Date
-		t, err := time.Parse("Mon, 02 Jan 2006 15:04:05 MST", date)
+		r, err := dateparse.Parse(date, time.Now())
 		if err != nil {
-			t = time.Date(2007, 1, 2, 0, 0, 0, 0, time.UTC)
+			r = dateparse.Result{Time: time.Date(2007, 1, 2, 0, 0, 0, 0, time.UTC)}
 		}
 		var cat []string
 		for _, v := range news.Objects[0].Categories {
 			cat = append(cat, v.Name)
 		}
-		log.Println("finished to get a article, " + url[7:])
+		log.Println("finished to get a article, " + url)
 		art = sqldb.NewsArt{
-			Timestamp:       t.Format("2006-01-02"),
+			Timestamp:       r.Time.UTC().Format(sqldb.TimestampLayout),
+			TimestampZone:   r.Zone(),
+			TimestampFormat: r.Format,
 			SiteName:        news.Objects[0].SiteName,
 			PublisherRegion: news.Objects[0].PublisherRegion,
 			Category:        util.JoinStringByTab(cat),
@@ -0,0 +1,108 @@
+package wiki
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WaybackのAvailability APIの接続先
+// ローカルの代替サーバを使う場合は書き換える
+var WaybackAPI = "https://archive.org/wayback/available"
+
+// Waybackのタイムスタンプの形式
+const waybackLayout = "20060102150405"
+
+// WaybackSnapshotはWayback Machineに保存されたスナップショットを保持する
+type WaybackSnapshot struct {
+	Url       string
+	Timestamp time.Time
+}
+
+// Availability APIから受け取ったデータを保持する構造体
+type waybackData struct {
+	ArchivedSnapshots struct {
+		Closest struct {
+			Available bool   `json:"available"`
+			Url       string `json:"url"`
+			Timestamp string `json:"timestamp"`
+			Status    string `json:"status"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+// Waybackは与えられた日時に最も近いスナップショットを探して戻す。
+// tがゼロ値の場合は、最新のスナップショットを探す。
+func Wayback(path string, t time.Time) (WaybackSnapshot, error) {
+	values := url.Values{}
+	values.Set("url", path)
+	if !t.IsZero() {
+		values.Set("timestamp", t.Format(waybackLayout))
+	}
+	res, err := http.Get(WaybackAPI + "?" + values.Encode())
+	if err != nil {
+		return WaybackSnapshot{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return WaybackSnapshot{}, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	body, _ := io.ReadAll(res.Body)
+	var d waybackData
+	err = json.Unmarshal(body, &d)
+	if err != nil {
+		return WaybackSnapshot{}, err
+	}
+	closest := d.ArchivedSnapshots.Closest
+	if !closest.Available || closest.Url == "" || closest.Status != "200" {
+		return WaybackSnapshot{}, errors.New("could not find a wayback snapshot: " + path)
+	}
+	ts, err := time.Parse(waybackLayout, closest.Timestamp)
+	if err != nil {
+		return WaybackSnapshot{}, err
+	}
+	return WaybackSnapshot{Url: rawSnapshotUrl(closest.Url, closest.Timestamp), Timestamp: ts}, nil
+}
+
+// rawSnapshotUrlはWaybackのツールバーなどが挿入されていない、元のままのページのURLを戻す
+func rawSnapshotUrl(snapshotUrl, timestamp string) string {
+	return strings.Replace(snapshotUrl, "/"+timestamp+"/", "/"+timestamp+"id_/", 1)
+}
+
+// DiffbotWithWaybackはDiffbotで記事を取得する。
+// 取得に失敗した場合は、tに最も近いWaybackのスナップショットから取得し直す。
+// スナップショットを使わなかった場合、WaybackSnapshotはゼロ値になる。
+func DiffbotWithWayback(path string, t time.Time) (DiffbotData, WaybackSnapshot, error) {
+	return DiffbotWithWaybackFunc(path, t, Diffbot)
+}
+
+// ErrQuotaは、DiffbotWithWaybackFuncに渡すdiffbotが、リクエスト数の上限に達したときに戻すエラー
+var ErrQuota = errors.New("reached the quota of diffbot requests")
+
+// DiffbotWithWaybackFuncはDiffbotWithWaybackと同じだが、Diffbotへのリクエストをdiffbotで行う。
+// 一件の記事でDiffbotを二回呼び出す場合があるため、リクエストごとに数える場合に用いる。
+// 一回目のリクエストがErrQuotaを戻した場合は、Waybackを探さずにそのまま戻す。
+// どちらのリクエストのエラーもerrors.Isで確かめられる。
+func DiffbotWithWaybackFunc(path string, t time.Time, diffbot func(string) (DiffbotData, error)) (DiffbotData, WaybackSnapshot, error) {
+	d, err := diffbot(path)
+	if err == nil {
+		return d, WaybackSnapshot{}, nil
+	}
+	if errors.Is(err, ErrQuota) {
+		return DiffbotData{}, WaybackSnapshot{}, err
+	}
+	snapshot, wbErr := Wayback(path, t)
+	if wbErr != nil {
+		return DiffbotData{}, WaybackSnapshot{}, fmt.Errorf("%w, and %v", err, wbErr)
+	}
+	d, wbErr = diffbot(snapshot.Url)
+	if wbErr != nil {
+		return DiffbotData{}, WaybackSnapshot{}, fmt.Errorf("%w, and %w", err, wbErr)
+	}
+	return d, snapshot, nil
+}
@@ -0,0 +1,66 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubWaybackは、snapshotが空ならスナップショットがないと答えるAvailability APIを立て、リクエストの数を戻す
+func stubWayback(t *testing.T, snapshot string) *int32 {
+	t.Helper()
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if snapshot == "" {
+			fmt.Fprint(w, `{"archived_snapshots": {}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"archived_snapshots": {"closest": {"available": true, "url": %q, "timestamp": "20220301000000", "status": "200"}}}`, snapshot)
+	}))
+	t.Cleanup(server.Close)
+	api := WaybackAPI
+	WaybackAPI = server.URL
+	t.Cleanup(func() { WaybackAPI = api })
+	return &calls
+}
+
+func TestDiffbotWithWaybackQuota(t *testing.T) {
+	errDead := errors.New("status code error: 404")
+	t0 := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		snapshot string
+		// 一回目と二回目のリクエストのエラー
+		errs     []error
+		want     error
+		wayback  int32
+		requests int
+	}{
+		{"quota on the first request skips wayback", "", []error{ErrQuota}, ErrQuota, 0, 1},
+		{"dead url without a snapshot keeps the first error", "", []error{errDead}, errDead, 1, 1},
+		{"quota on the snapshot request", "http://web.archive.org/web/20220301000000/http://example.com/a", []error{errDead, ErrQuota}, ErrQuota, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := stubWayback(t, tt.snapshot)
+			requests := 0
+			diffbot := func(path string) (DiffbotData, error) {
+				err := tt.errs[requests]
+				requests++
+				return DiffbotData{}, err
+			}
+			_, _, err := DiffbotWithWaybackFunc("http://example.com/a", t0, diffbot)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want errors.Is %v", err, tt.want)
+			}
+			if *calls != tt.wayback || requests != tt.requests {
+				t.Errorf("wayback lookups, diffbot requests = %d, %d, want %d, %d", *calls, requests, tt.wayback, tt.requests)
+			}
+		})
+	}
+}
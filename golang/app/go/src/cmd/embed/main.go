@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"main/apis/pyservice"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 実行コマンド：
+//
+//	go run . serve [-addr :8060] [-dim 64]
+//	go run . export -url http://localhost:8060 [-events ../toPy/entropy.json] [-out embeddings.jsonl|embeddings.npy]
+//
+// serveでは、埋め込みのAPIの代わり（FakeEmbedServer）を立てる。本物のモデルを動かすAPIも同じやり取り（POST /embed）にする。
+// exportでは、APIから求めた埋め込みをファイルに書き出す。cmd/topicsやcmd/similarの「-embeddings」に、ファイルかAPIのURLを指定して用いる。
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		serve(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		export(os.Args[2:])
+		return
+	}
+	fmt.Fprintln(os.Stderr, "usage: go run . serve|export [options]")
+	os.Exit(2)
+}
+
+// serveは埋め込みのAPIの代わりを立てる
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8060", "待ち受けるアドレス")
+	s := pyservice.NewFakeEmbedServer()
+	fs.IntVar(&s.Dim, "dim", s.Dim, "埋め込みの次元数")
+	fs.Parse(args)
+	fmt.Printf("listening on %s\n", *addr)
+	err := http.ListenAndServe(*addr, s)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// exportはAPIから求めた埋め込みをファイルに書き出す
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:8060", "埋め込みのAPIのURL")
+	events := fs.String("events", "../toPy/entropy.json", "イベントデータ")
+	out := fs.String("out", "embeddings.jsonl", "書き出すファイル（.jsonlか.npy）")
+	fs.Parse(args)
+	d, err := pipeline.ReadEvents(*events)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	embeddings, err := analysis.NewHTTPEmbedder(*url).Embed(d)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	switch strings.ToLower(filepath.Ext(*out)) {
+	case ".npy":
+		err = analysis.WriteEmbeddingsNpy(*out, embeddings)
+	case ".jsonl":
+		err = analysis.WriteEmbeddingsJsonl(*out, embeddings)
+	default:
+		err = fmt.Errorf("unknown output: %s (.jsonl, .npy)", *out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("events: %d\n", len(embeddings))
+}
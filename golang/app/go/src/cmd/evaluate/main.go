@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"os"
+	"strings"
+)
+
+// 実行コマンド：go run . [-events ../toPy/entropy.json] [-topics ../topics/topics.json] [-label leaf|root|path] [-json evaluation.json]
+//
+// イベントが置かれていたCurrent_eventsの見出し（Wikipediaの編集者が付けたもの）を正解のトピックとして、
+// cmd/topicsの分類を評価する（purity、NMI、ARI、B-cubed、ペア単位のF1）。全体と、月ごと、カテゴリごとに表示する。
+// 見出しはtagmeでイベントデータに持たせるため、それより前に作ったデータは評価できない。
+
+func main() {
+	eventsPath := flag.String("events", "../toPy/entropy.json", "イベントデータ")
+	topicsPath := flag.String("topics", "../topics/topics.json", "トピックの分類結果")
+	label := flag.String("label", analysis.LabelLeaf, "正解とする見出し（"+strings.Join(analysis.LabelNames, ", ")+"）")
+	jsonPath := flag.String("json", "", "評価をJSONで書き出すファイル（空文字の場合は書き出さない）")
+	flag.Parse()
+	if err := analysis.CheckLabel(*label); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	d, err := pipeline.ReadEvents(*eventsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	topics, err := pipeline.ReadTopics(*topicsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	ev := analysis.EvaluateTopics(d, topics, *label)
+	analysis.WriteEvaluation(os.Stdout, ev)
+	if *jsonPath != "" {
+		err = analysis.WriteEvaluationJson(*jsonPath, ev)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/linker"
+	"main/apis/pipeline"
+	"main/apis/pyservice"
+	"main/apis/tagme"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 実行コマンド：go run . run -dir <実行ディレクトリ> [オプション]
+//
+// tagme → toPy → topics → report の順に実行し、各工程の結果を実行ディレクトリに書き出す。
+// 入力とパラメータが前回から変わっていない工程は実行しない。
+// 「-from 工程名」を指定すると、その工程から実行し直す。
+
+const usage = `usage: go run . run -dir <run directory> [options]`
+
+// 実行ディレクトリに書き出すファイル
+const (
+	eventsFile    = "events.json"
+	linksFile     = "links.txt"
+	annotsFile    = "annotations.json"
+	entropyFile   = "entropy.json"
+	topicsFile    = "topics.json"
+	lifecycleFile = "lifecycle.json"
+	refineFile    = "refine.json"
+	rejectFile    = "rejections.json"
+	reportFile    = "report.txt"
+	evalFile      = "evaluation.txt"
+	evalJsonFile  = "evaluation.json"
+	similarFile   = "similar.json"
+	// tagmeの途中の結果（工程の出力ではない）
+	tagmeCheckpointFile = "tagme_checkpoint.json"
+)
+
+type option struct {
+	dir           string
+	from          string
+	start         string
+	end           string
+	linker        string
+	dict          string
+	entityOpt     tagme.Options
+	tagmeWorkers  int
+	tagmeCache    string
+	tagmeRetries  int
+	resume        bool
+	tfidf         string
+	entropy       string
+	pythonUrl     string
+	pythonChunk   int
+	pythonTimeout time.Duration
+	vectorizer    string
+	embeddings    string
+	cluster       string
+	clusterOpt    analysis.ClusterOption
+	refine        bool
+	refineOpt     analysis.RefineOption
+	minDocs       int
+	label         string
+	lshOpt        analysis.LSHOption
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "run" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var opt option
+	fs.StringVar(&opt.dir, "dir", "", "実行ディレクトリ（各工程の結果を書き出す）")
+	fs.StringVar(&opt.from, "from", "", "この工程から実行し直す（tagme, toPy, topics, report, evaluate, similar）")
+	fs.StringVar(&opt.start, "start", "2022-01-01", "イベントの開始日")
+	fs.StringVar(&opt.end, "end", "2022-12-31", "イベントの終了日（この日を含む）")
+	fs.StringVar(&opt.linker, "linker", "tagme", "エンティティの抽出方法（tagme, offline）")
+	fs.StringVar(&opt.dict, "dict", "anchors.json", "オフラインのリンカーで用いる辞書（cmd/tagmeのbuild-dictで作る）")
+	opt.entityOpt = tagme.DefaultOptions()
+	fs.Float64Var(&opt.entityOpt.MinLinkProbability, "min-lp", opt.entityOpt.MinLinkProbability, "エンティティとして用いるリンクになる割合の下限")
+	fs.Float64Var(&opt.entityOpt.MinRho, "min-rho", opt.entityOpt.MinRho, "エンティティとして用いるrhoの下限")
+	fs.IntVar(&opt.tagmeWorkers, "tagme-workers", 4, "エンティティの抽出を並行に行う数")
+	fs.StringVar(&opt.tagmeCache, "tagme-cache", "tagme_cache", "エンティティの抽出結果をキャッシュするフォルダ（空文字の場合はキャッシュしない）")
+	fs.IntVar(&opt.tagmeRetries, "tagme-retries", 3, "エンティティの抽出に失敗した場合の再試行の回数")
+	fs.BoolVar(&opt.resume, "resume", false, "tagmeを中断した場合に、記録した途中の結果から続きを処理する")
+	fs.StringVar(&opt.tfidf, "tfidf", "go", "TF-IDFの計算方法（go, python）")
+	fs.StringVar(&opt.entropy, "entropy", string(analysis.EntropyTokens), "情報エントロピーの定義（tokens, entities, normalized, legacy）")
+	fs.StringVar(&opt.pythonUrl, "python-url", "http://python3:8050", "PythonのAPIのURL")
+	fs.IntVar(&opt.pythonChunk, "python-chunk", 2000, "PythonのAPIに一度に送るイベントの数")
+	fs.DurationVar(&opt.pythonTimeout, "python-timeout", 10*time.Minute, "PythonのAPIへの一つのリクエストのタイムアウト")
+	fs.StringVar(&opt.vectorizer, "vectorizer", "tfidf", "トピックの分類に用いるベクトル（"+strings.Join(analysis.VectorizerNames, ", ")+"）")
+	fs.StringVar(&opt.embeddings, "embeddings", "", "埋め込みのファイル（.jsonl, .npy）かAPIのURL（指定した場合は-vectorizerの代わりに用いる）")
+	fs.StringVar(&opt.cluster, "cluster", "single-pass", "トピックの分類方法（"+strings.Join(analysis.ClustererNames, ", ")+"）")
+	opt.clusterOpt = analysis.DefaultClusterOption()
+	fs.Float64Var(&opt.clusterOpt.Threshold, "threshold", opt.clusterOpt.Threshold, "トピックに分類するコサイン類似度の閾値（single-pass, agglomerative, tdt）")
+	fs.Float64Var(&opt.clusterOpt.Decay, "centroid-decay", opt.clusterOpt.Decay, "トピックの重心をイベントを足すたびに近づける割合（0の場合は平均、single-pass）")
+	fs.StringVar(&opt.clusterOpt.Constraint.Mode, "entropy-constraint", opt.clusterOpt.Constraint.Mode, "情報エントロピーの制約の確かめ方（"+strings.Join(analysis.ConstraintNames, ", ")+"、single-pass）")
+	fs.Float64Var(&opt.clusterOpt.Constraint.Epsilon, "entropy-epsilon", opt.clusterOpt.Constraint.Epsilon, "情報エントロピーの制約で許容する幅（tolerance, trend、single-pass）")
+	fs.StringVar(&opt.clusterOpt.Linkage, "linkage", opt.clusterOpt.Linkage, "トピック間の類似度の求め方（average, complete、agglomerative）")
+	fs.Float64Var(&opt.clusterOpt.Eps, "eps", opt.clusterOpt.Eps, "近傍とするコサイン距離（dbscan）")
+	fs.IntVar(&opt.clusterOpt.MinPoints, "min-points", opt.clusterOpt.MinPoints, "コアとする近傍のイベントの数（dbscan）")
+	fs.IntVar(&opt.clusterOpt.K, "k", opt.clusterOpt.K, "トピックの数（0の場合はイベントの数から決める、kmeans）")
+	fs.Int64Var(&opt.clusterOpt.Seed, "seed", opt.clusterOpt.Seed, "乱数のシード（kmeans）")
+	fs.IntVar(&opt.clusterOpt.Window, "window", opt.clusterOpt.Window, "最後にイベントが加わってからトピックが続く日数（tdt）")
+	fs.Float64Var(&opt.clusterOpt.MergeThreshold, "merge-threshold", opt.clusterOpt.MergeThreshold, "トピックをまとめるコサイン類似度の閾値（0の場合はまとめない、tdt）")
+	fs.BoolVar(&opt.refine, "refine", false, "分類した後に、似たトピックをまとめ、まとまりの低いトピックを分ける")
+	opt.refineOpt = analysis.DefaultRefineOption()
+	fs.Float64Var(&opt.refineOpt.MergeThreshold, "refine-merge", opt.refineOpt.MergeThreshold, "トピックをまとめる重心のコサイン類似度の閾値（-refine）")
+	fs.IntVar(&opt.refineOpt.MaxGap, "refine-gap", opt.refineOpt.MaxGap, "まとめるトピックの期間の隙間として認める日数（-refine）")
+	fs.Float64Var(&opt.refineOpt.SplitCohesion, "refine-cohesion", opt.refineOpt.SplitCohesion, "トピックを分けるまとまりの閾値（-refine）")
+	fs.IntVar(&opt.refineOpt.MinSplitDocs, "refine-min-docs", opt.refineOpt.MinSplitDocs, "分けるトピックのイベント数の下限（-refine）")
+	fs.IntVar(&opt.minDocs, "min-docs", 5, "レポートに書き出すトピックのイベント数の下限")
+	fs.StringVar(&opt.label, "label", analysis.LabelLeaf, "評価で正解とする見出し（"+strings.Join(analysis.LabelNames, ", ")+"）")
+	opt.lshOpt = analysis.DefaultLSHOption()
+	fs.IntVar(&opt.lshOpt.Tables, "lsh-tables", opt.lshOpt.Tables, "似たイベントを探す索引のハッシュ表の数")
+	fs.IntVar(&opt.lshOpt.Bits, "lsh-bits", opt.lshOpt.Bits, "似たイベントを探す索引の一つのハッシュ表で用いる超平面の数")
+	fs.IntVar(&opt.lshOpt.Radius, "lsh-radius", opt.lshOpt.Radius, "似たイベントを探す索引で候補とするハッシュ値のハミング距離の上限")
+	fs.Parse(os.Args[2:])
+	if opt.dir == "" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	r := pipeline.Runner{
+		Dir:    opt.dir,
+		Stages: stages(opt),
+		From:   opt.from,
+		Log:    os.Stdout,
+	}
+	err := r.Run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// stagesはパイプラインの全ての工程を戻す
+func stages(opt option) []pipeline.Stage {
+	return []pipeline.Stage{
+		{
+			// DBは入力ファイルとして扱えないため、DBを更新した場合は「-from tagme」で実行し直す
+			Name:    "tagme",
+			Outputs: []string{eventsFile, linksFile, annotsFile},
+			Params: fmt.Sprintf("start=%s end=%s linker=%s min-lp=%v min-rho=%v",
+				opt.start, opt.end, linker.AnnotatorKey(opt.linker, opt.dict), opt.entityOpt.MinLinkProbability, opt.entityOpt.MinRho),
+			Run: func(dir string) error {
+				annotator, err := linker.NewAnnotator(opt.linker, opt.dict)
+				if err != nil {
+					return err
+				}
+				d, err := tagme.GetEventDataAllText(opt.start, opt.end)
+				if err != nil {
+					return err
+				}
+				client := tagme.NewClient(annotator, linker.AnnotatorKey(opt.linker, opt.dict))
+				client.Workers = opt.tagmeWorkers
+				client.CacheDir = opt.tagmeCache
+				client.Retries = opt.tagmeRetries
+				client.Checkpoint = filepath.Join(dir, tagmeCheckpointFile)
+				client.Resume = opt.resume
+				annotations, err := tagme.SetEntities(&d, client, opt.entityOpt)
+				if err != nil {
+					return err
+				}
+				err = pipeline.WriteAnnotations(filepath.Join(dir, annotsFile), annotations)
+				if err != nil {
+					return err
+				}
+				f, err := os.Create(filepath.Join(dir, linksFile))
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				tagme.WriteLinkReport(f, tagme.EvaluateAgainstHyperlinks(d))
+				return pipeline.WriteEvents(filepath.Join(dir, eventsFile), d)
+			},
+		},
+		{
+			Name:    "toPy",
+			Inputs:  []string{eventsFile},
+			Outputs: []string{entropyFile},
+			Params:  fmt.Sprintf("tfidf=%s entropy=%s", opt.tfidf, opt.entropy),
+			Run: func(dir string) error {
+				method, err := analysis.ParseEntropyMethod(opt.entropy)
+				if err != nil {
+					return err
+				}
+				d, err := pipeline.ReadEvents(filepath.Join(dir, eventsFile))
+				if err != nil {
+					return err
+				}
+				switch opt.tfidf {
+				case "go":
+					analysis.SetTfIdf(&d, analysis.DefaultTfIdfOption())
+				case "python":
+					c := pyservice.NewClient(opt.pythonUrl)
+					c.ChunkSize = opt.pythonChunk
+					c.Timeout = opt.pythonTimeout
+					d, err = c.TfIdf(d)
+					if err != nil {
+						return err
+					}
+				default:
+					return fmt.Errorf("unknown tfidf: %s", opt.tfidf)
+				}
+				analysis.SetEntropyWith(&d, method)
+				return pipeline.WriteEvents(filepath.Join(dir, entropyFile), d)
+			},
+		},
+		{
+			Name:    "topics",
+			Inputs:  []string{entropyFile},
+			Outputs: []string{topicsFile, lifecycleFile, refineFile, rejectFile},
+			Params:  fmt.Sprintf("vectorizer=%s embeddings=%s cluster=%s %+v refine=%v %+v", opt.vectorizer, analysis.EmbeddingsKey(opt.embeddings), opt.cluster, opt.clusterOpt, opt.refine, opt.refineOpt),
+			Run: func(dir string) error {
+				vectorizer, err := analysis.NewVectorizer(opt.vectorizer)
+				if opt.embeddings != "" {
+					vectorizer, err = analysis.NewEmbeddingVectorizer(opt.embeddings)
+				}
+				if err != nil {
+					return err
+				}
+				clusterer, err := analysis.NewClusterer(opt.cluster, opt.clusterOpt)
+				if err != nil {
+					return err
+				}
+				d, err := pipeline.ReadEvents(filepath.Join(dir, entropyFile))
+				if err != nil {
+					return err
+				}
+				analysis.SortByDateDesc(&d)
+				vectors, err := vectorizer.Vectorize(d)
+				if err != nil {
+					return err
+				}
+				// tdt以外ではトピックの変化の記録が、single-pass以外では加えなかったイベントの記録が空になる
+				var result []pipeline.Topic
+				var events pipeline.Lifecycle
+				var rejections pipeline.Rejections
+				if e, ok := clusterer.(analysis.Explainer); ok {
+					result, rejections, err = e.Explain(d, vectors)
+				} else {
+					result, events, err = analysis.ClusterAndTrack(clusterer, d, vectors)
+				}
+				if err != nil {
+					return err
+				}
+				err = pipeline.WriteLifecycle(filepath.Join(dir, lifecycleFile), events)
+				if err != nil {
+					return err
+				}
+				err = pipeline.WriteRejections(filepath.Join(dir, rejectFile), rejections)
+				if err != nil {
+					return err
+				}
+				// -refineを指定しない場合は、空の記録を書き出す
+				var refineLog pipeline.RefineLog
+				if opt.refine {
+					result, refineLog = analysis.Refine(result, vectors, opt.refineOpt)
+				}
+				err = pipeline.WriteRefineLog(filepath.Join(dir, refineFile), refineLog)
+				if err != nil {
+					return err
+				}
+				topics := pipeline.Topics{Result: result}
+				return pipeline.WriteTopics(filepath.Join(dir, topicsFile), topics)
+			},
+		},
+		{
+			Name:    "report",
+			Inputs:  []string{entropyFile, topicsFile},
+			Outputs: []string{reportFile},
+			Params:  fmt.Sprintf("min-docs=%d", opt.minDocs),
+			Run: func(dir string) error {
+				d, err := pipeline.ReadEvents(filepath.Join(dir, entropyFile))
+				if err != nil {
+					return err
+				}
+				topics, err := pipeline.ReadTopics(filepath.Join(dir, topicsFile))
+				if err != nil {
+					return err
+				}
+				f, err := os.Create(filepath.Join(dir, reportFile))
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				analysis.WriteReport(f, d, topics, opt.minDocs)
+				return nil
+			},
+		},
+		{
+			// イベントの見出しを正解として、トピックの分類を評価する
+			Name:    "evaluate",
+			Inputs:  []string{entropyFile, topicsFile},
+			Outputs: []string{evalFile, evalJsonFile},
+			Params:  fmt.Sprintf("label=%s", opt.label),
+			Run: func(dir string) error {
+				if err := analysis.CheckLabel(opt.label); err != nil {
+					return err
+				}
+				d, err := pipeline.ReadEvents(filepath.Join(dir, entropyFile))
+				if err != nil {
+					return err
+				}
+				topics, err := pipeline.ReadTopics(filepath.Join(dir, topicsFile))
+				if err != nil {
+					return err
+				}
+				ev := analysis.EvaluateTopics(d, topics, opt.label)
+				f, err := os.Create(filepath.Join(dir, evalFile))
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				analysis.WriteEvaluation(f, ev)
+				return analysis.WriteEvaluationJson(filepath.Join(dir, evalJsonFile), ev)
+			},
+		},
+		{
+			// イベントのTF-IDFから、似たイベントを探す索引を作る（cmd/similarで用いる）
+			Name:    "similar",
+			Inputs:  []string{entropyFile},
+			Outputs: []string{similarFile},
+			Params:  fmt.Sprintf("%+v", opt.lshOpt),
+			Run: func(dir string) error {
+				d, err := pipeline.ReadEvents(filepath.Join(dir, entropyFile))
+				if err != nil {
+					return err
+				}
+				vectors, err := analysis.PrecomputedTfIdf{}.Vectorize(d)
+				if err != nil {
+					return err
+				}
+				index, err := analysis.NewLSHIndex(opt.lshOpt)
+				if err != nil {
+					return err
+				}
+				index.Add(d, vectors)
+				return index.Save(filepath.Join(dir, similarFile))
+			},
+		},
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// 処理結果の状態
+const (
+	statusDone        = "done"
+	statusFailed      = "failed"
+	statusUnavailable = "unavailable"
+)
+
+// checkpointは処理済みの記事をモードごとに記録し、中断した処理を再開できるようにする
+type checkpoint struct {
+	path string
+	mu   sync.Mutex
+	// モード -> news記事のID -> 状態
+	Results map[string]map[int]string `json:"results"`
+}
+
+// loadCheckpointはファイルから処理済みの記事を読み込む。ファイルがない場合は空の記録を戻す。
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, Results: make(map[string]map[int]string)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Results == nil {
+		c.Results = make(map[string]map[int]string)
+	}
+	return c, nil
+}
+
+// statusは記録された状態を戻す。記録がない場合は空文字列を戻す。
+func (c *checkpoint) status(mode string, id int) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Results[mode][id]
+}
+
+// recordは処理結果を記録して、ファイルに書き込む
+func (c *checkpoint) record(mode string, id int, status string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Results[mode] == nil {
+		c.Results[mode] = make(map[int]string)
+	}
+	c.Results[mode][id] = status
+	return c.save()
+}
+
+// saveは書き込み途中で中断しても記録が壊れないように、一時ファイルに書き込んでから置き換える
+func (c *checkpoint) save() error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
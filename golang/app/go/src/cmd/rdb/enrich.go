@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"main/apis/sqldb"
+	"main/apis/util"
+	"main/apis/wiki"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// enrichOptionはコマンドラインで指定されたオプションを保持する
+type enrichOption struct {
+	mode        string
+	workers     int
+	quota       int
+	checkpoint  string
+	retryFailed bool
+	dryRun      bool
+}
+
+// errQuotaはDiffbotへのリクエスト数が上限に達したことを表す（wiki.DiffbotWithWaybackFuncはWaybackを探さずに戻す）
+var errQuota = wiki.ErrQuota
+
+// quotaはDiffbotへのリクエスト数の上限を管理する。
+// 記事が消えていた場合は一件でWaybackのスナップショットの分も呼び出すため、記事ではなくリクエストごとに数える。
+type quota struct {
+	mu    sync.Mutex
+	limit int
+	used  int
+}
+
+// takeは上限に達していなければ一回分を消費してtrueを戻す
+func (q *quota) take() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limit > 0 && q.used >= q.limit {
+		return false
+	}
+	q.used++
+	return true
+}
+
+func (q *quota) exhausted() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit > 0 && q.used >= q.limit
+}
+
+// enrichはdiffbotからデータ取得ができなかった記事を、複数のワーカーで取得し直してDBを更新する。
+// 一件の取得や更新に失敗しても処理は続け、結果はチェックポイントに記録する。
+// リクエスト数が上限に達して取得できなかった記事は記録せず、次に実行したときに取得する。
+func enrich(opt enrichOption) error {
+	db, err := sqldb.ConnectDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	newsAry, err := sqldb.SelectNewsArtsEmptyData(db)
+	if err != nil {
+		return err
+	}
+	eventDates, err := sqldb.SelectNewsEventDates(db)
+	if err != nil {
+		return err
+	}
+	cp, err := loadCheckpoint(opt.checkpoint)
+	if err != nil {
+		return err
+	}
+	targets := pendingNewsArts(newsAry, cp, opt)
+	fmt.Printf("%s: %d articles (skipped %d by checkpoint)\n", opt.mode, len(targets), len(newsAry)-len(targets))
+	if opt.dryRun {
+		for _, v := range targets {
+			path, _ := requestUrl(opt.mode, v.NewsSourceUrl)
+			fmt.Printf("%d\t%s\t%s\n", v.Id, eventDates[v.Id], path)
+		}
+		return nil
+	}
+
+	q := &quota{limit: opt.quota}
+	p := newProgress(len(targets))
+	jobs := make(chan sqldb.NewsArt)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var failures []string
+	workers := opt.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range jobs {
+				if q.exhausted() {
+					continue
+				}
+				err := enrichNewsArt(db, opt.mode, v, eventDates[v.Id], q)
+				if errors.Is(err, errQuota) {
+					continue
+				}
+				status := statusDone
+				if err != nil {
+					status = statusFailed
+					errMu.Lock()
+					failures = append(failures, fmt.Sprintf("id: %d, %v", v.Id, err))
+					errMu.Unlock()
+				}
+				if err := cp.record(opt.mode, v.Id, status); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				p.add(err == nil)
+			}
+		}()
+	}
+	for _, v := range targets {
+		if q.exhausted() {
+			break
+		}
+		jobs <- v
+	}
+	close(jobs)
+	wg.Wait()
+	p.finish()
+
+	for _, f := range failures {
+		fmt.Fprintln(os.Stderr, f)
+	}
+	if q.exhausted() {
+		fmt.Printf("reached the quota (%d requests), run again to resume\n", q.limit)
+	}
+	return nil
+}
+
+// pendingNewsArtsはチェックポイントで処理済みになっていない記事を戻す
+func pendingNewsArts(newsAry []sqldb.NewsArt, cp *checkpoint, opt enrichOption) []sqldb.NewsArt {
+	var targets []sqldb.NewsArt
+	for _, v := range newsAry {
+		switch cp.status(opt.mode, v.Id) {
+		case statusDone, statusUnavailable:
+			continue
+		case statusFailed:
+			if !opt.retryFailed {
+				continue
+			}
+		}
+		if _, ok := requestUrl(opt.mode, v.NewsSourceUrl); !ok {
+			continue
+		}
+		targets = append(targets, v)
+	}
+	return targets
+}
+
+// requestUrlはモードに応じてDiffbotに渡すURLを戻す。
+// amp-retryで正規化しても変わらないURLの場合、falseを戻す。
+func requestUrl(mode, path string) (string, bool) {
+	if mode != "amp-retry" {
+		return path, true
+	}
+	canonical, err := util.CanonicalizeUrl(path)
+	if err != nil || sameExceptScheme(canonical, path) {
+		return "", false
+	}
+	return canonical, true
+}
+
+// sameExceptSchemeはスキームと「www.」を除いて二つのURLが同じかどうかを戻す
+func sameExceptScheme(canonical, path string) bool {
+	for _, prefix := range []string{"https://", "http://", "www."} {
+		path = strings.TrimPrefix(path, prefix)
+		canonical = strings.TrimPrefix(canonical, prefix)
+	}
+	return canonical == path
+}
+
+// enrichNewsArtは一件の記事を取得して、DBを更新する。
+// Diffbotへのリクエストのたびにqを一回分消費し、上限に達していた場合はerrQuotaを戻す。
+func enrichNewsArt(db *sql.DB, mode string, v sqldb.NewsArt, eventDate string, q *quota) error {
+	path, _ := requestUrl(mode, v.NewsSourceUrl)
+	diffbot := func(path string) (wiki.DiffbotData, error) {
+		if !q.take() {
+			return wiki.DiffbotData{}, errQuota
+		}
+		return wiki.Diffbot(path)
+	}
+	var news wiki.DiffbotData
+	var snapshot wiki.WaybackSnapshot
+	var err error
+	if mode == "auto" {
+		// 記事が消えていた場合は、イベントの日付に近いWaybackのスナップショットから取得する
+		t, _ := time.Parse("2006-01-02", eventDate)
+		news, snapshot, err = wiki.DiffbotWithWaybackFunc(path, t, diffbot)
+	} else {
+		news, err = diffbot(path)
+	}
+	if err != nil {
+		return err
+	}
+	data := parseNewsArt(news, v.NewsSourceUrl)
+	data.Id = v.Id
+	if snapshot.Url != "" {
+		data.ArchiveUrl = snapshot.Url
+		data.ArchiveTimestamp = snapshot.Timestamp.Format(sqldb.TimestampLayout)
+	}
+	return sqldb.UpdateDiffbotData(db, data)
+}
@@ -1,166 +1,76 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"errors"
+	"flag"
 	"fmt"
+	"main/apis/dateparse"
 	"main/apis/sqldb"
 	"main/apis/util"
 	"main/apis/wiki"
 	"os"
-	"strings"
 	"time"
 )
 
-func main() {
-	newsAry, err := sqldb.GetEmptyDataOfNewsArts()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
-	}
-	fmt.Println("get newsAry")
-	for _, v := range newsAry {
-		fmt.Println("req diffbot: ", v.NewsSourceUrl[7:])
-		dbData, err := wiki.Diffbot(v.NewsSourceUrl)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			continue
-		}
-		data := parseNewsArt(dbData, v.NewsSourceUrl)
-		data.Id = v.Id
-		db, err := sqldb.ConnectDB()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		err = sqldb.UpdateDiffbotData(db, data)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		db.Close()
-	}
-}
+// 実行コマンド：go run . <auto|amp-retry|manual> [オプション]
+//
+//	auto      ：Diffbotで記事を取得し直す（消えている記事はWaybackのスナップショットから取得する）
+//	amp-retry ：正規化したURL（AMPページなどを取り除いたURL）でDiffbotから取得し直す
+//	manual    ：記事のデータを手動で入力する
 
-func reGetDiffbotCutTail() {
-	newsAry, err := sqldb.GetEmptyDataOfNewsArts()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
-	}
-	fmt.Println("get newsAry")
-	for _, v := range newsAry {
-		fmt.Println(v.NewsSourceUrl)
-		path, err := trucAmp(v.NewsSourceUrl)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			continue
-		}
-		fmt.Println("req diffbot")
-		dbData, err := wiki.Diffbot(path)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			continue
-		}
-		data := parseNewsArt(dbData, v.NewsSourceUrl)
-		data.Id = v.Id
-		db, err := sqldb.ConnectDB()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		defer db.Close()
-		err = sqldb.UpdateDiffbotData(db, data)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-	}
-}
+const usage = `usage: go run . <auto|amp-retry|manual> [options]`
 
-func manualInput() {
-	newsAry, err := sqldb.GetEmptyDataOfNewsArts()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
-	}
-	writeURL(newsAry)
-	for _, v := range newsAry {
-		fmt.Println(v.NewsSourceUrl)
-		news, err := inputNewsArt()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		var data sqldb.NewsArt
-		if len(news.Objects) == 0 {
-			data = sqldb.NewsArt{Timestamp: "2008-01-02", NewsSourceUrl: v.NewsSourceUrl}
-		} else {
-			data = parseNewsArt(news, v.NewsSourceUrl)
-		}
-		db, err := sqldb.ConnectDB()
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		defer db.Close()
-		err = sqldb.UpdateDiffbotData(db, data)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "id: ", v.Id)
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
-}
+	mode := os.Args[1]
+	fs := flag.NewFlagSet(mode, flag.ExitOnError)
+	var opt enrichOption
+	fs.IntVar(&opt.workers, "workers", 4, "Diffbotへ同時にリクエストする数")
+	fs.IntVar(&opt.quota, "quota", 0, "Diffbotへのリクエスト数の上限（0は無制限）")
+	fs.StringVar(&opt.checkpoint, "checkpoint", "enrich_checkpoint.json", "処理済みの記事を記録するファイル")
+	fs.BoolVar(&opt.retryFailed, "retry-failed", false, "以前の実行で失敗した記事も取得し直す")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "リクエストとDBの更新を行わずに、対象の記事を表示する")
+	fs.Parse(os.Args[2:])
+	opt.mode = mode
 
-func trucAmp(path string) (string, error) {
-	if strings.Contains(path[len(path)-5:], "amp") {
-		idx := strings.Index(path[len(path)-5:], "amp")
-		return path[:len(path)-6+idx], nil
+	var err error
+	switch mode {
+	case "auto", "amp-retry":
+		err = enrich(opt)
+	case "manual":
+		err = manualInput(opt)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
 	}
-	return "", errors.New("not found \"amp\"")
-}
-
-func inputNewsArt() (wiki.DiffbotData, error) {
-	scanner := bufio.NewScanner(os.Stdin)
-	var body []byte
-	for scanner.Scan() {
-		get := string(scanner.Bytes())
-		if get == "fin:" {
-			break
-		}
-		if get == "no:" {
-			return wiki.DiffbotData{}, nil
-		}
-		body = append(body, scanner.Bytes()...)
-	}
-	var data wiki.DiffbotData
-	err := json.Unmarshal(body, &data)
 	if err != nil {
-		return wiki.DiffbotData{}, err
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	return data, nil
 }
 
+// parseNewsArtはDiffbotのレスポンスをnews記事に変換する。
+// タイムスタンプが解析できなかった場合は、2007-01-02として登録する。
 func parseNewsArt(news wiki.DiffbotData, path string) sqldb.NewsArt {
 	date := news.Objects[0].Date
-	t, err := time.Parse("Mon, 02 Jan 2006 15:04:05 MST", date)
+	r, err := dateparse.Parse(date, time.Now())
 	if err != nil {
-		t = time.Date(2007, 1, 2, 0, 0, 0, 0, time.UTC)
+		fmt.Fprintf(os.Stderr, "could not parse the timestamp %q: %v\n", date, err)
+		r = dateparse.Result{Time: time.Date(2007, 1, 2, 0, 0, 0, 0, time.UTC)}
+	}
+	if r.Ambiguous {
+		fmt.Fprintf(os.Stderr, "the timestamp %q is ambiguous, parsed as month/day: %s\n", date, path)
 	}
 	var cat []string
 	for _, v := range news.Objects[0].Categories {
 		cat = append(cat, v.Name)
 	}
 	data := sqldb.NewsArt{
-		Timestamp:       t.Format("2006-01-02"),
+		Timestamp:       r.Time.UTC().Format(sqldb.TimestampLayout),
+		TimestampZone:   r.Zone(),
+		TimestampFormat: r.Format,
 		SiteName:        news.Objects[0].SiteName,
 		PublisherRegion: news.Objects[0].PublisherRegion,
 		Category:        util.JoinStringByTab(cat),
@@ -171,25 +81,3 @@ func parseNewsArt(news wiki.DiffbotData, path string) sqldb.NewsArt {
 	}
 	return data
 }
-
-func writeURL(news []sqldb.NewsArt) {
-	os.Remove("tmp.txt")
-	f, err := os.Create("tmp.txt")
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		return
-	}
-	for _, v := range news {
-		str := []byte(v.NewsSourceUrl)
-		_, err := f.Write(str)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-		_, err = f.Write([]byte("\n"))
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			return
-		}
-	}
-}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// progressは処理の進捗と残り時間の見込みを表示する
+type progress struct {
+	mu      sync.Mutex
+	total   int
+	done    int
+	failed  int
+	started time.Time
+}
+
+func newProgress(total int) *progress {
+	return &progress{total: total, started: time.Now()}
+}
+
+// addは処理を一件終えたことを記録して、進捗を表示する
+func (p *progress) add(ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if !ok {
+		p.failed++
+	}
+	fmt.Printf("\r%s", p.line())
+}
+
+// finishは最終的な結果を表示する
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Printf("\r%s\n", p.line())
+}
+
+func (p *progress) line() string {
+	elapsed := time.Since(p.started)
+	eta := "--"
+	if p.done > 0 {
+		remain := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		eta = remain.Round(time.Second).String()
+	}
+	percent := 100
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	return fmt.Sprintf("finished: %3d%% (%d/%d, failed: %d) elapsed: %s eta: %s   ",
+		percent, p.done, p.total, p.failed, elapsed.Round(time.Second), eta)
+}
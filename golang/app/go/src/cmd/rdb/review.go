@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"main/apis/dateparse"
+	"main/apis/sqldb"
+	"main/apis/wiki"
+	"os"
+	"strings"
+	"time"
+)
+
+// 記事を取得できなかったものとして登録する場合のタイムスタンプ
+const unavailableTimestamp = "2008-01-02"
+
+// 画面を消去するためのエスケープシーケンス
+const clearScreen = "\033[H\033[2J"
+
+const reviewHelp = `[t]itle  [d]ate  [s]ite name  te[x]t  [j]son paste
+[w]rite and next  [u]navailable  [n]ext (skip)  [b]ack  [q]uit`
+
+// reviewItemは確認中の記事と、その記事を参照しているイベントを保持する
+type reviewItem struct {
+	news   sqldb.NewsArt
+	events []sqldb.Event
+	status string
+}
+
+// reviewerは標準入力から操作を受け取り、一件ずつ記事のデータを入力させる
+type reviewer struct {
+	db    *sql.DB
+	cp    *checkpoint
+	mode  string
+	in    *bufio.Reader
+	out   io.Writer
+	items []reviewItem
+	idx   int
+	msg   string
+}
+
+// manualInputはdiffbotからデータ取得ができなかった記事を一件ずつ表示し、
+// 手動でタイトルや日付、本文を入力させてDBを更新する。
+func manualInput(opt enrichOption) error {
+	db, err := sqldb.ConnectDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	newsAry, err := sqldb.SelectNewsArtsEmptyData(db)
+	if err != nil {
+		return err
+	}
+	newsEvents, err := sqldb.SelectEventsOfNewsArts(db)
+	if err != nil {
+		return err
+	}
+	cp, err := loadCheckpoint(opt.checkpoint)
+	if err != nil {
+		return err
+	}
+	newsAry = pendingNewsArts(newsAry, cp, opt)
+	if opt.dryRun {
+		for _, v := range newsAry {
+			fmt.Printf("%d\t%s\n", v.Id, v.NewsSourceUrl)
+		}
+		return nil
+	}
+	r := &reviewer{
+		db:   db,
+		cp:   cp,
+		mode: opt.mode,
+		in:   bufio.NewReader(os.Stdin),
+		out:  os.Stdout,
+	}
+	for _, v := range newsAry {
+		r.items = append(r.items, reviewItem{news: v, events: newsEvents[v.Id]})
+	}
+	return r.run()
+}
+
+// runは全ての記事を確認し終えるか、終了が選ばれるまで操作を受け付ける
+func (r *reviewer) run() error {
+	for r.idx < len(r.items) {
+		r.render()
+		cmd, err := r.readLine("> ")
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		item := &r.items[r.idx]
+		r.msg = ""
+		switch strings.TrimSpace(cmd) {
+		case "t":
+			item.news.Title, err = r.editLine("title", item.news.Title)
+		case "s":
+			item.news.SiteName, err = r.editLine("site name", item.news.SiteName)
+		case "d":
+			err = r.editDate(item)
+		case "x":
+			item.news.Text, err = r.readBlock("text")
+		case "j":
+			err = r.pasteJson(item)
+		case "w":
+			err = r.save(item, statusDone)
+		case "u":
+			item.news = sqldb.NewsArt{Id: item.news.Id, Timestamp: unavailableTimestamp, NewsSourceUrl: item.news.NewsSourceUrl}
+			err = r.save(item, statusUnavailable)
+		case "n":
+			r.idx++
+		case "b":
+			if r.idx > 0 {
+				r.idx--
+			}
+		case "q":
+			return nil
+		default:
+			r.msg = "unknown command"
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			r.msg = err.Error()
+		}
+	}
+	fmt.Fprintln(r.out, "all articles are reviewed")
+	return nil
+}
+
+// renderは確認中の記事とイベントの情報を表示する
+func (r *reviewer) render() {
+	item := r.items[r.idx]
+	var b strings.Builder
+	b.WriteString(clearScreen)
+	fmt.Fprintf(&b, "[%d/%d] id: %d", r.idx+1, len(r.items), item.news.Id)
+	if item.status != "" {
+		fmt.Fprintf(&b, " (%s)", item.status)
+	}
+	fmt.Fprintf(&b, "\n%s\n\n", item.news.NewsSourceUrl)
+	for _, e := range item.events {
+		fmt.Fprintf(&b, "・%s [%s]\n  %s\n", e.Date, e.Category, strings.TrimSpace(e.Text))
+	}
+	fmt.Fprintf(&b, "\ntitle    : %s\n", item.news.Title)
+	fmt.Fprintf(&b, "date     : %s\n", item.news.Timestamp)
+	fmt.Fprintf(&b, "site name: %s\n", item.news.SiteName)
+	fmt.Fprintf(&b, "text     : %s\n\n", abbreviate(item.news.Text, 200))
+	b.WriteString(reviewHelp + "\n")
+	if r.msg != "" {
+		fmt.Fprintf(&b, "! %s\n", r.msg)
+	}
+	fmt.Fprint(r.out, b.String())
+}
+
+// abbreviateは長い文字列をn文字までに切り詰める
+func abbreviate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+func (r *reviewer) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// editLineは一行の値を入力させる。空行の場合は元の値のままにする。
+func (r *reviewer) editLine(name, current string) (string, error) {
+	line, err := r.readLine(fmt.Sprintf("%s [%s]: ", name, current))
+	if err != nil {
+		return current, err
+	}
+	if line == "" {
+		return current, nil
+	}
+	return line, nil
+}
+
+// readBlockは「.」だけの行が入力されるまで、複数行の値を入力させる
+func (r *reviewer) readBlock(name string) (string, error) {
+	fmt.Fprintf(r.out, "%s (end with a line containing only \".\"):\n", name)
+	var lines []string
+	for {
+		line, err := r.readLine("")
+		if err != nil {
+			return strings.Join(lines, "\n"), err
+		}
+		if line == "." {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// editDateは日時を入力させる。形式はdateparse.Parseが解析できるものであれば何でもよい。
+func (r *reviewer) editDate(item *reviewItem) error {
+	line, err := r.editLine("date", item.news.Timestamp)
+	if err != nil || line == item.news.Timestamp {
+		return err
+	}
+	d, err := dateparse.Parse(line, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid date: %s", line)
+	}
+	item.news.Timestamp = d.Time.UTC().Format(sqldb.TimestampLayout)
+	item.news.TimestampZone = d.Zone()
+	item.news.TimestampFormat = d.Format
+	r.msg = "parsed as " + d.Format
+	if d.Ambiguous {
+		r.msg += " (ambiguous, read as month/day; enter 2006-01-02 to be explicit)"
+	}
+	return nil
+}
+
+// pasteJsonはDiffbotのレスポンス（JSON）を貼り付けさせて、各項目に反映する
+func (r *reviewer) pasteJson(item *reviewItem) error {
+	body, err := r.readBlock("diffbot json")
+	if err != nil {
+		return err
+	}
+	var data wiki.DiffbotData
+	err = json.Unmarshal([]byte(body), &data)
+	if err != nil {
+		return err
+	}
+	if len(data.Objects) == 0 {
+		return fmt.Errorf("no objects in json")
+	}
+	id := item.news.Id
+	item.news = parseNewsArt(data, item.news.NewsSourceUrl)
+	item.news.Id = id
+	return nil
+}
+
+// saveは記事のデータをDBに登録して、次の記事に進む
+func (r *reviewer) save(item *reviewItem, status string) error {
+	if item.news.Timestamp == "" {
+		return fmt.Errorf("date is empty, use [u] if the article is unavailable")
+	}
+	err := sqldb.UpdateDiffbotData(r.db, item.news)
+	if err != nil {
+		return err
+	}
+	item.status = status
+	if err := r.cp.record(r.mode, item.news.Id, status); err != nil {
+		return err
+	}
+	r.idx++
+	return nil
+}
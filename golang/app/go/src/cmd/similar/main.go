@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"os"
+	"strings"
+)
+
+// 実行コマンド：
+//
+//	go run . build [-events ../toPy/entropy.json,../data/runs/2023/entropy.json] [-embeddings embeddings.jsonl] [-index similar.json] [-tables 32] [-bits 20] [-radius 3] [-seed 1]
+//	go run . -event-id N [-k 20] [-index similar.json] [-exact]
+//	go run . -recall 200 [-k 20] [-index similar.json]
+//
+// buildでは、パイプラインで作ったイベントのTF-IDFから、似たイベントを探す索引（random-projection LSH）を作る。
+// 複数の年のイベントデータをカンマ区切りで指定すると、年をまたいで探せる（同じIDのイベントは最初のものを用いる）。
+// 「-embeddings」に埋め込みのファイル（.jsonl, .npy）か手元のAPIのURLを指定すると、TF-IDFの代わりに埋め込みで索引を作る。
+// 「-event-id」では、そのイベントに似たイベントをコサイン類似度の高い順に「-k」件表示する。
+// 「-exact」では索引を使わずに全てのイベントと比べ、「-recall」では指定した数のイベントで近似の再現率を確かめる。
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		build(os.Args[2:])
+		return
+	}
+	indexPath := flag.String("index", "similar.json", "索引のファイル")
+	id := flag.Int("event-id", 0, "似たイベントを探すイベントのID")
+	k := flag.Int("k", 20, "表示するイベントの数")
+	exact := flag.Bool("exact", false, "索引を使わずに全てのイベントと比べる")
+	recall := flag.Int("recall", 0, "指定した数のイベントで、全てのイベントと比べた上位k件を索引で見つけられた割合を表示する")
+	flag.Parse()
+	if *id == 0 && *recall == 0 {
+		fmt.Fprintln(os.Stderr, "specify -event-id or -recall")
+		os.Exit(2)
+	}
+	index, err := analysis.LoadLSHIndex(*indexPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if *recall > 0 {
+		r, compared := index.Recall(*k, *recall)
+		fmt.Printf("recall@%d over %d events: %.4f (compared with %.1f%% of events)\n", *k, *recall, r, compared*100)
+		return
+	}
+	var neighbors []analysis.Neighbor
+	if *exact {
+		neighbors, err = index.SimilarExact(*id, *k)
+	} else {
+		neighbors, err = index.Similar(*id, *k)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	for i, v := range neighbors {
+		text := []rune(strings.TrimSpace(v.Text))
+		if len(text) > 100 {
+			text = append(text[:99], '…')
+		}
+		fmt.Printf("%3d %.4f %s %7d %s\n", i+1, v.Similarity, v.Date, v.Id, string(text))
+	}
+}
+
+// buildはイベントデータから索引を作って書き出す
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	events := fs.String("events", "../toPy/entropy.json", "イベントデータ（カンマ区切りで複数指定できる）")
+	out := fs.String("index", "similar.json", "索引を書き出すファイル")
+	embeddings := fs.String("embeddings", "", "埋め込みのファイル（.jsonl, .npy）かAPIのURL（指定した場合はTF-IDFの代わりに用いる）")
+	opt := analysis.DefaultLSHOption()
+	fs.IntVar(&opt.Tables, "tables", opt.Tables, "ハッシュ表の数（多いほど見落としが減り、遅くなる）")
+	fs.IntVar(&opt.Bits, "bits", opt.Bits, "一つのハッシュ表で用いる超平面の数（64まで、多いほど比べるイベントが減る）")
+	fs.IntVar(&opt.Radius, "radius", opt.Radius, "検索で候補とするハッシュ値のハミング距離の上限（大きいほど見落としが減り、遅くなる）")
+	fs.Int64Var(&opt.Seed, "seed", opt.Seed, "超平面を決めるシード")
+	fs.Parse(args)
+	index, err := analysis.NewLSHIndex(opt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	// パイプラインで計算したTF-IDFをそのまま用いる
+	var vectorizer analysis.Vectorizer = analysis.PrecomputedTfIdf{}
+	if *embeddings != "" {
+		vectorizer, err = analysis.NewEmbeddingVectorizer(*embeddings)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	for _, path := range strings.Split(*events, ",") {
+		d, err := pipeline.ReadEvents(strings.TrimSpace(path))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		vectors, err := vectorizer.Vectorize(d)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		index.Add(d, vectors)
+	}
+	err = index.Save(*out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("events: %d, terms: %d\n", index.Len(), len(index.Terms))
+}
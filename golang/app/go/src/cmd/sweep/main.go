@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 実行コマンド：go run . [-events ../toPy/entropy.json] [-vectorizers tfidf,bm25] [-thresholds 0.2,0.25,0.3,0.35,0.4] [-constraints strict,off] [-orders desc,asc] [-metric bcubed_f1] [-out sweep]
+//
+// cmd/topicsで手で決めていたコサイン類似度の閾値などを、全ての組み合わせでClassificationを行って比べる。
+// 各設定の分類は、イベントの見出しを正解として評価し（cmd/evaluateと同じ指標）、「-metric」の高い順に並べる。
+// 「-out」のディレクトリに、順位表（leaderboard.csv, leaderboard.json）と、
+// 最も高い設定で分類したトピック（topics.json）とその評価（evaluation.txt, evaluation.json）を書き出す。
+
+func main() {
+	eventsPath := flag.String("events", "../toPy/entropy.json", "イベントデータ")
+	vectorizers := flag.String("vectorizers", "tfidf", "試すベクトルの作り方をカンマ区切りで指定（"+strings.Join(analysis.VectorizerNames, ", ")+"）")
+	thresholds := flag.String("thresholds", "0.2,0.25,0.3,0.35,0.4,0.45,0.5", "試すコサイン類似度の閾値をカンマ区切りで指定")
+	constraints := flag.String("constraints", "strict,tolerance,trend,off", "情報エントロピーの制約の確かめ方をカンマ区切りで指定（"+strings.Join(analysis.ConstraintNames, ", ")+"）")
+	epsilon := flag.Float64("epsilon", analysis.DefaultEntropyConstraint().Epsilon, "情報エントロピーの制約で許容する幅（tolerance, trend）")
+	orders := flag.String("orders", analysis.OrderDesc, "イベントを分類する順番をカンマ区切りで指定（desc, asc）")
+	label := flag.String("label", analysis.LabelLeaf, "正解とする見出し（"+strings.Join(analysis.LabelNames, ", ")+"）")
+	metric := flag.String("metric", "bcubed_f1", "順位を決める指標（"+strings.Join(analysis.MetricNames, ", ")+"）")
+	out := flag.String("out", "sweep", "結果を書き出すディレクトリ")
+	flag.Parse()
+	if err := analysis.CheckLabel(*label); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	grid, err := parseGrid(*vectorizers, *thresholds, *constraints, *orders)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	grid.Epsilon = *epsilon
+	d, err := pipeline.ReadEvents(*eventsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	results, best, err := analysis.Sweep(d, grid, *label, *metric)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(os.Stderr, "no configuration to try")
+		return
+	}
+	err = os.MkdirAll(*out, 0755)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	err = analysis.WriteSweepCsv(filepath.Join(*out, "leaderboard.csv"), results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	err = analysis.WriteSweepJson(filepath.Join(*out, "leaderboard.json"), results)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	// 最も高い設定の分類と評価を書き出す
+	bestTopics := pipeline.Topics{Result: best}
+	err = pipeline.WriteTopics(filepath.Join(*out, "topics.json"), bestTopics)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	ev := analysis.EvaluateTopics(d, bestTopics, *label)
+	f, err := os.Create(filepath.Join(*out, "evaluation.txt"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Fprintf(f, "best: %+v\n", results[0].Config)
+	analysis.WriteEvaluation(f, ev)
+	f.Close()
+	err = analysis.WriteEvaluationJson(filepath.Join(*out, "evaluation.json"), ev)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	fmt.Printf("%4s %-10s %9s %10s %5s %6s %8s\n", "rank", "vectorizer", "threshold", "constraint", "order", "topics", *metric)
+	for _, r := range results {
+		fmt.Printf("%4d %-10s %9.3f %10s %5s %6d %8.4f\n", r.Rank, r.Config.Vectorizer, r.Config.Threshold, r.Config.Constraint, r.Config.Order, r.Topics, r.Metric)
+	}
+}
+
+// parseGridはカンマ区切りで指定した値から、試す設定の組み合わせを作る
+func parseGrid(vectorizers, thresholds, constraints, orders string) (analysis.SweepGrid, error) {
+	var grid analysis.SweepGrid
+	grid.Vectorizers = splitList(vectorizers)
+	for _, v := range splitList(thresholds) {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return grid, fmt.Errorf("invalid threshold: %s", v)
+		}
+		grid.Thresholds = append(grid.Thresholds, t)
+	}
+	grid.Constraints = splitList(constraints)
+	grid.Orders = splitList(orders)
+	return grid, nil
+}
+
+// splitListはカンマ区切りの文字列を分け、空の要素を除く
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
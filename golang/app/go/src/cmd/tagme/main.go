@@ -1,177 +1,106 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
+	"main/apis/linker"
+	"main/apis/pipeline"
 	"main/apis/sqldb"
-	"main/apis/util"
-	"net/http"
-	"net/url"
+	"main/apis/tagme"
 	"os"
-	"strings"
 )
 
-type TagMeData struct {
-	Test        string `json:"test"`
-	Annotations []struct {
-		Spot            string  `json:"spot"`
-		Start           int     `json:"start"`
-		LinkProbability float64 `json:"link_probability"`
-		Rho             float64 `json:"rho"`
-		End             int     `json:"end"`
-		ID              int     `json:"id"`
-		Title           string  `json:"title"`
-	} `json:"annotations"`
-	Time      int    `json:"time"`
-	API       string `json:"api"`
-	Lang      string `json:"lang"`
-	Timestamp string `json:"timestamp"`
-}
-
-type EventsDataJSON struct {
-	Events []sendDataElem `json:"events"`
-}
-
-type sendDataElem struct {
-	Id       int                `json:"id"`
-	Date     string             `json:"date"`
-	Text     string             `json:"text"`
-	Entities []string           `json:"entities"`
-	TfIdf    map[string]float64 `json:"tf_idf"`
-	Entropy  float64            `json:"entropy"`
-}
+// 実行コマンド：
+//
+//	go run . [-linker tagme|offline] [-dict anchors.json] [-min-lp 0.1] [-min-rho 0] [-workers 4] [-resume]
+//	go run . build-dict [-out anchors.json] [-max-words 6]
+//
+// 「-linker offline」ではTagMe APIを使わずに、build-dictで作った辞書でエンティティを抽出する。
+// 辞書はDBのwiki_articleのリンクと、イベントが参照しているwiki内記事から作る。
+// 抽出結果は本文ごとにキャッシュするため、再実行では抽出し直さない。
+// 途中で中断した場合や失敗したイベントがある場合は、「-resume」で続きから処理する。
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "build-dict" {
+		buildDict(os.Args[2:])
+		return
+	}
+	linkerName := flag.String("linker", "tagme", "エンティティの抽出方法（tagme, offline）")
+	dictPath := flag.String("dict", "anchors.json", "オフラインのリンカーで用いる辞書")
+	opt := tagme.DefaultOptions()
+	flag.Float64Var(&opt.MinLinkProbability, "min-lp", opt.MinLinkProbability, "エンティティとして用いるリンクになる割合の下限")
+	flag.Float64Var(&opt.MinRho, "min-rho", opt.MinRho, "エンティティとして用いるrhoの下限")
+	workers := flag.Int("workers", 4, "エンティティの抽出を並行に行う数")
+	cacheDir := flag.String("cache", "tagme_cache", "抽出結果をキャッシュするフォルダ（空文字の場合はキャッシュしない）")
+	retries := flag.Int("retries", 3, "抽出に失敗した場合の再試行の回数")
+	checkpoint := flag.String("checkpoint", "tagme_checkpoint.json", "途中の結果を記録するファイル")
+	resume := flag.Bool("resume", false, "記録した途中の結果から続きを処理する")
+	flag.Parse()
+	annotator, err := linker.NewAnnotator(*linkerName, *dictPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	// イベントデータを抽出
-	d, err := getEventDataAllText("2022-01-01", "2022-12-31")
+	d, err := tagme.GetEventDataAllText("2022-01-01", "2022-12-31")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
 	// TagMeでエンティティを抽出
-	err = d.SetEntitiesFromTagMe()
+	client := tagme.NewClient(annotator, linker.AnnotatorKey(*linkerName, *dictPath))
+	client.Workers = *workers
+	client.CacheDir = *cacheDir
+	client.Retries = *retries
+	client.Checkpoint = *checkpoint
+	client.Resume = *resume
+	annotations, err := tagme.SetEntities(&d, client, opt)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-	// pythonに送るデータを書き込む
-	err = writeSendPythonData(d)
+	// 閾値で取り除く前の全ての抽出結果を保存
+	err = pipeline.WriteAnnotations("/go/src/go/data/annotations.json", annotations)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-}
-
-func writeSendPythonData(d EventsDataJSON) error {
-	jsonData, err := json.Marshal(&d)
-	if err != nil {
-		return err
-	}
-	jsonDataUrl := "/go/src/go/data/EventsDataJSON.json"
-	f, err := os.Create(jsonDataUrl)
+	// 編集者が張ったリンクを正解として、年ごとの適合率と再現率を表示
+	tagme.WriteLinkReport(os.Stdout, tagme.EvaluateAgainstHyperlinks(d))
+	// pythonに送るデータを書き込む
+	err = writeSendPythonData(d)
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
-	f.Write(jsonData)
-	f.Close()
-	return nil
 }
 
-func getEventDataAllText(start, end string) (EventsDataJSON, error) {
+// buildDictはDBからオフラインのリンカーの辞書を作る
+func buildDict(args []string) {
+	fs := flag.NewFlagSet("build-dict", flag.ExitOnError)
+	out := fs.String("out", "anchors.json", "辞書を書き出すファイル")
+	maxWords := fs.Int("max-words", 6, "アンカーテキストの最大の単語数")
+	fs.Parse(args)
 	db, err := sqldb.ConnectDB()
 	if err != nil {
-		return EventsDataJSON{}, err
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
 	defer db.Close()
-	eventData, err := sqldb.SelectEvents(db, start, end)
+	dict, err := linker.BuildFromDB(db, *maxWords)
 	if err != nil {
-		return EventsDataJSON{}, err
-	}
-	var d EventsDataJSON
-	for _, v := range eventData {
-		var e sendDataElem
-		e.Id = v.Id
-		e.Date = v.Date
-		e.Text = util.TruncTailBracketsText(v.Text)
-		d.Events = append(d.Events, e)
-	}
-	return d, nil
-}
-
-func (d *EventsDataJSON) SetEntitiesFromTagMe() error {
-	nowProg := 0
-	fmt.Println("started to get Entieties")
-	for i, e := range d.Events {
-		ents, err := getEntities(util.CutRemoveWords(e.Text))
-		if err != nil {
-			return err
-		}
-		for j, s := range ents {
-			ents[j] = util.CutRemoveWords(s)
-		}
-		d.Events[i].Entities = ents
-		tmpProg := int((float64(i) / float64(len(d.Events))) * 100)
-		if nowProg != tmpProg {
-			nowProg = tmpProg
-			fmt.Printf("\rfinished: %2d%%", nowProg)
-		}
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
-	fmt.Println("\rfinished: 100%")
-
-	return nil
-}
-
-// getEntitiesは与えられた文字列のエンティティを抽出します。
-// 関連度が0.1を下回ったものは除外されます。
-func getEntities(text string) ([]string, error) {
-	text = util.TruncTailBracketsText(text)
-	data, err := queryTagMe(text)
+	err = dict.Save(*out)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return nil, err
-	}
-	entities := make([]string, 0)
-	for _, v := range data.Annotations {
-		if v.LinkProbability < 0.1 {
-			continue
-		}
-		entities = append(entities, v.Spot)
+		return
 	}
-	return entities, nil
+	fmt.Printf("pages: %d, anchors: %d, articles: %d\n", len(dict.Pages), len(dict.Anchors), dict.NumArticles)
 }
 
-// queryTagMeはTagMeのAPIを使用した結果を得ます。
-func queryTagMe(text string) (TagMeData, error) {
-	values := url.Values{}
-	values.Set("text", text)
-	values.Set("gcube-token", util.TagMeAPIKey)
-	req, err := http.NewRequest(
-		"POST",
-		"https://tagme.d4science.org/tagme/tag",
-		strings.NewReader(values.Encode()),
-	)
-	if err != nil {
-		return TagMeData{}, err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		return TagMeData{}, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		fmt.Fprintln(os.Stderr, res.StatusCode)
-		body, _ := io.ReadAll(res.Body)
-		fmt.Fprintln(os.Stderr, string(body))
-		return TagMeData{}, err
-	}
-	body, _ := io.ReadAll(res.Body)
-	var d TagMeData
-	err = json.Unmarshal(body, &d)
-	if err != nil {
-		return TagMeData{}, err
-	}
-	return d, nil
+func writeSendPythonData(d pipeline.EventsDataJSON) error {
+	jsonDataUrl := "/go/src/go/data/EventsDataJSON.json"
+	return pipeline.WriteEvents(jsonDataUrl, d)
 }
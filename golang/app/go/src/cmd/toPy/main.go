@@ -1,110 +1,79 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"main/apis/util"
-	"math"
-	"net/http"
+	"main/apis/analysis"
+	"main/apis/pipeline"
+	"main/apis/pyservice"
 	"os"
-	"strings"
+	"time"
 )
 
-type EventsDataJSON struct {
-	Events []sendDataElem `json:"events"`
-}
-
-type sendDataElem struct {
-	Id       int                `json:"id"`
-	Date     string             `json:"date"`
-	Text     string             `json:"text"`
-	Entities []string           `json:"entities"`
-	TfIdf    map[string]float64 `json:"tf_idf"`
-	Entropy  float64            `json:"entropy"`
-}
-
-const URL = "http://172.27.0.3:8050" // 立て直すたびに変わるので要確認
+// 実行コマンド：go run . [-tfidf go|python] [-compare CosSim.json] [-entropy tokens|entities|normalized|legacy]
+//
+// 「-tfidf go」（初期値）ではPythonを使わずにGoでTF-IDFを計算する。
+// 「-tfidf python」ではPythonのAPIにイベントを送り、TF-IDFを受け取る。
+// 「-compare」を指定すると、Python側で計算した結果と比べて差を表示する。
+// 「-entropy」で情報エントロピーの定義を選ぶ。
 
 func main() {
-	// pythonでTF-IDFを計算
-	gotData, err := sendPython()
+	tfidf := flag.String("tfidf", "go", "TF-IDFの計算方法（go, python）")
+	pythonUrl := flag.String("python-url", "http://python3:8050", "PythonのAPIのURL")
+	chunk := flag.Int("chunk", 2000, "PythonのAPIに一度に送るイベントの数")
+	timeout := flag.Duration("timeout", 10*time.Minute, "PythonのAPIへの一つのリクエストのタイムアウト")
+	compare := flag.String("compare", "", "Python側で計算したTF-IDFのファイル（指定した場合は結果と比べる）")
+	entropy := flag.String("entropy", string(analysis.EntropyTokens), "情報エントロピーの定義（tokens, entities, normalized, legacy）")
+	flag.Parse()
+
+	method, err := analysis.ParseEntropyMethod(*entropy)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return
-	}
-	// エントロピーを計算
-	for i, v := range gotData.Events {
-		gotData.Events[i].Entropy = culcEntropy(v.Text, v.Entities)
+		os.Exit(2)
 	}
-	err = writeJson(gotData)
+
+	d, err := pipeline.ReadEvents("/go/src/go/data/EventsDataJSON.json")
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-}
-
-func sendPython() (EventsDataJSON, error) {
-	res, err := http.Get(URL)
-	if err != nil {
-		return EventsDataJSON{}, err
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		return EventsDataJSON{}, fmt.Errorf("bad request: %d", res.StatusCode)
-	}
-	cosSim, err := os.ReadFile("/go/src/go/data/CosSim.json")
-	if err != nil {
-		return EventsDataJSON{}, err
-	}
-	var writtenData EventsDataJSON
-	err = json.Unmarshal(cosSim, &writtenData)
-	if err != nil {
-		return EventsDataJSON{}, err
-	}
-	return writtenData, nil
-}
-
-func culcEntropy(texts string, entities []string) float64 {
-	texts = strings.ToLower(util.CutRemoveWords(texts))
-	newEntities := make([]string, len(entities))
-	for i, s := range entities {
-		newEntities[i] = strings.ToLower(s)
-	}
-	entitiesCount := make(map[string]int)
-	for _, entity := range newEntities {
-		count := 0
-		for i := 0; i < len(texts)-len(entity)+1; i++ {
-			if texts[i:i+len(entity)] == entity {
-				count++
-			}
+	var gotData pipeline.EventsDataJSON
+	switch *tfidf {
+	case "go":
+		gotData = d
+		analysis.SetTfIdf(&gotData, analysis.DefaultTfIdfOption())
+	case "python":
+		c := pyservice.NewClient(*pythonUrl)
+		c.ChunkSize = *chunk
+		c.Timeout = *timeout
+		// pythonでTF-IDFを計算
+		gotData, err = c.TfIdf(d)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
 		}
-		entitiesCount[entity] = count * len(strings.Fields(entity))
+	default:
+		fmt.Fprintln(os.Stderr, "unknown -tfidf:", *tfidf)
+		os.Exit(2)
 	}
-	textsWordsLen := len(strings.Fields(texts))
-	sum := 0.0
-	for _, v := range entitiesCount {
-		p := float64(v) / float64(textsWordsLen)
-		sum += p * math.Log2(p)
-		if math.IsNaN(sum) {
-			fmt.Println(texts)
-			fmt.Println(entitiesCount)
-			fmt.Println("")
+	if *compare != "" {
+		py, err := pipeline.ReadEvents(*compare)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
 		}
+		maxDiff, mismatched := analysis.CompareTfIdf(gotData, py, 1e-9)
+		fmt.Printf("max diff: %g, mismatched events: %d/%d\n", maxDiff, mismatched, len(gotData.Events))
 	}
-	sum *= -1
-	return sum
-}
-
-func writeJson(d EventsDataJSON) error {
-	output, err := json.Marshal(&d)
-	if err != nil {
-		return err
-	}
-	f, err := os.Create("entropy.json")
+	// エントロピーを計算
+	analysis.SetEntropyWith(&gotData, method)
+	err = writeJson(gotData)
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
-	defer f.Close()
-	f.Write(output)
-	return nil
+}
+
+func writeJson(d pipeline.EventsDataJSON) error {
+	return pipeline.WriteEvents("entropy.json", d)
 }
@@ -1,177 +1,129 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"math"
+	"main/apis/analysis"
+	"main/apis/pipeline"
 	"os"
-	"sort"
-	"time"
+	"strings"
 )
 
-type EventsDataJSON struct {
-	Events []sendDataElem `json:"events"`
-}
-
-type sendDataElem struct {
-	Id       int                `json:"id"`
-	Date     string             `json:"date"`
-	Text     string             `json:"text"`
-	Entities []string           `json:"entities"`
-	TfIdf    map[string]float64 `json:"tf_idf"`
-	Entropy  float64            `json:"entropy"`
-}
-
-type Topics struct {
-	Result []Topic `json:"result"`
-}
-
-type Topic struct {
-	DocIds        map[int]Document   `json:"doc_ids"`
-	CenterGravity map[string]float64 `json:"center_gravity"`
-}
-
-type Document struct {
-	Date    time.Time `json:"date"`
-	Entropy float64   `json:"entropy"`
-}
+// 実行コマンド：go run . [-vectorizer tfidf|bm25|entities|ngram|lsi] [-cluster single-pass|agglomerative|dbscan|kmeans|tdt]
+//
+// 「-cluster」でトピックの分類方法を選ぶ。どの方法でも同じ形式（topics.json）で書き出す。
+// トピックの重心は、トピックに含まれるイベントのベクトルの平均とする。
+// tdtでは日付の古い順にイベントを処理し、「-window」日の間イベントが加わらないトピックを終わらせる。
+// トピックが生まれてから終わるまでの変化（born, updated, dormant, merged）はlifecycle.jsonに書き出す。
+// single-passで「-centroid-decay」に0より大きい値を指定すると、新しく足したイベントほど重く扱う（指数移動平均）。
+// 「-refine」では分類した後に、重心が似ていて期間が重なるトピックをまとめ、まとまりの低いトピックを二つに分ける（判断はrefine.jsonに書き出す）。
+// single-passでは、情報エントロピーが時間と共に増大するという制約を「-entropy-constraint」で選ぶ（strict, tolerance, trend, off）。
+// 制約によって最も類似したトピックに加えなかったイベントは、その理由と共にrejections.jsonに書き出す（トピックはrefine.jsonと同じく最も小さいイベントのIDで表す）。
+// 「-embeddings」に埋め込みのファイル（.jsonl, .npy）か手元のAPIのURLを指定すると、「-vectorizer」の代わりに埋め込みで分類する（cmd/embedを参照）。
 
 func main() {
-	cosSim, err := os.ReadFile("../toPy/entropy.json")
+	eventsPath := flag.String("events", "../toPy/entropy.json", "イベントデータ")
+	name := flag.String("vectorizer", "tfidf", "トピックの分類に用いるベクトル（"+strings.Join(analysis.VectorizerNames, ", ")+"）")
+	embeddings := flag.String("embeddings", "", "埋め込みのファイル（.jsonl, .npy）かAPIのURL（指定した場合は-vectorizerの代わりに用いる）")
+	cluster := flag.String("cluster", "single-pass", "トピックの分類方法（"+strings.Join(analysis.ClustererNames, ", ")+"）")
+	opt := analysis.DefaultClusterOption()
+	flag.Float64Var(&opt.Threshold, "threshold", opt.Threshold, "トピックに分類するコサイン類似度の閾値（single-pass, agglomerative, tdt）")
+	flag.Float64Var(&opt.Decay, "centroid-decay", opt.Decay, "トピックの重心をイベントを足すたびに近づける割合（0の場合は平均、single-pass）")
+	flag.StringVar(&opt.Constraint.Mode, "entropy-constraint", opt.Constraint.Mode, "情報エントロピーの制約の確かめ方（"+strings.Join(analysis.ConstraintNames, ", ")+"、single-pass）")
+	flag.Float64Var(&opt.Constraint.Epsilon, "entropy-epsilon", opt.Constraint.Epsilon, "情報エントロピーの制約で許容する幅（tolerance, trend、single-pass）")
+	flag.StringVar(&opt.Linkage, "linkage", opt.Linkage, "トピック間の類似度の求め方（average, complete、agglomerative）")
+	flag.Float64Var(&opt.Eps, "eps", opt.Eps, "近傍とするコサイン距離（dbscan）")
+	flag.IntVar(&opt.MinPoints, "min-points", opt.MinPoints, "コアとする近傍のイベントの数（dbscan）")
+	flag.IntVar(&opt.K, "k", opt.K, "トピックの数（0の場合はイベントの数から決める、kmeans）")
+	flag.Int64Var(&opt.Seed, "seed", opt.Seed, "乱数のシード（kmeans）")
+	flag.IntVar(&opt.Window, "window", opt.Window, "最後にイベントが加わってからトピックが続く日数（tdt）")
+	flag.Float64Var(&opt.MergeThreshold, "merge-threshold", opt.MergeThreshold, "トピックをまとめるコサイン類似度の閾値（0の場合はまとめない、tdt）")
+	refine := flag.Bool("refine", false, "分類した後に、似たトピックをまとめ、まとまりの低いトピックを分ける")
+	refineOpt := analysis.DefaultRefineOption()
+	flag.Float64Var(&refineOpt.MergeThreshold, "refine-merge", refineOpt.MergeThreshold, "トピックをまとめる重心のコサイン類似度の閾値（-refine）")
+	flag.IntVar(&refineOpt.MaxGap, "refine-gap", refineOpt.MaxGap, "まとめるトピックの期間の隙間として認める日数（-refine）")
+	flag.Float64Var(&refineOpt.SplitCohesion, "refine-cohesion", refineOpt.SplitCohesion, "トピックを分けるまとまりの閾値（-refine）")
+	flag.IntVar(&refineOpt.MinSplitDocs, "refine-min-docs", refineOpt.MinSplitDocs, "分けるトピックのイベント数の下限（-refine）")
+	flag.Parse()
+	vectorizer, err := analysis.NewVectorizer(*name)
+	if *embeddings != "" {
+		vectorizer, err = analysis.NewEmbeddingVectorizer(*embeddings)
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return
+		os.Exit(2)
+	}
+	clusterer, err := analysis.NewClusterer(*cluster, opt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	var writtenData EventsDataJSON
-	err = json.Unmarshal(cosSim, &writtenData)
+	writtenData, err := pipeline.ReadEvents(*eventsPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-	sort.Slice(writtenData.Events, func(i, j int) bool {
-		dateI, _ := time.Parse("2006-01-02", writtenData.Events[i].Date)
-		dateJ, _ := time.Parse("2006-01-02", writtenData.Events[j].Date)
-		return dateI.After(dateJ)
-	})
-	var gotTopics Topics
-	gotTopics.Result = Classification(writtenData, 0.35)
-	err = writeJson(gotTopics)
+	analysis.SortByDateDesc(&writtenData)
+	vectors, err := vectorizer.Vectorize(writtenData)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-	count := make(map[int]int)
-	for _, v := range gotTopics.Result {
-		n := len(v.DocIds)
-		if v, found := count[n]; found {
-			count[n] = v + 1
-		} else {
-			count[n] = 1
-		}
+	var gotTopics pipeline.Topics
+	var lifecycle pipeline.Lifecycle
+	var rejections pipeline.Rejections
+	if e, ok := clusterer.(analysis.Explainer); ok {
+		gotTopics.Result, rejections, err = e.Explain(writtenData, vectors)
+	} else {
+		gotTopics.Result, lifecycle, err = analysis.ClusterAndTrack(clusterer, writtenData, vectors)
 	}
-	fmt.Println(count)
-}
-
-// 類似度によるトピックの分類
-// a（0〜1で指定）をコサイン類似度の閾値とする
-func Classification(d EventsDataJSON, a float64) []Topic {
-	var topics []Topic
-	for _, event := range d.Events {
-		date, err := time.Parse("2006-01-02", event.Date)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	// single-passでは、最も類似したトピックに加えなかったイベントを書き出す
+	if _, ok := clusterer.(analysis.Explainer); ok {
+		err = pipeline.WriteRejections("rejections.json", rejections)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
-			return []Topic{}
-		}
-		inData := Document{Date: date, Entropy: event.Entropy}
-		highestSim := struct {
-			idx    int
-			cosSim float64
-		}{idx: -1}
-		for j, topic := range topics {
-			cosSim := CulcCosSim(event.TfIdf, topic.CenterGravity)
-			if a < cosSim && highestSim.cosSim < cosSim && increaseEntropy(topic, inData) {
-				highestSim = struct {
-					idx    int
-					cosSim float64
-				}{idx: j, cosSim: cosSim}
-			}
-		}
-		if highestSim.idx == -1 {
-			topics = append(topics, Topic{DocIds: make(map[int]Document), CenterGravity: event.TfIdf})
-			topics[len(topics)-1].DocIds[event.Id] = inData
-		} else {
-			topics[highestSim.idx].DocIds[event.Id] = inData
-			topics[highestSim.idx].CulcCenterOfGravity(event.TfIdf)
-		}
-	}
-	return topics
-}
-
-// トピックにdを追加することによって、時間と共にエントロピーが増大することに違反しないか確認する
-func increaseEntropy(topic Topic, inData Document) bool {
-	dateEntropyAvg := make(map[time.Time]float64)
-	for _, doc := range topic.DocIds {
-		if v, found := dateEntropyAvg[doc.Date]; found {
-			dateEntropyAvg[doc.Date] = (v + doc.Entropy) / 2
-		} else {
-			dateEntropyAvg[doc.Date] = doc.Entropy
+			return
 		}
 	}
-	for date, entropy := range dateEntropyAvg {
-		if date.Before(inData.Date) && entropy > inData.Entropy {
-			return false
-		}
-		if inData.Date.Before(date) && entropy < inData.Entropy {
-			return false
+	// tdtでは、トピックが生まれてから終わるまでの変化も書き出す
+	if _, ok := clusterer.(analysis.Tracker); ok {
+		err = pipeline.WriteLifecycle("lifecycle.json", lifecycle)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
 		}
 	}
-	return true
-}
-
-// 二つのベクトルのコサイン類似度を計算
-func CulcCosSim(n, m map[string]float64) float64 {
-	length := func(n map[string]float64) float64 {
-		var l float64
-		for _, vN := range n {
-			l += vN * vN
+	// まとめたり分けたりした判断を書き出す
+	if *refine {
+		var refineLog pipeline.RefineLog
+		gotTopics.Result, refineLog = analysis.Refine(gotTopics.Result, vectors, refineOpt)
+		err = pipeline.WriteRefineLog("refine.json", refineLog)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
 		}
-		l = math.Sqrt(l)
-		return l
 	}
-	var d float64
-	for kN, vN := range n {
-		if vM, found := m[kN]; found {
-			d += vN * vM
-		}
+	err = writeJson(gotTopics)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
 	}
-	l := length(n) * length(m)
-	return d / l
-}
-
-// 二つのベクトルの重心を計算
-func (t *Topic) CulcCenterOfGravity(n map[string]float64) {
-	for kN, vN := range n {
-		if vT, found := t.CenterGravity[kN]; found {
-			t.CenterGravity[kN] = vT + vN
+	count := make(map[int]int)
+	for _, v := range gotTopics.Result {
+		n := len(v.DocIds)
+		if v, found := count[n]; found {
+			count[n] = v + 1
 		} else {
-			t.CenterGravity[kN] = vN
+			count[n] = 1
 		}
 	}
-	for k, v := range t.CenterGravity {
-		t.CenterGravity[k] = v / 2
-	}
+	fmt.Println(count)
 }
 
-func writeJson(d Topics) error {
-	output, err := json.Marshal(&d)
-	if err != nil {
-		return err
-	}
-	f, err := os.Create("topics.json")
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	f.Write(output)
-	return nil
+func writeJson(d pipeline.Topics) error {
+	return pipeline.WriteTopics("topics.json", d)
 }
@@ -22,6 +22,12 @@ func Get() {
 	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
 	// 終了日（半開区間）[start, end)
 	end := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 正規化したURLがない記事（過去に登録したもの）に、正規化したURLを登録する
+	err := fillCanonicalUrls()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
 	for next := start; next.Before(end); {
 		err := GetDocuments(next)
 		if err != nil {
@@ -34,6 +40,15 @@ func Get() {
 	}
 }
 
+func fillCanonicalUrls() error {
+	db, err := sqldb.ConnectDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return sqldb.FillEmptyCanonicalUrls(db)
+}
+
 func GetDocuments(t time.Time) error {
 	events, err := wiki.GetEventData(t)
 	if err != nil {
@@ -90,7 +105,7 @@ func queryDB(events []sqldb.Event, wiki [][]sqldb.WikiArt, news [][]sqldb.NewsAr
 		events[i].EntitiesId = util.SearchId(wikiId, wikiUrl)
 		var newsUrl []string
 		for _, v := range news[i] {
-			newsUrl = append(newsUrl, v.NewsSourceUrl)
+			newsUrl = append(newsUrl, util.CanonicalizeUrlOrRaw(v.NewsSourceUrl))
 		}
 		events[i].NewsSourceUrlId = util.SearchId(newsId, newsUrl)
 		if err != nil {
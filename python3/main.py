@@ -1,4 +1,6 @@
 import os
+import threading
+import uuid
 import gensim
 from gensim.models import LsiModel
 from gensim import corpora
@@ -8,7 +10,7 @@ from nltk.tokenize import RegexpTokenizer
 from nltk.stem.porter import PorterStemmer
 import pickle
 import json
-from flask import Flask, request, jsonify
+from flask import Flask, request, jsonify, Response
 
 
 en_stop_list = [
@@ -35,6 +37,8 @@ class EventData:
     tf_idf = {}
 
     def __init__(self, event):
+        # 書き出すときに、知らない項目（category、tags、entity_sources、entropyなど）も落とさずに戻す
+        self.raw = event
         self.id = event["id"]
         self.date = event["date"]
         self.text = event["text"]
@@ -60,13 +64,13 @@ def text_cleaning(events):
 
 
 def open_event_data_json(path):
-    # JSONファイルを変換
+    # JSONファイルを変換（schema_versionがないファイルはバージョン1として扱う）
     with open(path, "r") as f:
         d = json.load(f)
     events = []
     for event in d["events"]:
         events.append(EventData(event))
-    return events
+    return events, d.get("schema_version", 1)
 
 
 def write_event_data_json(d, path):
@@ -74,7 +78,7 @@ def write_event_data_json(d, path):
         json.dump(d, f)
 
 
-def create_corpus(events):
+def create_corpus(events, save=True):
     # 全てのトークンを格納
     all_tokens = text_cleaning(events)
     # tokens内の単語それぞれの出現頻度を調べる
@@ -86,20 +90,24 @@ def create_corpus(events):
     border = 5
     all_tokens = [[t for t in tokens if frequency[t] > border] for tokens in all_tokens]
     # トークンを保存
-    with open("texts.pkl", 'wb') as f:
-        pickle.dump(all_tokens, f)
+    if save:
+        with open("texts.pkl", 'wb') as f:
+            pickle.dump(all_tokens, f)
     # 辞書を作成
     dictionary = corpora.Dictionary(all_tokens)
     dictionary.filter_extremes(no_below=2, no_above=0.8)
     # 辞書を保存
-    dictionary.save_as_text("dictionary.txt")
+    if save:
+        dictionary.save_as_text("dictionary.txt")
     # BoWのコーパスを作成
     corpus = [dictionary.doc2bow(t) for t in all_tokens]
-    with open("corpus.pkl", 'wb') as f:
-        pickle.dump(corpus, f)
+    if save:
+        with open("corpus.pkl", 'wb') as f:
+            pickle.dump(corpus, f)
     # BoWをtf-idfに変換
     tfidf = gensim.models.TfidfModel(corpus)
-    tfidf.save('model.tfidf')
+    if save:
+        tfidf.save('model.tfidf')
     corpus_tfidf = tfidf[corpus]
     idx = 0
     for tfidf in corpus_tfidf:
@@ -109,8 +117,9 @@ def create_corpus(events):
         events[idx].set_tf_idf(tfidfdict)
         idx += 1
     # 保存
-    with open("corpus_tfidf.pkl", 'wb') as f:
-        pickle.dump(corpus_tfidf, f)
+    if save:
+        with open("corpus_tfidf.pkl", 'wb') as f:
+            pickle.dump(corpus_tfidf, f)
 
 
 def culc_cosine_sim(events):
@@ -124,31 +133,124 @@ def culc_cosine_sim(events):
     return
 
 
-def get_dict(events):
-    data = {"events": []}
+# Go側のpipeline.EventsSchemaVersionと合わせる
+EVENTS_SCHEMA_VERSION = 4
+
+
+def get_dict(events, schema_version):
+    # 受け取ったイベントの全ての項目を残し、tf_idfだけを書き換える
+    # schema_versionは受け取ったファイルのものを用いる（古いファイルを新しいバージョンとして書き出さない）
+    data = {"schema_version": schema_version, "events": []}
     for e in events:
-        data["events"].append({
-            "date": e.date,
-            "id": e.id,
-            "text": e.text,
-            "entities": e.entities,
-            "tf_idf": e.tf_idf})
+        event = dict(e.raw)
+        event["tf_idf"] = e.tf_idf
+        data["events"].append(event)
     return data
 
 
+def get_results(events):
+    return [{"id": e.id, "tf_idf": e.tf_idf} for e in events]
+
+
+def error(message, status):
+    return jsonify({"error": message}), status
+
+
+def check_schema_version(d):
+    version = d.get("schema_version", EVENTS_SCHEMA_VERSION)
+    if version != EVENTS_SCHEMA_VERSION:
+        raise ValueError("unsupported schema_version %d" % version)
+
+
 app = Flask(__name__)
 
+# イベントを分けて受け取るセッション（IDごとに受け取ったイベントを保持する）
+sessions = {}
+sessions_lock = threading.Lock()
+
+
+@app.route('/health', methods=['GET'])
+def health():
+    return jsonify({"status": "ok", "schema_version": EVENTS_SCHEMA_VERSION})
+
+
+@app.route('/tfidf', methods=['POST'])
+def tfidf_from_events():
+    # 全てのイベントを一度に受け取り、TF-IDFを戻す（ファイルには書き出さない）
+    try:
+        d = request.get_json(force=True)
+        check_schema_version(d)
+        events = [EventData(e) for e in d["events"]]
+    except Exception as e:
+        return error("invalid events: %s" % e, 400)
+    try:
+        create_corpus(events, save=False)
+    except Exception as e:
+        app.logger.exception("failed to create corpus")
+        return error("failed to create corpus: %s" % e, 500)
+    return jsonify({"schema_version": EVENTS_SCHEMA_VERSION, "results": get_results(events)})
+
+
+@app.route('/sessions', methods=['POST'])
+def create_session():
+    session_id = uuid.uuid4().hex
+    with sessions_lock:
+        sessions[session_id] = []
+    return jsonify({"session_id": session_id, "received": 0})
+
+
+@app.route('/sessions/<session_id>/events', methods=['POST'])
+def add_session_events(session_id):
+    # NDJSON（1行に1イベント）で受け取る
+    try:
+        events = [EventData(json.loads(line)) for line in request.get_data(as_text=True).splitlines() if line.strip()]
+    except Exception as e:
+        return error("invalid events: %s" % e, 400)
+    with sessions_lock:
+        if session_id not in sessions:
+            return error("session %s is not found" % session_id, 404)
+        sessions[session_id].extend(events)
+        received = len(sessions[session_id])
+    return jsonify({"session_id": session_id, "received": received})
+
+
+@app.route('/sessions/<session_id>/tfidf', methods=['POST'])
+def tfidf_from_session(session_id):
+    # 受け取った全てのイベントからTF-IDFを計算し、NDJSON（1行に1イベント）で戻す
+    with sessions_lock:
+        events = sessions.pop(session_id, None)
+    if events is None:
+        return error("session %s is not found" % session_id, 404)
+    try:
+        create_corpus(events, save=False)
+    except Exception as e:
+        app.logger.exception("failed to create corpus")
+        return error("failed to create corpus: %s" % e, 500)
+
+    def generate():
+        for r in get_results(events):
+            yield json.dumps(r) + "\n"
+    return Response(generate(), mimetype="application/x-ndjson")
+
+
+@app.route('/sessions/<session_id>', methods=['DELETE'])
+def delete_session(session_id):
+    with sessions_lock:
+        sessions.pop(session_id, None)
+    return "", 204
+
 
+# 共有フォルダのファイルを読み書きする以前のやり方（Go側からは使っていない）
 @app.route('/', methods=['GET'])
 def culc_cos_sim_from_events():
     app.logger.info("start")
     try:
-        all_events = open_event_data_json("/go/data/go/data/EventsDataJSON.json")
+        all_events, schema_version = open_event_data_json("/go/data/go/data/EventsDataJSON.json")
         create_corpus(all_events)
         app.logger.info("fin create_corpus")
         # culc_cosine_sim(all_events)
         # app.logger.info("fin culc_cosine_sim")
-        write_event_data_json(get_dict(all_events), "/go/data/go/data/CosSim.json")
+        write_event_data_json(get_dict(all_events, schema_version), "/go/data/go/data/CosSim.json")
         app.logger.info("fin get_dict")
     except:
         app.logger.info("error")
@@ -157,4 +259,4 @@ def culc_cos_sim_from_events():
 
 
 if __name__ == "__main__":
-    app.run(debug=True, host="0.0.0.0", port=int(os.environ.get("PORT", 8050)))
+    app.run(debug=True, threaded=True, host="0.0.0.0", port=int(os.environ.get("PORT", 8050)))
@@ -0,0 +1,21 @@
+# Go側のTF-IDF（analysis.SetTfIdf）のテストに用いる、gensimでの計算結果を書き出す
+# 実行コマンド：python tfidf_fixture.py ../golang/app/go/src/apis/analysis/testdata/tfidf_events.json ../golang/app/go/src/apis/analysis/testdata/tfidf_gensim.json
+# 書き出す形式はPOST /tfidfのレスポンスと同じ
+import json
+import sys
+
+from main import EVENTS_SCHEMA_VERSION, EventData, create_corpus, get_results
+
+
+def main(events_path, out_path):
+    with open(events_path, "r") as f:
+        d = json.load(f)
+    events = [EventData(e) for e in d["events"]]
+    create_corpus(events, save=False)
+    with open(out_path, "wt") as f:
+        json.dump({"schema_version": EVENTS_SCHEMA_VERSION, "results": get_results(events)}, f, indent=2)
+        f.write("\n")
+
+
+if __name__ == "__main__":
+    main(sys.argv[1], sys.argv[2])